@@ -61,7 +61,7 @@ function App() {
       setUser({ login: formData.login });
       setPage('articles');
     } catch (err) {
-      setError('Неверные учетные данные');
+      setError(err.response?.data?.message || 'Неверные учетные данные');
     }
   };
 
@@ -80,7 +80,8 @@ function App() {
       setError('Регистрация успешна! Теперь войдите');
       setPage('login');
     } catch (err) {
-      setError(err.response?.data || 'Ошибка регистрации');
+      // Ошибки приходят с HTTP-статусом, текст — в поле message ответа
+      setError(err.response?.data?.message || 'Ошибка регистрации');
     }
   };
 
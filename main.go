@@ -2,78 +2,419 @@ package main
 
 import (
 	"blog/pkg/auth"
+	"blog/pkg/cache"
+	"blog/pkg/cli"
+	"blog/pkg/cors"
 	"blog/pkg/dbwork"
+	"blog/pkg/feed"
 	"blog/pkg/handlers"
+	"blog/pkg/logging"
+	"blog/pkg/markdown"
+	"blog/pkg/media"
+	"blog/pkg/metrics"
+	"blog/pkg/models"
+	"blog/pkg/oidc"
+	"blog/pkg/password"
+	"blog/pkg/site"
+	"blog/pkg/storage"
+	"blog/pkg/tracing"
+	"context"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
-func enableCORS(router *mux.Router) {
-	router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*") // Разрешить все домены
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	})
-}
-
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		// The runtime image has no curl, so the container health check calls the binary itself
+		case "healthcheck":
+			os.Exit(healthcheck())
+		case "migrate":
+			os.Exit(cli.Migrate(os.Args[2:], dbConfig))
+		// Command output goes to stdout, so logs are written to stderr
+		case "admin":
+			warnLocalCache()
+			os.Exit(command(cli.Admin))
+		case "export":
+			os.Exit(command(cli.Export))
+		case "import":
+			warnLocalCache()
+			os.Exit(command(cli.Import))
+		case "import-wxr":
+			warnLocalCache()
+			os.Exit(command(cli.ImportWXR))
+		case "import-markdown":
+			warnLocalCache()
+			os.Exit(command(cli.ImportMarkdown))
+		case "build-static":
+			os.Exit(command(cli.BuildStatic))
+		default:
+			fmt.Fprintf(os.Stderr, "неизвестная команда %q, ожидается healthcheck, migrate, admin, export, import, import-wxr, import-markdown или build-static\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
+	shutdown := setup(os.Stdout)
+	defer shutdown()
+
 	router := mux.NewRouter()
 
+	// Спан открывается первым, чтобы логи запроса содержали trace_id
+	router.Use(otelmux.Middleware(envString("OTEL_SERVICE_NAME", "blog")))
 	router.Use(handlers.LoggingMiddleware)
-	enableCORS(router)
+	router.Use(metrics.Middleware)
+
+	router.Handle("/metrics", metrics.Handler(os.Getenv("METRICS_TOKEN"))).Methods("GET")
+	router.HandleFunc("/healthz", handlers.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", handlers.Readyz).Methods("GET")
+	router.Handle("/debug/status", metrics.RequireToken(os.Getenv("METRICS_TOKEN"), http.HandlerFunc(handlers.DebugStatus))).Methods("GET")
 
 	router.HandleFunc("/login", handlers.LoginHandler).Methods("POST")
+	router.HandleFunc("/login/2fa", handlers.LoginTwoFactor).Methods("POST")
+	router.HandleFunc("/logout", handlers.Logout).Methods("POST")
 	router.HandleFunc("/register", handlers.Register).Methods("POST")
-	router.HandleFunc("/article/{id}", handlers.GetArticle).Methods("GET")
-	router.HandleFunc("/article", handlers.GetAllArticle).Methods("GET")
+	router.HandleFunc("/auth/oidc/login", handlers.OIDCLogin).Methods("GET")
+	router.HandleFunc("/auth/oidc/callback", handlers.OIDCCallback).Methods("GET")
+	router.HandleFunc("/user/{login}/followers", handlers.GetFollowers).Methods("GET")
+	router.HandleFunc("/user/{login}/following", handlers.GetFollowing).Methods("GET")
+	router.HandleFunc("/user/{login}/feed.atom", handlers.GetAuthorAtomFeed).Methods("GET")
+	router.HandleFunc("/feed.rss", handlers.GetRSSFeed).Methods("GET")
+	router.HandleFunc("/feed.atom", handlers.GetAtomFeed).Methods("GET")
+	router.HandleFunc("/feed.json", handlers.GetJSONFeed).Methods("GET")
+	router.HandleFunc("/sitemap.xml", handlers.GetSitemap).Methods("GET")
+	router.HandleFunc("/sitemap-{page:[0-9]+}.xml", handlers.GetSitemapPage).Methods("GET")
+	router.HandleFunc("/media/{id}", handlers.GetMedia).Methods("GET")
+	router.HandleFunc("/media/{id}/thumbnail", handlers.GetMediaThumbnail).Methods("GET")
+
+	// Public routes that personalise the response for authenticated users
+	optional := router.PathPrefix("").Subrouter()
+	optional.Use(auth.OptionalAuthMiddleware())
+
+	optional.HandleFunc("/article/{id}", handlers.GetArticle).Methods("GET")
+	optional.HandleFunc("/article", handlers.GetAllArticle).Methods("GET")
+
+	// Routes available to personal access tokens with the articles:write scope
+	articles := router.PathPrefix("").Subrouter()
+	articles.Use(auth.AuthMiddleware(auth.ScopeArticlesWrite))
+
+	articles.HandleFunc("/article", handlers.CreateArticle).Methods("POST")
+	articles.HandleFunc("/article/{id}", handlers.DeleteArticle).Methods("DELETE")
+	articles.HandleFunc("/article", handlers.UpdateArticle).Methods("PUT")
+	articles.HandleFunc("/media", handlers.UploadMedia).Methods("POST")
+	articles.HandleFunc("/media/{id}", handlers.DeleteMedia).Methods("DELETE")
 
 	// Protected routes
 	protected := router.PathPrefix("").Subrouter()
 	protected.Use(auth.AuthMiddleware())
 
-	protected.HandleFunc("/article", handlers.CreateArticle).Methods("POST")
-	protected.HandleFunc("/article/{id}", handlers.DeleteArticle).Methods("DELETE")
-	protected.HandleFunc("/article", handlers.UpdateArticle).Methods("PUT")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	protected.HandleFunc("/auth/oidc/link", handlers.OIDCLink).Methods("GET")
+	protected.HandleFunc("/user/me/tokens", handlers.CreateAPIToken).Methods("POST")
+	protected.HandleFunc("/user/me/tokens", handlers.GetAPITokens).Methods("GET")
+	protected.HandleFunc("/user/me/tokens/{id}", handlers.DeleteAPIToken).Methods("DELETE")
+	protected.HandleFunc("/user/me/2fa/setup", handlers.SetupTOTP).Methods("POST")
+	protected.HandleFunc("/user/me/2fa/confirm", handlers.ConfirmTOTP).Methods("POST")
+	protected.HandleFunc("/user/me/2fa/disable", handlers.DisableTOTP).Methods("POST")
+	protected.HandleFunc("/article/{id}/reactions/{kind}", handlers.SetReaction).Methods("PUT")
+	protected.HandleFunc("/article/{id}/reactions/{kind}", handlers.DeleteReaction).Methods("DELETE")
+	protected.HandleFunc("/user/{login}/follow", handlers.FollowUser).Methods("POST")
+	protected.HandleFunc("/user/{login}/follow", handlers.UnfollowUser).Methods("DELETE")
+	protected.HandleFunc("/feed", handlers.GetFeed).Methods("GET")
+	protected.HandleFunc("/article/{id}/bookmark", handlers.SetBookmark).Methods("PUT")
+	protected.HandleFunc("/article/{id}/bookmark", handlers.DeleteBookmark).Methods("DELETE")
+	protected.HandleFunc("/user/me/bookmarks", handlers.GetBookmarks).Methods("GET")
+	protected.HandleFunc("/user/me/media", handlers.GetUserMedia).Methods("GET")
+
+	// Administrator routes
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(auth.AuthMiddleware(), auth.RequireRole(models.RoleAdmin))
+
+	admin.HandleFunc("/export", handlers.ExportContent).Methods("GET")
+	admin.HandleFunc("/import", handlers.ImportContent).Methods("POST")
+
+	// Server-rendered pages use the same paths as the build-static output
+	if envString("HTML_UI", "false") == "true" {
+		router.Handle("/style.css", http.FileServerFS(site.Assets())).Methods("GET")
+
+		pages := router.PathPrefix("").Subrouter()
+		pages.Use(auth.OptionalAuthMiddleware())
+
+		pages.HandleFunc("/", handlers.HTMLIndex).Methods("GET")
+		pages.HandleFunc("/page/{page:[0-9]+}/", handlers.HTMLIndex).Methods("GET")
+		pages.HandleFunc("/article/{id:[0-9]+}/", handlers.HTMLArticle).Methods("GET")
+		pages.HandleFunc("/user/{login}/", handlers.HTMLAuthor).Methods("GET")
+		pages.HandleFunc("/user/{login}/page/{page:[0-9]+}/", handlers.HTMLAuthor).Methods("GET")
+
+		// Forms rely on the session cookie, so sign-in and authoring need cookie sessions
+		if auth.CookieEnabled() {
+			pages.HandleFunc("/account/login", handlers.HTMLLoginForm).Methods("GET")
+			pages.HandleFunc("/account/login", handlers.HTMLLogin).Methods("POST")
+			pages.HandleFunc("/account/logout", handlers.HTMLLogout).Methods("POST")
+			pages.HandleFunc("/write", handlers.HTMLEditor).Methods("GET")
+			pages.HandleFunc("/write", handlers.HTMLSaveArticle).Methods("POST")
+			pages.HandleFunc("/article/{id:[0-9]+}/edit", handlers.HTMLEditor).Methods("GET")
+			pages.HandleFunc("/article/{id:[0-9]+}/edit", handlers.HTMLSaveArticle).Methods("POST")
+		}
+	}
+
+	handler, err := cors.New(cors.Config{
+		AllowedOrigins:   envList("CORS_ALLOWED_ORIGINS", "*"),
+		AllowedHeaders:   envList("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, X-CSRF-Token, If-Match, If-None-Match"),
+		ExposedHeaders:   envList("CORS_EXPOSED_HEADERS", "ETag"),
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		MaxAge:           envInt("CORS_MAX_AGE", 600),
+	}, router)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Stop on SIGTERM from docker so pending spans are flushed on exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: ":8080", Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// command runs a CLI command after setup and flushes traces before the process exits
+func command(run func(args []string) int) int {
+	shutdown := setup(os.Stderr)
+	defer shutdown()
+	return run(os.Args[2:])
+}
+
+// warnLocalCache tells the operator that a memory cache lives inside the server
+// process, so writes made by a CLI command reach readers only after entries expire
+func warnLocalCache() {
+	if envString("CACHE_BACKEND", cache.BackendNone) == cache.BackendMemory {
+		fmt.Fprintf(os.Stderr, "CACHE_BACKEND=memory: сервер покажет изменения только после истечения кеша (CACHE_TTL_SECONDS=%d)\n", envInt("CACHE_TTL_SECONDS", 60))
+	}
+}
+
+// healthcheck asks the running server whether it is ready and returns the exit code
+func healthcheck() int {
+	client := http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(envString("HEALTHCHECK_URL", "http://localhost:8080/readyz"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintln(os.Stderr, resp.Status)
+		return 1
+	}
+	return 0
+}
+
+// envInt читает необязательный числовой параметр конфигурации
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return result
+}
+
+// envString читает необязательный строковый параметр конфигурации
+func envString(key, def string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// envList читает список значений, разделённых запятыми
+func envList(key, def string) []string {
+	result := make([]string, 0)
+	for _, value := range strings.Split(envString(key, def), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
 }
 
-func init() {
+// dbConfig reads the database connection parameters
+func dbConfig() dbwork.PostgresDBParams {
 	port, err := strconv.Atoi(os.Getenv("PORT"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	configDB := dbwork.PostgresDBParams{
-		User:     os.Getenv("USER"),
-		Password: os.Getenv("PASSWORD"),
-		Host:     os.Getenv("HOST"),
-		Port:     port,
-		SSLMode:  os.Getenv("SSLMODE"),
-		DBName:   os.Getenv("DBNAME"),
+	return dbwork.PostgresDBParams{
+		User:        os.Getenv("USER"),
+		Password:    os.Getenv("PASSWORD"),
+		Host:        os.Getenv("HOST"),
+		Port:        port,
+		SSLMode:     os.Getenv("SSLMODE"),
+		DBName:      os.Getenv("DBNAME"),
+		AutoMigrate: envString("AUTO_MIGRATE", "false") == "true",
+	}
+}
+
+// setup reads the configuration and connects to the database before the server starts.
+// The returned func flushes pending spans and must run before exit
+func setup(logOutput io.Writer) func() {
+	logConfig := logging.DefaultConfig()
+	logConfig.Output = logOutput
+	logConfig.Level = envString("LOG_LEVEL", logConfig.Level)
+	logConfig.Format = envString("LOG_FORMAT", logConfig.Format)
+	logConfig.RedactKeys = envList("LOG_REDACT_KEYS", "")
+	if err := logging.InitializationLogger(logConfig); err != nil {
+		log.Fatal(err)
+	}
+
+	tracingConfig := tracing.DefaultConfig()
+	tracingConfig.Exporter = envString("TRACING_EXPORTER", tracingConfig.Exporter)
+	tracingConfig.ServiceName = envString("OTEL_SERVICE_NAME", tracingConfig.ServiceName)
+	tracingConfig.Endpoint = envString("TRACING_OTLP_ENDPOINT", tracingConfig.Endpoint)
+	tracingConfig.Insecure = envString("TRACING_OTLP_INSECURE", "true") == "true"
+	if ratio := envString("TRACING_SAMPLE_RATIO", ""); ratio != "" {
+		sampleRatio, err := strconv.ParseFloat(ratio, 64)
+		if err != nil {
+			log.Fatalf("TRACING_SAMPLE_RATIO: %v", err)
+		}
+		tracingConfig.SampleRatio = sampleRatio
+	}
+	shutdownTracing, err := tracing.InitializationTracing(tracingConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	policy := password.DefaultPolicy()
+	policy.MinLength = envInt("PASSWORD_MIN_LENGTH", policy.MinLength)
+	policy.MaxLength = envInt("PASSWORD_MAX_LENGTH", policy.MaxLength)
+	policy.LoginMinLength = envInt("LOGIN_MIN_LENGTH", policy.LoginMinLength)
+	policy.LoginMaxLength = envInt("LOGIN_MAX_LENGTH", policy.LoginMaxLength)
+	policy.CheckCommon = envString("PASSWORD_CHECK_COMMON", "true") == "true"
+	if err := password.InitializationPolicy(policy); err != nil {
+		log.Fatal(err)
+	}
+
+	hashParams := password.DefaultHashParams()
+	hashParams.Algorithm = envString("PASSWORD_HASH", hashParams.Algorithm)
+	hashParams.BcryptCost = envInt("PASSWORD_BCRYPT_COST", hashParams.BcryptCost)
+	if err := password.InitializationHash(hashParams); err != nil {
+		log.Fatal(err)
 	}
 
-	err = dbwork.InitializationDB(configDB)
+	err = dbwork.InitializationDB(dbConfig())
 	if err != nil {
 		log.Fatal(err)
 	}
+	dbwork.DB.Run()
+
+	switch backend := envString("CACHE_BACKEND", cache.BackendNone); backend {
+	case cache.BackendNone:
+	case cache.BackendMemory:
+		ttl := time.Duration(envInt("CACHE_TTL_SECONDS", 60)) * time.Second
+		dbwork.InitializationCache(cache.NewMemory(envInt("CACHE_SIZE", 4096)), ttl)
+	case cache.BackendRedis:
+		redis, err := cache.NewRedis(envString("REDIS_URL", "redis://localhost:6379/0"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		ttl := time.Duration(envInt("CACHE_TTL_SECONDS", 60)) * time.Second
+		dbwork.InitializationCache(redis, ttl)
+	default:
+		log.Fatalf("CACHE_BACKEND: неизвестное значение %s", backend)
+	}
+	// Трассировка оборачивает кеш, чтобы попадания в него тоже были видны
+	dbwork.InitializationTracing()
+
 	hours, err := strconv.Atoi(os.Getenv("JWT_EXPIRATION_HOURS"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	auth.InitializationSecret(os.Getenv("JWT_SECRET"), hours)
+	auth.InitializationTOTP(envString("TOTP_ISSUER", "Blog"))
+
+	sameSite := http.SameSiteLaxMode
+	if os.Getenv("SESSION_COOKIE_SAMESITE") == "strict" {
+		sameSite = http.SameSiteStrictMode
+	}
+	err = auth.InitializationSession(auth.SessionConfig{
+		Mode:     envString("AUTH_MODE", auth.ModeBearer),
+		Secure:   os.Getenv("SESSION_COOKIE_SECURE") == "true",
+		SameSite: sameSite,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	markdown.InitializationCache(envInt("MARKDOWN_CACHE_SIZE", 1024))
+
+	feedConfig := feed.DefaultConfig()
+	feedConfig.SiteURL = envString("SITE_URL", feedConfig.SiteURL)
+	feedConfig.Title = envString("FEED_TITLE", feedConfig.Title)
+	feedConfig.Description = envString("FEED_DESCRIPTION", feedConfig.Description)
+	feedConfig.ItemCount = envInt("FEED_ITEM_COUNT", feedConfig.ItemCount)
+	feedConfig.HTMLPages = envString("HTML_UI", "false") == "true"
+	feed.InitializationFeed(feedConfig)
+
+	mediaConfig := media.DefaultConfig()
+	mediaConfig.MaxBytes = int64(envInt("MEDIA_MAX_BYTES", int(mediaConfig.MaxBytes)))
+	mediaConfig.ThumbnailSize = envInt("MEDIA_THUMBNAIL_SIZE", mediaConfig.ThumbnailSize)
+	mediaConfig.MaxPixels = envInt("MEDIA_MAX_PIXELS", mediaConfig.MaxPixels)
+	media.InitializationMedia(mediaConfig)
+
+	err = storage.InitializationStorage(storage.Config{
+		Backend:   envString("MEDIA_STORAGE", storage.BackendLocal),
+		Dir:       envString("MEDIA_DIR", "media"),
+		Endpoint:  os.Getenv("S3_ENDPOINT"),
+		AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_SECRET_KEY"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		Region:    os.Getenv("S3_REGION"),
+		UseSSL:    os.Getenv("S3_USE_SSL") == "true",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	oidc.InitializationOIDC(oidc.Config{
+		Issuer:            os.Getenv("OIDC_ISSUER"),
+		ClientID:          os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:      os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:       os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:            strings.Fields(os.Getenv("OIDC_SCOPES")),
+		PostLoginRedirect: os.Getenv("OIDC_POST_LOGIN_REDIRECT"),
+		LinkExisting:      os.Getenv("OIDC_LINK_EXISTING") == "true",
+		StateSecret:       []byte(os.Getenv("JWT_SECRET")),
+	})
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Не удалось отправить трассы", "error", err)
+		}
+	}
 }
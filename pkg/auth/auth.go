@@ -1,16 +1,60 @@
 package auth
 
 import (
+	"blog/pkg/dbwork"
 	"blog/pkg/models"
 	"context"
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+const (
+	PurposeTwoFactor = "2fa"
+
+	challengeExpiration  = 5 * time.Minute
+	challengeMaxAttempts = 5
+
+	// Как часто обновляется время последнего использования токена
+	touchInterval = time.Minute
+
+	// После стольких неудачных кодов подряд второй шаг для учётной записи
+	// закрывается на accountLockout с момента последней попытки
+	accountMaxFailures = 10
+	accountLockout     = 15 * time.Minute
+)
+
+var (
+	ErrInvalidChallenge = errors.New("Недействительный или просроченный токен подтверждения")
+	ErrAccountDisabled  = errors.New("Учётная запись заблокирована")
+	ErrForbidden        = errors.New("Недостаточно прав")
+
+	ErrChallengeExhausted = errors.New("Слишком много попыток, войдите заново")
+	ErrAccountLocked      = errors.New("Слишком много неверных кодов, попробуйте позже")
+
+	// Число попыток ввода кода по каждому промежуточному токену
+	// и неудачных попыток по каждой учётной записи
+	challengeFailures   = make(map[string]challengeAttempts)
+	accountFailures     = make(map[string]challengeAttempts)
+	challengeFailuresMu sync.Mutex
+
+	// Когда процесс последний раз отмечал использование каждого токена
+	touchedTokens   = make(map[int]time.Time)
+	touchedTokensMu sync.Mutex
+)
+
+type challengeAttempts struct {
+	count     int
+	expiresAt time.Time
+}
+
 var (
 	secret     string
 	expiration time.Duration
@@ -34,20 +78,128 @@ func GenerateJWT(login string) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
+// GenerateChallengeJWT выдаёт короткоживущий токен первого шага входа,
+// который обменивается на полноценный JWT вместе с кодом TOTP
+func GenerateChallengeJWT(login string) (string, error) {
+	claims := &models.Claims{
+		Login:   login,
+		Purpose: PurposeTwoFactor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(challengeExpiration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+func ParseChallengeJWT(tokenString string) (*models.Claims, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil || claims.Purpose != PurposeTwoFactor || claims.ID == "" {
+		return nil, ErrInvalidChallenge
+	}
+	return claims, nil
+}
+
+// VerifyChallenge проверяет код второго шага функцией verify. Попытка
+// занимается до проверки под блокировкой, поэтому параллельные запросы
+// с одним токеном не обходят лимит. Кроме лимита на токен действует
+// лимит неудач на учётную запись: новый вход паролем его не сбрасывает
+func VerifyChallenge(claims *models.Claims, verify func() (bool, error)) (bool, error) {
+	if err := reserveChallengeAttempt(claims); err != nil {
+		return false, err
+	}
+
+	verified, err := verify()
+
+	challengeFailuresMu.Lock()
+	defer challengeFailuresMu.Unlock()
+	if verified && err == nil {
+		delete(accountFailures, claims.Login)
+		// Токен, по которому уже вошли, повторно не принимается
+		challengeFailures[claims.ID] = challengeAttempts{count: challengeMaxAttempts, expiresAt: claims.ExpiresAt.Time}
+	}
+	return verified, err
+}
+
+func reserveChallengeAttempt(claims *models.Claims) error {
+	challengeFailuresMu.Lock()
+	defer challengeFailuresMu.Unlock()
+
+	now := time.Now()
+	for id, attempts := range challengeFailures {
+		if now.After(attempts.expiresAt) {
+			delete(challengeFailures, id)
+		}
+	}
+	for login, attempts := range accountFailures {
+		if now.After(attempts.expiresAt) {
+			delete(accountFailures, login)
+		}
+	}
+
+	account := accountFailures[claims.Login]
+	if account.count >= accountMaxFailures {
+		return ErrAccountLocked
+	}
+	attempts := challengeFailures[claims.ID]
+	if attempts.count >= challengeMaxAttempts {
+		return ErrChallengeExhausted
+	}
+
+	attempts.count++
+	attempts.expiresAt = claims.ExpiresAt.Time
+	challengeFailures[claims.ID] = attempts
+
+	account.count++
+	account.expiresAt = now.Add(accountLockout)
+	accountFailures[claims.Login] = account
+	return nil
+}
+
+func parseJWT(tokenString string) (*models.Claims, error) {
+	claims := &models.Claims{}
+
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return []byte(secret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
 // swagger:response jwtToken
 type JWTResponse struct {
 	// in:body
 	Body struct {
-		Token string `json:"token"`
+		// JWT, если включён режим bearer
+		Token string `json:"token,omitempty"`
+		// CSRF-токен для заголовка X-CSRF-Token, если включён режим cookie
+		CSRFToken string `json:"csrf_token,omitempty"`
 	}
 }
 
-func AuthMiddleware() mux.MiddlewareFunc {
+// AuthMiddleware принимает JWT из заголовка или cookie (в зависимости от режима),
+// а также персональные токены, если для маршрута перечислены разрешения
+// и токен обладает каждым из них
+func AuthMiddleware(scopes ...string) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
+		next = requireActive(next)
 		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				models.ResponseBadRequest(rw)
+			if authHeader == "" || !BearerEnabled() {
+				authenticateSession(rw, r, next, authHeader)
 				return
 			}
 			tokenParts := strings.Split(authHeader, " ")
@@ -57,17 +209,20 @@ func AuthMiddleware() mux.MiddlewareFunc {
 			}
 
 			tokenString := tokenParts[1]
-			claims := &models.Claims{}
 
-			token, err := jwt.ParseWithClaims(
-				tokenString,
-				claims,
-				func(token *jwt.Token) (interface{}, error) {
-					return []byte(secret), nil
-				},
-			)
+			if isAPIToken(tokenString) {
+				token, ok := authenticateAPIToken(rw, r, tokenString, scopes)
+				if !ok {
+					return
+				}
+				ctx := context.WithValue(r.Context(), "login", token.Login)
+				ctx = context.WithValue(ctx, "token_scopes", token.Scopes)
+				next.ServeHTTP(rw, r.WithContext(ctx))
+				return
+			}
 
-			if err != nil || !token.Valid {
+			claims, err := parseJWT(tokenString)
+			if err != nil || claims.Purpose != "" {
 				models.ResponseUnauthorized(rw)
 				return
 			}
@@ -77,9 +232,218 @@ func AuthMiddleware() mux.MiddlewareFunc {
 	}
 }
 
-// swagger:parameters createArticle updateArticle deleteArticle
+// OptionalAuthMiddleware определяет пользователя, если запрос содержит действующие
+// учётные данные, и пропускает анонимные запросы без ошибки. Персональные
+// токены подчиняются тем же правилам разрешений, что и в AuthMiddleware
+func OptionalAuthMiddleware(scopes ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if login, ok := identify(r, scopes); ok {
+				r = r.WithContext(context.WithValue(r.Context(), "login", login))
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+func identify(r *http.Request, scopes []string) (string, bool) {
+	login, ok := identifyCredentials(r, scopes)
+	if !ok {
+		return "", false
+	}
+	active, err := accountActive(r.Context(), login)
+	return login, err == nil && active
+}
+
+// requireActive пропускает запрос, только если учётная запись из контекста
+// существует и не заблокирована: JWT остаются действительными до истечения срока
+func requireActive(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		login, _ := r.Context().Value("login").(string)
+		account, err := dbwork.DB.GetAccount(r.Context(), login)
+		if err == dbwork.ErrNotFound {
+			models.ResponseUnauthorized(rw)
+			return
+		}
+		if err != nil {
+			models.ResponseErrorServer(rw)
+			return
+		}
+		if account.DisabledAt != nil {
+			models.ResponseNew(rw, ErrAccountDisabled.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// RequireRole пропускает запрос, только если у пользователя из контекста
+// есть роль role. Подключается после AuthMiddleware
+func RequireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			login, _ := r.Context().Value("login").(string)
+			account, err := dbwork.DB.GetAccount(r.Context(), login)
+			if err == dbwork.ErrNotFound {
+				models.ResponseUnauthorized(rw)
+				return
+			}
+			if err != nil {
+				models.ResponseErrorServer(rw)
+				return
+			}
+			if account.Role != role {
+				models.ResponseNew(rw, ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// accountActive проверяет, что учётная запись существует и не заблокирована
+func accountActive(ctx context.Context, login string) (bool, error) {
+	account, err := dbwork.DB.GetAccount(ctx, login)
+	if err == dbwork.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return account.DisabledAt == nil, nil
+}
+
+func identifyCredentials(r *http.Request, scopes []string) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader != "" && BearerEnabled() {
+		tokenString, found := strings.CutPrefix(authHeader, "Bearer ")
+		if !found {
+			return "", false
+		}
+
+		if isAPIToken(tokenString) {
+			token, err := dbwork.DB.GetAPITokenByHash(r.Context(), HashAPIToken(tokenString))
+			if err != nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+				return "", false
+			}
+			if tokenScopeError(token, scopes) != "" {
+				return "", false
+			}
+			touchAPIToken(r.Context(), token.ID)
+			return token.Login, true
+		}
+
+		claims, err := parseJWT(tokenString)
+		if err != nil || claims.Purpose != "" {
+			return "", false
+		}
+		return claims.Login, true
+	}
+
+	tokenString, ok := sessionToken(r)
+	if !ok {
+		return "", false
+	}
+	claims, err := parseJWT(tokenString)
+	if err != nil || claims.Purpose != "" {
+		return "", false
+	}
+	return claims.Login, true
+}
+
+// authenticateSession проверяет JWT из cookie и CSRF-токен
+func authenticateSession(rw http.ResponseWriter, r *http.Request, next http.Handler, authHeader string) {
+	tokenString, ok := sessionToken(r)
+	if !ok {
+		if authHeader == "" {
+			models.ResponseBadRequest(rw)
+		} else {
+			models.ResponseUnauthorized(rw)
+		}
+		return
+	}
+
+	claims, err := parseJWT(tokenString)
+	if err != nil || claims.Purpose != "" {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	if !ValidCSRF(r) {
+		models.ResponseNew(rw, "Неверный CSRF-токен", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), "login", claims.Login)
+	next.ServeHTTP(rw, r.WithContext(ctx))
+}
+
+func authenticateAPIToken(rw http.ResponseWriter, r *http.Request, tokenString string, scopes []string) (models.APIToken, bool) {
+	token, err := dbwork.DB.GetAPITokenByHash(r.Context(), HashAPIToken(tokenString))
+	if err == dbwork.ErrNotFound {
+		models.ResponseUnauthorized(rw)
+		return token, false
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return token, false
+	}
+
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		models.ResponseUnauthorized(rw)
+		return token, false
+	}
+
+	if message := tokenScopeError(token, scopes); message != "" {
+		models.ResponseNew(rw, message, http.StatusForbidden)
+		return token, false
+	}
+
+	touchAPIToken(r.Context(), token.ID)
+	return token, true
+}
+
+// tokenScopeError объясняет, почему токен не подходит маршруту с разрешениями
+// scopes, и возвращает пустую строку, если подходит. Маршруты без разрешений
+// персональные токены не принимают
+func tokenScopeError(token models.APIToken, scopes []string) string {
+	if len(scopes) == 0 {
+		return "Персональные токены не подходят для этого запроса"
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(token.Scopes, scope) {
+			return "У токена нет разрешения " + scope
+		}
+	}
+	return ""
+}
+
+// touchAPIToken ставит отметку об использовании токена в очередь записи,
+// только если этот процесс не отмечал его последние touchInterval: БД всё
+// равно обновляет её не чаще, а очередь нужна настоящим изменениям
+func touchAPIToken(ctx context.Context, id int) {
+	now := time.Now()
+
+	touchedTokensMu.Lock()
+	if last, ok := touchedTokens[id]; ok && now.Sub(last) < touchInterval {
+		touchedTokensMu.Unlock()
+		return
+	}
+	for tokenID, last := range touchedTokens {
+		if now.Sub(last) >= touchInterval {
+			delete(touchedTokens, tokenID)
+		}
+	}
+	touchedTokens[id] = now
+	touchedTokensMu.Unlock()
+
+	// Отметка об использовании не должна обрываться вместе с запросом
+	dbwork.DB.TouchAPIToken(context.WithoutCancel(ctx), id, make(chan error, 1))
+}
+
+// swagger:parameters createArticle updateArticle deleteArticle setupTOTP confirmTOTP disableTOTP createAPIToken getAPITokens deleteAPIToken setReaction deleteReaction follow unfollow getFeed setBookmark deleteBookmark getBookmarks uploadMedia deleteMedia getUserMedia
 type AuthHeader struct {
-	// Bearer токен
+	// Bearer токен: JWT или персональный токен с нужным разрешением
 	// in: header
 	// required: true
 	Authorization string
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func challengeClaims(login string) *models.Claims {
+	return &models.Claims{
+		Login:   login,
+		Purpose: PurposeTwoFactor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(challengeExpiration)),
+		},
+	}
+}
+
+func TestVerifyChallengeLimitsParallelAttempts(t *testing.T) {
+	claims := challengeClaims("parallel")
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	wait := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			VerifyChallenge(claims, func() (bool, error) {
+				calls.Add(1)
+				<-release
+				return false, nil
+			})
+		}()
+	}
+	// Проверки держатся, пока не закончатся все резервирования
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wait.Wait()
+
+	if got := calls.Load(); got != challengeMaxAttempts {
+		t.Fatalf("codes checked %d times, want %d", got, challengeMaxAttempts)
+	}
+}
+
+func TestVerifyChallengeLocksAccount(t *testing.T) {
+	failed := func() (bool, error) { return false, nil }
+
+	var err error
+	for attempt := 0; attempt < accountMaxFailures; attempt++ {
+		// Каждая попытка идёт с нового входа паролем
+		if _, err = VerifyChallenge(challengeClaims("locked"), failed); err != nil {
+			t.Fatalf("attempt %d rejected early: %v", attempt, err)
+		}
+	}
+
+	_, err = VerifyChallenge(challengeClaims("locked"), func() (bool, error) { return true, nil })
+	if err != ErrAccountLocked {
+		t.Fatalf("error %v, want ErrAccountLocked", err)
+	}
+	if _, err := VerifyChallenge(challengeClaims("other"), failed); err != nil {
+		t.Fatalf("other account locked too: %v", err)
+	}
+}
+
+func TestVerifyChallengeSuccessResetsAccount(t *testing.T) {
+	for attempt := 0; attempt < accountMaxFailures-1; attempt++ {
+		VerifyChallenge(challengeClaims("reset"), func() (bool, error) { return false, nil })
+	}
+
+	claims := challengeClaims("reset")
+	if verified, err := VerifyChallenge(claims, func() (bool, error) { return true, nil }); !verified || err != nil {
+		t.Fatalf("VerifyChallenge = %v, %v", verified, err)
+	}
+	// Использованный токен больше не принимается
+	if _, err := VerifyChallenge(claims, func() (bool, error) { return true, nil }); err != ErrChallengeExhausted {
+		t.Fatalf("reused challenge: %v", err)
+	}
+	if _, err := VerifyChallenge(challengeClaims("reset"), func() (bool, error) { return false, nil }); err != nil {
+		t.Fatalf("account still locked after success: %v", err)
+	}
+}
+
+// touchDB считает отметки об использовании токенов
+type touchDB struct {
+	dbwork.DataBase
+	touches int
+}
+
+func (db *touchDB) TouchAPIToken(ctx context.Context, id int, ch chan error) {
+	db.touches++
+	ch <- nil
+	close(ch)
+}
+
+func TestTouchAPITokenThrottled(t *testing.T) {
+	db := &touchDB{}
+	dbwork.DB = db
+
+	for i := 0; i < 3; i++ {
+		touchAPIToken(context.Background(), 1)
+	}
+	touchAPIToken(context.Background(), 2)
+	if db.touches != 2 {
+		t.Fatalf("%d touches, want one per token", db.touches)
+	}
+
+	touchedTokensMu.Lock()
+	touchedTokens[1] = time.Now().Add(-touchInterval)
+	touchedTokensMu.Unlock()
+	touchAPIToken(context.Background(), 1)
+	if db.touches != 3 {
+		t.Fatalf("%d touches, want a new one after the interval", db.touches)
+	}
+}
+
+// tokenDB знает один персональный токен с разрешением articles:write
+type tokenDB struct {
+	touchDB
+	token models.APIToken
+}
+
+func (db *tokenDB) GetAPITokenByHash(ctx context.Context, tokenHash string) (models.APIToken, error) {
+	if tokenHash != HashAPIToken("blog_pat_test") {
+		return models.APIToken{}, dbwork.ErrNotFound
+	}
+	return db.token, nil
+}
+
+func (db *tokenDB) GetAccount(ctx context.Context, login string) (models.Account, error) {
+	return models.Account{Login: login, Role: models.RoleUser}, nil
+}
+
+func TestOptionalAuthChecksTokenScopes(t *testing.T) {
+	if err := InitializationSession(SessionConfig{Mode: ModeBearer}); err != nil {
+		t.Fatal(err)
+	}
+	db := &tokenDB{token: models.APIToken{ID: 7, Login: "writer", Scopes: []string{ScopeArticlesWrite}}}
+	dbwork.DB = db
+
+	for _, test := range []struct {
+		name   string
+		scopes []string
+		login  string
+	}{
+		{"route without scopes", nil, ""},
+		{"missing scope", []string{"articles:read"}, ""},
+		{"granted scope", []string{ScopeArticlesWrite}, "writer"},
+	} {
+		login := ""
+		handler := OptionalAuthMiddleware(test.scopes...)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			login, _ = r.Context().Value("login").(string)
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer blog_pat_test")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if login != test.login {
+			t.Errorf("%s: login %q, want %q", test.name, login, test.login)
+		}
+	}
+	if db.touches != 1 {
+		t.Errorf("%d touches, want one for the accepted token", db.touches)
+	}
+}
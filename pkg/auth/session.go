@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Способы передачи сессии
+const (
+	ModeBearer = "bearer"
+	ModeCookie = "cookie"
+	ModeBoth   = "both"
+
+	CSRFHeader = "X-CSRF-Token"
+	// Поле HTML-формы, в котором страницы сервера передают CSRF-токен
+	CSRFFormField = "csrf_token"
+)
+
+// Параметры cookie-сессий
+type SessionConfig struct {
+	Mode           string
+	CookieName     string
+	CSRFCookieName string
+	Secure         bool
+	SameSite       http.SameSite
+}
+
+var session = SessionConfig{
+	Mode:           ModeBearer,
+	CookieName:     "blog_session",
+	CSRFCookieName: "blog_csrf",
+	SameSite:       http.SameSiteLaxMode,
+}
+
+func InitializationSession(config SessionConfig) error {
+	switch config.Mode {
+	case ModeBearer, ModeCookie, ModeBoth:
+	default:
+		return fmt.Errorf("Неизвестный режим аутентификации: %s", config.Mode)
+	}
+	if config.CookieName == "" {
+		config.CookieName = session.CookieName
+	}
+	if config.CSRFCookieName == "" {
+		config.CSRFCookieName = session.CSRFCookieName
+	}
+	if config.SameSite == 0 {
+		config.SameSite = session.SameSite
+	}
+	session = config
+	return nil
+}
+
+func BearerEnabled() bool {
+	return session.Mode == ModeBearer || session.Mode == ModeBoth
+}
+
+func CookieEnabled() bool {
+	return session.Mode == ModeCookie || session.Mode == ModeBoth
+}
+
+// SetSession кладёт JWT в HttpOnly cookie и выдаёт CSRF-токен для схемы double-submit.
+// Возвращает значение CSRF-токена
+func SetSession(rw http.ResponseWriter, token string) (string, error) {
+	csrf, err := newCSRF()
+	if err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(expiration)
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     session.CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   session.Secure,
+		SameSite: session.SameSite,
+	})
+	// CSRF-cookie должна быть доступна скрипту, чтобы он мог продублировать её в заголовке
+	http.SetCookie(rw, &http.Cookie{
+		Name:     session.CSRFCookieName,
+		Value:    csrf,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   session.Secure,
+		SameSite: session.SameSite,
+	})
+	return csrf, nil
+}
+
+// CSRFToken возвращает CSRF-токен из cookie для вставки в HTML-форму.
+// Гостю, например на странице входа, выдаётся новый токен до конца сеанса браузера
+func CSRFToken(rw http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(session.CSRFCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	csrf, err := newCSRF()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(rw, &http.Cookie{
+		Name:     session.CSRFCookieName,
+		Value:    csrf,
+		Path:     "/",
+		Secure:   session.Secure,
+		SameSite: session.SameSite,
+	})
+	return csrf, nil
+}
+
+func newCSRF() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func ClearSession(rw http.ResponseWriter) {
+	for _, name := range []string{session.CookieName, session.CSRFCookieName} {
+		http.SetCookie(rw, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			Expires:  time.Unix(0, 0),
+			Secure:   session.Secure,
+			SameSite: session.SameSite,
+		})
+	}
+}
+
+// sessionToken возвращает JWT из cookie, если cookie-режим включён
+func sessionToken(r *http.Request) (string, bool) {
+	if !CookieEnabled() {
+		return "", false
+	}
+	cookie, err := r.Cookie(session.CookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// ValidCSRF сверяет заголовок с cookie для методов, изменяющих состояние.
+// HTML-формы, которые не могут выставить заголовок, передают токен в поле формы
+func ValidCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := r.Cookie(session.CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	token := r.Header.Get(CSRFHeader)
+	if token == "" {
+		token = r.PostFormValue(CSRFFormField)
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) == 1
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidCSRF(t *testing.T) {
+	const token = "csrf-token"
+	form := url.Values{CSRFFormField: {token}}.Encode()
+
+	for _, test := range []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		form   string
+		valid  bool
+	}{
+		{"safe method without token", http.MethodGet, "", "", "", true},
+		{"head without token", http.MethodHead, "", "", "", true},
+		{"options without token", http.MethodOptions, "", "", "", true},
+		{"matching header", http.MethodPost, token, token, "", true},
+		{"matching form field", http.MethodPost, token, "", form, true},
+		{"header wins over form", http.MethodPost, token, "other", form, false},
+		{"mismatched header", http.MethodDelete, token, "other", "", false},
+		{"header without cookie", http.MethodPut, "", token, "", false},
+		{"cookie without header", http.MethodPatch, token, "", "", false},
+		{"empty cookie and header", http.MethodPost, "", "", "", false},
+	} {
+		r := httptest.NewRequest(test.method, "/", strings.NewReader(test.form))
+		if test.form != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if test.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: session.CSRFCookieName, Value: test.cookie})
+		}
+		if test.header != "" {
+			r.Header.Set(CSRFHeader, test.header)
+		}
+		if valid := ValidCSRF(r); valid != test.valid {
+			t.Errorf("%s: ValidCSRF = %v, want %v", test.name, valid, test.valid)
+		}
+	}
+}
+
+func TestSetSessionCookies(t *testing.T) {
+	rw := httptest.NewRecorder()
+	csrf, err := SetSession(rw, "jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range rw.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	sessionCookie, csrfCookie := cookies[session.CookieName], cookies[session.CSRFCookieName]
+	if sessionCookie == nil || sessionCookie.Value != "jwt" || !sessionCookie.HttpOnly {
+		t.Errorf("session cookie %+v", sessionCookie)
+	}
+	// Скрипт читает CSRF-cookie, чтобы продублировать её в заголовке
+	if csrfCookie == nil || csrfCookie.Value != csrf || csrfCookie.HttpOnly {
+		t.Errorf("csrf cookie %+v", csrfCookie)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.AddCookie(csrfCookie)
+	r.Header.Set(CSRFHeader, csrf)
+	if !ValidCSRF(r) {
+		t.Error("issued token rejected")
+	}
+}
+
+func TestCSRFTokenReusesCookie(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: session.CSRFCookieName, Value: "existing"})
+	rw := httptest.NewRecorder()
+	if token, err := CSRFToken(rw, r); err != nil || token != "existing" {
+		t.Fatalf("CSRFToken = %q, %v", token, err)
+	}
+	if len(rw.Result().Cookies()) != 0 {
+		t.Error("existing token replaced")
+	}
+
+	rw = httptest.NewRecorder()
+	token, err := CSRFToken(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil || token == "" {
+		t.Fatalf("CSRFToken for a guest = %q, %v", token, err)
+	}
+	if cookies := rw.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != token {
+		t.Errorf("guest cookies %v", cookies)
+	}
+}
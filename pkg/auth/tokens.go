@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// Префикс позволяет отличить персональный токен от JWT без разбора
+const TokenPrefix = "blog_pat_"
+
+// Разрешения персональных токенов
+const (
+	ScopeArticlesWrite = "articles:write"
+)
+
+var Scopes = []string{
+	ScopeArticlesWrite,
+}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// GenerateAPIToken возвращает новый токен и его хеш для хранения в БД
+func GenerateAPIToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := TokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashAPIToken(token), nil
+}
+
+// Токены имеют высокую энтропию, поэтому для хранения достаточно SHA-256
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, TokenPrefix)
+}
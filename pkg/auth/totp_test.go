@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTPVectors(t *testing.T) {
+	// Тестовые значения из приложения D RFC 4226
+	key := []byte("12345678901234567890")
+	for counter, want := range []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	} {
+		if got := hotp(key, int64(counter)); got != want {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32NoPad.EncodeToString([]byte("12345678901234567890"))
+	key := []byte("12345678901234567890")
+	current := time.Now().Unix() / totpPeriod
+
+	for _, test := range []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		step     int64
+		ok       bool
+	}{
+		{"current step", secret, hotp(key, current), 0, current, true},
+		{"previous step", secret, hotp(key, current-1), 0, current - 1, true},
+		{"next step", secret, hotp(key, current+1), 0, current + 1, true},
+		{"outside the skew", secret, hotp(key, current-2), 0, 0, false},
+		{"lowercase secret", strings.ToLower(secret), hotp(key, current), 0, current, true},
+		// Код, совпавший на уже использованном шаге, повторно не принимается
+		{"replayed step", secret, hotp(key, current), current, 0, false},
+		{"replayed earlier step", secret, hotp(key, current-1), current - 1, 0, false},
+		{"short code", secret, hotp(key, current)[:5], 0, 0, false},
+		{"invalid secret", "not base32!", hotp(key, current), 0, 0, false},
+	} {
+		step, ok := ValidateTOTP(test.secret, test.code, test.lastStep)
+		// Шаг мог смениться во время теста, тогда соседний код тоже верен
+		if ok != test.ok || (ok && step != test.step && step != test.step+1) {
+			t.Errorf("%s: ValidateTOTP = %d, %v, want %d, %v", test.name, step, ok, test.step, test.ok)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32NoPad.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	InitializationTOTP("My Blog")
+	defer InitializationTOTP("Blog")
+
+	uri := TOTPURI("alice", "SECRET")
+	want := "otpauth://totp/My%20Blog:alice?algorithm=SHA1&digits=6&issuer=My+Blog&period=30&secret=SECRET"
+	if uri != want {
+		t.Fatalf("TOTPURI = %s, want %s", uri, want)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodesCount {
+		t.Fatalf("%d codes, want %d", len(codes), recoveryCodesCount)
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q has unexpected format", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q repeated", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("abcde-fghij")
+	for _, code := range []string{"abcdefghij", "ABCDE-FGHIJ", "  abcde-fghij\n", "ab-cde-fg-hij"} {
+		if got := HashRecoveryCode(code); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from the canonical form", code)
+		}
+	}
+	if HashRecoveryCode("abcde-fghik") == want {
+		t.Error("different codes share a hash")
+	}
+}
@@ -0,0 +1,390 @@
+package backup
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"blog/pkg/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// blogDB хранит данные блога в памяти и применяет выгрузку по тем же
+// правилам, что и запрос к БД: пользователи сопоставляются по логину,
+// статьи по uid, остальные записи не дублируются
+type blogDB struct {
+	dbwork.DataBase
+	nextID    int
+	users     []models.BackupUserData
+	articles  []models.BackupArticleData
+	reactions []models.BackupReactionData
+	bookmarks []models.BackupBookmarkData
+	follows   []models.BackupFollowData
+	media     []models.BackupMediaData
+	batches   int
+}
+
+func (db *blogDB) ExportContent(ctx context.Context, withPasswords bool, emit func(models.BackupRecord) error) error {
+	records := make([]models.BackupRecord, 0)
+	for _, user := range db.users {
+		if !withPasswords {
+			user.PasswordHash = ""
+		}
+		records = append(records, models.BackupRecord{Type: models.BackupUser, User: &user})
+	}
+	for _, article := range db.articles {
+		records = append(records, models.BackupRecord{Type: models.BackupArticle, Article: &article})
+	}
+	for _, reaction := range db.reactions {
+		records = append(records, models.BackupRecord{Type: models.BackupReaction, Reaction: &reaction})
+	}
+	for _, bookmark := range db.bookmarks {
+		records = append(records, models.BackupRecord{Type: models.BackupBookmark, Bookmark: &bookmark})
+	}
+	for _, follow := range db.follows {
+		records = append(records, models.BackupRecord{Type: models.BackupFollow, Follow: &follow})
+	}
+	for _, file := range db.media {
+		records = append(records, models.BackupRecord{Type: models.BackupMedia, Media: &file})
+	}
+
+	for _, record := range records {
+		if err := emit(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *blogDB) ImportBatch(ctx context.Context, batch *models.ImportBatch, ch chan error) {
+	db.batches++
+	for _, record := range batch.Records {
+		applied, err := db.importRecord(batch.ArticleIDs, record)
+		if err != nil {
+			ch <- err
+			close(ch)
+			return
+		}
+		if applied {
+			batch.Applied[record.Type]++
+		}
+	}
+	ch <- nil
+	close(ch)
+}
+
+func (db *blogDB) importRecord(articleIDs map[int]int, record models.BackupRecord) (bool, error) {
+	switch {
+	case record.User != nil:
+		for i, user := range db.users {
+			if user.Login == record.User.Login {
+				changed := *record.User
+				if changed.PasswordHash == "" {
+					changed.PasswordHash = user.PasswordHash
+				}
+				db.users[i] = changed
+				return fmt.Sprint(user) != fmt.Sprint(changed), nil
+			}
+		}
+		db.users = append(db.users, *record.User)
+		return true, nil
+
+	case record.Article != nil:
+		source := *record.Article
+		for i, article := range db.articles {
+			if article.UID == source.UID {
+				articleIDs[source.ID] = article.ID
+				if article.Text == source.Text {
+					return false, nil
+				}
+				db.articles[i].Text, db.articles[i].Revision = source.Text, article.Revision+1
+				return true, nil
+			}
+		}
+		db.nextID++
+		articleIDs[source.ID] = db.nextID
+		source.ID = db.nextID
+		db.articles = append(db.articles, source)
+		return true, nil
+
+	case record.Reaction != nil:
+		reaction := *record.Reaction
+		id, ok := articleIDs[reaction.ArticleID]
+		if !ok {
+			return false, fmt.Errorf("статья %d отсутствует в выгрузке", reaction.ArticleID)
+		}
+		reaction.ArticleID = id
+		for _, existing := range db.reactions {
+			if existing.ArticleID == id && existing.Login == reaction.Login && existing.Kind == reaction.Kind {
+				return false, nil
+			}
+		}
+		db.reactions = append(db.reactions, reaction)
+		return true, nil
+
+	case record.Bookmark != nil:
+		bookmark := *record.Bookmark
+		id, ok := articleIDs[bookmark.ArticleID]
+		if !ok {
+			return false, fmt.Errorf("статья %d отсутствует в выгрузке", bookmark.ArticleID)
+		}
+		bookmark.ArticleID = id
+		for _, existing := range db.bookmarks {
+			if existing.ArticleID == id && existing.Login == bookmark.Login {
+				return false, nil
+			}
+		}
+		db.bookmarks = append(db.bookmarks, bookmark)
+		return true, nil
+
+	case record.Follow != nil:
+		for _, existing := range db.follows {
+			if existing.Follower == record.Follow.Follower && existing.Followee == record.Follow.Followee {
+				return false, nil
+			}
+		}
+		db.follows = append(db.follows, *record.Follow)
+		return true, nil
+
+	case record.Media != nil:
+		for _, existing := range db.media {
+			if existing.ID == record.Media.ID {
+				return false, nil
+			}
+		}
+		db.media = append(db.media, *record.Media)
+		return true, nil
+	}
+	return false, nil
+}
+
+// sourceBlog возвращает блог, идентификаторы статей которого не совпадают
+// с идентификаторами, которые статьи получат при импорте
+func sourceBlog(articles int) *blogDB {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := &blogDB{
+		users: []models.BackupUserData{
+			{Login: "alice", Role: models.RoleAdmin, PasswordHash: "$argon2id$hash"},
+			{Login: "bob", Role: models.RoleUser},
+		},
+		follows: []models.BackupFollowData{{Follower: "bob", Followee: "alice", CreatedAt: created}},
+	}
+	for i := 0; i < articles; i++ {
+		db.articles = append(db.articles, models.BackupArticleData{
+			ID:        1000 + i*3,
+			UID:       uuid.NewString(),
+			Author:    "alice",
+			Text:      fmt.Sprintf("article %d", i),
+			Revision:  2,
+			CreatedAt: created,
+			UpdatedAt: created,
+		})
+	}
+	last := db.articles[len(db.articles)-1].ID
+	db.reactions = []models.BackupReactionData{{ArticleID: last, Login: "bob", Kind: models.ReactionLike, CreatedAt: created}}
+	db.bookmarks = []models.BackupBookmarkData{{ArticleID: 1000, Login: "bob", CreatedAt: created}}
+	return db
+}
+
+func exportImport(t *testing.T, source, target *blogDB, options Options) map[string]int {
+	t.Helper()
+	dbwork.DB = source
+	buffer := bytes.Buffer{}
+	if err := Export(context.Background(), &buffer, options); err != nil {
+		t.Fatal(err)
+	}
+
+	dbwork.DB = target
+	applied, err := Import(context.Background(), &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return applied
+}
+
+func TestExportImportIdempotent(t *testing.T) {
+	// Статей больше, чем помещается в пачку: реакция ссылается на статью
+	// из второй пачки, закладка — на статью из первой
+	source := sourceBlog(batchSize + 10)
+	target := &blogDB{nextID: 7}
+
+	for _, test := range []struct {
+		name    string
+		applied map[string]int
+	}{
+		{"first import", map[string]int{
+			models.BackupUser:     2,
+			models.BackupArticle:  batchSize + 10,
+			models.BackupReaction: 1,
+			models.BackupBookmark: 1,
+			models.BackupFollow:   1,
+		}},
+		{"repeated import", map[string]int{}},
+	} {
+		applied := exportImport(t, source, target, Options{Format: FormatJSONL, Passwords: true})
+		if !maps.Equal(applied, test.applied) {
+			t.Errorf("%s: applied %v, want %v", test.name, applied, test.applied)
+		}
+	}
+
+	if target.batches < 2 {
+		t.Errorf("import used %d batches, want several", target.batches)
+	}
+	if len(target.articles) != len(source.articles) || len(target.reactions) != 1 || len(target.bookmarks) != 1 {
+		t.Fatalf("target has %d articles, %d reactions, %d bookmarks",
+			len(target.articles), len(target.reactions), len(target.bookmarks))
+	}
+	// Реакции и закладки указывают на новые идентификаторы тех же статей
+	if got := target.articles[len(target.articles)-1]; target.reactions[0].ArticleID != got.ID || got.ID != 8+batchSize+9 {
+		t.Errorf("reaction points to %d, last article imported as %d", target.reactions[0].ArticleID, got.ID)
+	}
+	if target.bookmarks[0].ArticleID != 8 || target.articles[0].UID != source.articles[0].UID {
+		t.Errorf("bookmark points to %d, want 8", target.bookmarks[0].ArticleID)
+	}
+	if target.users[0].PasswordHash != "$argon2id$hash" {
+		t.Error("password hash lost")
+	}
+}
+
+func TestImportUpdatesChangedArticle(t *testing.T) {
+	source := sourceBlog(2)
+	target := &blogDB{}
+	exportImport(t, source, target, Options{})
+
+	source.articles[1].Text = "edited"
+	applied := exportImport(t, source, target, Options{})
+	if !maps.Equal(applied, map[string]int{models.BackupArticle: 1}) {
+		t.Fatalf("applied %v, want one article", applied)
+	}
+	if article := target.articles[1]; article.Text != "edited" || article.Revision != 3 {
+		t.Errorf("article %q at revision %d", article.Text, article.Revision)
+	}
+}
+
+func TestExportWithoutPasswordsKeepsHashes(t *testing.T) {
+	source := sourceBlog(1)
+	target := &blogDB{users: []models.BackupUserData{{Login: "alice", Role: models.RoleAdmin, PasswordHash: "$2b$local"}}}
+
+	applied := exportImport(t, source, target, Options{})
+	if applied[models.BackupUser] != 1 {
+		t.Errorf("applied %d users, want only the new one", applied[models.BackupUser])
+	}
+	if target.users[0].PasswordHash != "$2b$local" {
+		t.Errorf("existing hash replaced with %q", target.users[0].PasswordHash)
+	}
+}
+
+func TestExportImportTarWithMedia(t *testing.T) {
+	sourceStore, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetStore, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(store storage.Storage) { storage.Store = store }(storage.Store)
+
+	id := uuid.NewString()
+	source := sourceBlog(1)
+	source.media = []models.BackupMediaData{{
+		ID:            id,
+		Owner:         "alice",
+		StorageKey:    "originals/" + id,
+		ThumbnailKey:  "thumbnails/" + id,
+		ThumbnailType: "image/png",
+		ContentType:   "image/jpeg",
+		Size:          8,
+		CreatedAt:     time.Now(),
+	}}
+	ctx := context.Background()
+	sourceStore.Put(ctx, "originals/"+id, strings.NewReader("original"), 8, "image/jpeg")
+	sourceStore.Put(ctx, "thumbnails/"+id, strings.NewReader("thumb"), 5, "image/png")
+
+	storage.Store = sourceStore
+	dbwork.DB = source
+	archive := bytes.Buffer{}
+	if err := Export(ctx, &archive, Options{Format: FormatTar}); err != nil {
+		t.Fatal(err)
+	}
+
+	storage.Store = targetStore
+	target := &blogDB{}
+	dbwork.DB = target
+	applied, err := Import(ctx, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied[models.BackupMedia] != 1 || len(target.media) != 1 {
+		t.Fatalf("applied %v", applied)
+	}
+	for key, want := range map[string]string{"originals/" + id: "original", "thumbnails/" + id: "thumb"} {
+		body, err := targetStore.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", key, data, want)
+		}
+	}
+}
+
+func TestImportRejectsInvalidInput(t *testing.T) {
+	dbwork.DB = &blogDB{}
+	header := `{"type":"header","header":{"version":1}}` + "\n"
+	article := `{"type":"article","article":{"id":1,"uid":"` + uuid.NewString() + `","author":"alice","text":"x"}}` + "\n"
+
+	for _, test := range []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"no header", article},
+		{"future version", `{"type":"header","header":{"version":99}}` + "\n"},
+		{"unknown type", header + `{"type":"comment"}` + "\n"},
+		{"article without uid", header + `{"type":"article","article":{"id":1,"author":"alice"}}` + "\n"},
+		{"unknown role", header + `{"type":"user","user":{"login":"alice","role":"root"}}` + "\n"},
+		{"unknown reaction", header + `{"type":"reaction","reaction":{"article_id":1,"login":"bob","kind":"angry"}}` + "\n"},
+		{"media outside storage", header + `{"type":"media","media":{"id":"` + uuid.NewString() + `","owner":"alice","storage_key":"../etc/passwd"}}` + "\n"},
+		{"broken json", header + `{"type":` + "\n"},
+	} {
+		if _, err := Import(context.Background(), strings.NewReader(test.input)); !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("%s: Import = %v, want ErrInvalidFormat", test.name, err)
+		}
+	}
+}
+
+func TestNormalizeDefaults(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	record, err := normalize(models.BackupRecord{
+		Type:    models.BackupArticle,
+		Article: &models.BackupArticleData{UID: uuid.NewString(), Author: "alice"},
+		User:    &models.BackupUserData{Login: "ignored"},
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	article := record.Article
+	if article.Revision != 1 || !article.CreatedAt.Equal(now) || !article.UpdatedAt.Equal(now) {
+		t.Errorf("article defaults %+v", article)
+	}
+	// Поля других типов отбрасываются
+	if record.User != nil {
+		t.Error("user data kept in an article record")
+	}
+
+	record, err = normalize(models.BackupRecord{Type: models.BackupUser, User: &models.BackupUserData{Login: "bob"}}, now)
+	if err != nil || record.User.Role != models.RoleUser {
+		t.Errorf("user role %q, %v", record.User.Role, err)
+	}
+}
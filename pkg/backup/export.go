@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"archive/tar"
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"blog/pkg/storage"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatTar   = "tar"
+)
+
+// Имена файлов внутри tar-архива
+const (
+	contentName = "content.jsonl"
+	mediaPrefix = "media/"
+	// Расширенный заголовок tar с типом содержимого файла
+	contentTypeRecord = "BLOG.content_type"
+)
+
+// Параметры выгрузки
+type Options struct {
+	Format string
+	// Выгружать хеши паролей. Без них импортированные пользователи
+	// не смогут войти, пока им не зададут пароль
+	Passwords bool
+}
+
+// ContentType возвращает MIME-тип выгрузки в заданном формате
+func ContentType(format string) string {
+	if format == FormatTar {
+		return "application/x-tar"
+	}
+	return "application/x-ndjson"
+}
+
+// Export пишет в w все данные блога. JSON Lines содержит только записи БД,
+// tar-архив дополнительно содержит загруженные файлы
+func Export(ctx context.Context, w io.Writer, options Options) error {
+	switch options.Format {
+	case FormatJSONL, "":
+		return exportJSONL(ctx, w, options.Passwords, nil)
+	case FormatTar:
+		return exportTar(ctx, w, options.Passwords)
+	}
+	return fmt.Errorf("%w: неизвестный формат %s", ErrInvalidFormat, options.Format)
+}
+
+// exportJSONL пишет заголовок и записи БД. Если задан media, ему
+// передаётся каждая запись о файле
+func exportJSONL(ctx context.Context, w io.Writer, withPasswords bool, media func(models.BackupMediaData)) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	header := models.BackupRecord{
+		Type: models.BackupHeader,
+		Header: &models.BackupHeaderData{
+			Version:   models.BackupVersion,
+			CreatedAt: time.Now().UTC(),
+			Passwords: withPasswords,
+		},
+	}
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+
+	return dbwork.DB.ExportContent(ctx, withPasswords, func(record models.BackupRecord) error {
+		if record.Media != nil && media != nil {
+			media(*record.Media)
+		}
+		return encoder.Encode(record)
+	})
+}
+
+// exportTar сначала пишет записи во временный файл: размер записи tar
+// должен быть известен заранее. Файлы идут перед content.jsonl, чтобы при
+// импорте они оказались в хранилище раньше, чем записи о них в БД
+func exportTar(ctx context.Context, w io.Writer, withPasswords bool) error {
+	content, err := os.CreateTemp("", "blog-export-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(content.Name())
+	defer content.Close()
+
+	files := make([]models.BackupMediaData, 0)
+	err = exportJSONL(ctx, content, withPasswords, func(file models.BackupMediaData) {
+		files = append(files, file)
+	})
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewWriter(w)
+	for _, file := range files {
+		if err := writeStored(ctx, archive, file.StorageKey, file.ContentType, file.Size); err != nil {
+			return err
+		}
+		if err := writeStored(ctx, archive, file.ThumbnailKey, file.ThumbnailType, -1); err != nil {
+			return err
+		}
+	}
+
+	size, err := content.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	err = archive.WriteHeader(&tar.Header{
+		Name:    contentName,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: time.Now(),
+		Format:  tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(archive, content); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// writeStored добавляет в архив файл из хранилища. Размер миниатюр не
+// хранится в БД, поэтому при size < 0 файл сначала читается в память.
+// Отсутствующие в хранилище файлы пропускаются
+func writeStored(ctx context.Context, archive *tar.Writer, key, contentType string, size int64) error {
+	body, err := storage.Store.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		slog.Warn("Файл отсутствует в хранилище", "key", key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var reader io.Reader = body
+	if size < 0 {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		reader, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	err = archive.WriteHeader(&tar.Header{
+		Name:       mediaPrefix + key,
+		Mode:       0o644,
+		Size:       size,
+		ModTime:    time.Now(),
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{contentTypeRecord: contentType},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(archive, reader, size)
+	return err
+}
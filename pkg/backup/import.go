@@ -0,0 +1,268 @@
+package backup
+
+import (
+	"archive/tar"
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"blog/pkg/storage"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Сколько записей применяется в одной транзакции
+const batchSize = 500
+
+var ErrInvalidFormat = errors.New("Неверный формат выгрузки")
+
+// Import загружает выгрузку в формате JSON Lines или tar, формат
+// определяется по содержимому. Возвращает число применённых записей
+// каждого типа; записи, которые уже есть в БД, не учитываются
+func Import(ctx context.Context, r io.Reader) (map[string]int, error) {
+	reader := bufio.NewReader(r)
+	importer := NewImporter(ctx)
+
+	var err error
+	if isTar(reader) {
+		err = importTar(ctx, tar.NewReader(reader), importer)
+	} else {
+		err = importJSONL(reader, importer)
+	}
+	return importer.Applied(), err
+}
+
+// isTar проверяет сигнатуру ustar в первом заголовке архива
+func isTar(reader *bufio.Reader) bool {
+	magic, _ := reader.Peek(262)
+	return len(magic) == 262 && string(magic[257:]) == "ustar"
+}
+
+func importTar(ctx context.Context, archive *tar.Reader, importer *Importer) error {
+	content := false
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		}
+
+		switch {
+		case header.Typeflag == tar.TypeDir:
+		case header.Name == contentName:
+			if err := importJSONL(archive, importer); err != nil {
+				return err
+			}
+			content = true
+		case strings.HasPrefix(header.Name, mediaPrefix):
+			key := strings.TrimPrefix(header.Name, mediaPrefix)
+			if !validMediaKey(key) {
+				return fmt.Errorf("%w: недопустимое имя файла %s", ErrInvalidFormat, header.Name)
+			}
+			contentType := header.PAXRecords[contentTypeRecord]
+			if err := storage.Store.Put(ctx, key, archive, header.Size, contentType); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: неизвестный файл %s", ErrInvalidFormat, header.Name)
+		}
+	}
+
+	if !content {
+		return fmt.Errorf("%w: в архиве нет %s", ErrInvalidFormat, contentName)
+	}
+	return nil
+}
+
+// importJSONL читает заголовок и записи по одной, не загружая выгрузку целиком
+func importJSONL(r io.Reader, importer *Importer) error {
+	decoder := json.NewDecoder(r)
+
+	var header models.BackupRecord
+	if err := decoder.Decode(&header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+	}
+	if header.Type != models.BackupHeader || header.Header == nil {
+		return fmt.Errorf("%w: первая запись должна быть заголовком", ErrInvalidFormat)
+	}
+	if version := header.Header.Version; version < 1 || version > models.BackupVersion {
+		return fmt.Errorf("%w: неподдерживаемая версия %d", ErrInvalidFormat, version)
+	}
+
+	for line := 2; ; line++ {
+		var record models.BackupRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: запись %d: %v", ErrInvalidFormat, line, err)
+		}
+		if err := importer.Add(record); err != nil {
+			return fmt.Errorf("запись %d: %w", line, err)
+		}
+	}
+	return importer.Flush()
+}
+
+// Importer проверяет записи и применяет их пачками. Соответствие
+// идентификаторов статей сохраняется между пачками, поэтому реакции
+// и закладки могут ссылаться на статьи из предыдущих пачек
+type Importer struct {
+	ctx   context.Context
+	batch models.ImportBatch
+}
+
+func NewImporter(ctx context.Context) *Importer {
+	return &Importer{
+		ctx: ctx,
+		batch: models.ImportBatch{
+			Records:    make([]models.BackupRecord, 0, batchSize),
+			ArticleIDs: make(map[int]int),
+			Applied:    make(map[string]int),
+		},
+	}
+}
+
+// Add добавляет запись в текущую пачку и применяет пачку, когда она заполнится
+func (importer *Importer) Add(record models.BackupRecord) error {
+	record, err := normalize(record, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	importer.batch.Records = append(importer.batch.Records, record)
+	if len(importer.batch.Records) >= batchSize {
+		return importer.Flush()
+	}
+	return nil
+}
+
+// Flush применяет накопленные записи
+func (importer *Importer) Flush() error {
+	if len(importer.batch.Records) == 0 {
+		return nil
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.ImportBatch(importer.ctx, &importer.batch, ch)
+	err := <-ch
+	importer.batch.Records = importer.batch.Records[:0]
+	return err
+}
+
+// Applied возвращает число применённых записей каждого типа
+func (importer *Importer) Applied() map[string]int {
+	return maps.Clone(importer.batch.Applied)
+}
+
+// normalize проверяет запись и заполняет необязательные поля.
+// В результате заполнено только поле, соответствующее типу
+func normalize(record models.BackupRecord, now time.Time) (models.BackupRecord, error) {
+	switch record.Type {
+	case models.BackupUser:
+		user := record.User
+		if user == nil || user.Login == "" {
+			return record, fmt.Errorf("%w: у пользователя нет логина", ErrInvalidFormat)
+		}
+		if user.Role == "" {
+			user.Role = models.RoleUser
+		}
+		if !slices.Contains(models.Roles, user.Role) {
+			return record, fmt.Errorf("%w: неизвестная роль %s", ErrInvalidFormat, user.Role)
+		}
+		return models.BackupRecord{Type: record.Type, User: user}, nil
+
+	case models.BackupArticle:
+		article := record.Article
+		if article == nil || article.Author == "" {
+			return record, fmt.Errorf("%w: у статьи нет автора", ErrInvalidFormat)
+		}
+		if _, err := uuid.Parse(article.UID); err != nil {
+			return record, fmt.Errorf("%w: недопустимый uid статьи %d", ErrInvalidFormat, article.ID)
+		}
+		if article.Revision < 1 {
+			article.Revision = 1
+		}
+		if article.CreatedAt.IsZero() {
+			article.CreatedAt = now
+		}
+		if article.UpdatedAt.IsZero() {
+			article.UpdatedAt = article.CreatedAt
+		}
+		return models.BackupRecord{Type: record.Type, Article: article}, nil
+
+	case models.BackupReaction:
+		reaction := record.Reaction
+		if reaction == nil || reaction.Login == "" {
+			return record, fmt.Errorf("%w: у реакции нет пользователя", ErrInvalidFormat)
+		}
+		if !slices.Contains(models.ReactionKinds, reaction.Kind) {
+			return record, fmt.Errorf("%w: неизвестная реакция %s", ErrInvalidFormat, reaction.Kind)
+		}
+		if reaction.CreatedAt.IsZero() {
+			reaction.CreatedAt = now
+		}
+		return models.BackupRecord{Type: record.Type, Reaction: reaction}, nil
+
+	case models.BackupBookmark:
+		bookmark := record.Bookmark
+		if bookmark == nil || bookmark.Login == "" {
+			return record, fmt.Errorf("%w: у закладки нет пользователя", ErrInvalidFormat)
+		}
+		if bookmark.CreatedAt.IsZero() {
+			bookmark.CreatedAt = now
+		}
+		return models.BackupRecord{Type: record.Type, Bookmark: bookmark}, nil
+
+	case models.BackupFollow:
+		follow := record.Follow
+		if follow == nil || follow.Follower == "" || follow.Followee == "" {
+			return record, fmt.Errorf("%w: у подписки нет пользователя", ErrInvalidFormat)
+		}
+		if follow.CreatedAt.IsZero() {
+			follow.CreatedAt = now
+		}
+		return models.BackupRecord{Type: record.Type, Follow: follow}, nil
+
+	case models.BackupMedia:
+		file := record.Media
+		if file == nil || file.Owner == "" {
+			return record, fmt.Errorf("%w: у файла нет владельца", ErrInvalidFormat)
+		}
+		// Ключи задаются при загрузке и не должны указывать за пределы хранилища
+		if !canonicalUUID(file.ID) ||
+			file.StorageKey != "originals/"+file.ID || file.ThumbnailKey != "thumbnails/"+file.ID {
+			return record, fmt.Errorf("%w: недопустимый файл %s", ErrInvalidFormat, file.ID)
+		}
+		if file.CreatedAt.IsZero() {
+			file.CreatedAt = now
+		}
+		return models.BackupRecord{Type: record.Type, Media: file}, nil
+	}
+	return record, fmt.Errorf("%w: неизвестный тип записи %q", ErrInvalidFormat, record.Type)
+}
+
+func validMediaKey(key string) bool {
+	folder, id, found := strings.Cut(key, "/")
+	if !found || (folder != "originals" && folder != "thumbnails") {
+		return false
+	}
+	return canonicalUUID(id)
+}
+
+// canonicalUUID не допускает других записей UUID, которые принимает uuid.Parse
+func canonicalUUID(value string) bool {
+	id, err := uuid.Parse(value)
+	return err == nil && id.String() == value
+}
@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// Backend — хранилище для кеширования ответов БД
+type Backend interface {
+	// Get возвращает значение и признак его наличия
+	Get(key string) ([]byte, bool, error)
+	// Set сохраняет значение, ttl 0 — без ограничения времени жизни
+	Set(key string, value []byte, ttl time.Duration) error
+	// Incr атомарно увеличивает счётчик и возвращает новое значение
+	Incr(key string) (int64, error)
+}
+
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+var ErrUnexpectedReply = errors.New("cache: неожиданный ответ сервера")
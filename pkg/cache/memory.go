@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"blog/pkg/lru"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory хранит значения в памяти процесса с вытеснением по LRU
+type Memory struct {
+	values *lru.Cache[string, []byte]
+
+	// Счётчики не вытесняются, иначе сброс поколения вернул бы устаревшие записи
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func NewMemory(size int) *Memory {
+	return &Memory{
+		values:   lru.New[string, []byte](size),
+		counters: make(map[string]int64),
+	}
+}
+
+func (memory *Memory) Get(key string) ([]byte, bool, error) {
+	memory.mu.Lock()
+	counter, isCounter := memory.counters[key]
+	memory.mu.Unlock()
+	if isCounter {
+		return []byte(strconv.FormatInt(counter, 10)), true, nil
+	}
+
+	value, ok := memory.values.Get(key)
+	return value, ok, nil
+}
+
+func (memory *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	memory.values.AddWithTTL(key, value, ttl)
+	return nil
+}
+
+func (memory *Memory) Incr(key string) (int64, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	memory.counters[key]++
+	return memory.counters[key], nil
+}
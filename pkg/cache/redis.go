@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Redis — минимальный клиент протокола RESP: GET, SET, INCR.
+// Подходит для Redis и совместимых серверов (Valkey, KeyDB, Dragonfly)
+type Redis struct {
+	address  string
+	password string
+	database int
+	timeout  time.Duration
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Ошибка, которую вернул сервер
+type RedisError string
+
+func (err RedisError) Error() string {
+	return "redis: " + string(err)
+}
+
+const redisPoolSize = 8
+
+// NewRedis подключается по адресу вида redis://[:password@]host:port[/db]
+func NewRedis(rawURL string) (*Redis, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "redis" {
+		return nil, fmt.Errorf("cache: неподдерживаемая схема %q", parsed.Scheme)
+	}
+
+	client := &Redis{
+		address: parsed.Host,
+		timeout: 2 * time.Second,
+		pool:    make(chan *redisConn, redisPoolSize),
+	}
+	if parsed.Port() == "" {
+		client.address = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		client.password, _ = parsed.User.Password()
+	}
+	if path := strings.Trim(parsed.Path, "/"); path != "" {
+		client.database, err = strconv.Atoi(path)
+		if err != nil {
+			return nil, fmt.Errorf("cache: неверный номер базы %q", path)
+		}
+	}
+
+	// Проверяем доступность сервера сразу, а не при первом запросе
+	if _, err := client.do("PING"); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (client *Redis) Get(key string) ([]byte, bool, error) {
+	reply, err := client.do("GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, ErrUnexpectedReply
+	}
+	return value, true, nil
+}
+
+func (client *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := client.do(args...)
+	return err
+}
+
+func (client *Redis) Incr(key string) (int64, error) {
+	reply, err := client.do("INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := reply.(int64)
+	if !ok {
+		return 0, ErrUnexpectedReply
+	}
+	return value, nil
+}
+
+// do отправляет команду и читает ответ. Соединение возвращается
+// в пул, только если обмен прошёл без сетевых ошибок
+func (client *Redis) do(args ...string) (interface{}, error) {
+	conn, err := client.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.command(client.timeout, args...)
+	var serverError RedisError
+	if err != nil && !errors.As(err, &serverError) {
+		conn.conn.Close()
+		return nil, err
+	}
+
+	select {
+	case client.pool <- conn:
+	default:
+		conn.conn.Close()
+	}
+	return reply, err
+}
+
+func (client *Redis) get() (*redisConn, error) {
+	select {
+	case conn := <-client.pool:
+		return conn, nil
+	default:
+	}
+
+	netConn, err := net.DialTimeout("tcp", client.address, client.timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if client.password != "" {
+		if _, err := conn.command(client.timeout, "AUTH", client.password); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	if client.database != 0 {
+		if _, err := conn.command(client.timeout, "SELECT", strconv.Itoa(client.database)); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (conn *redisConn) command(timeout time.Duration, args ...string) (interface{}, error) {
+	conn.conn.SetDeadline(time.Now().Add(timeout))
+
+	request := strings.Builder{}
+	fmt.Fprintf(&request, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(conn.conn, request.String()); err != nil {
+		return nil, err
+	}
+	return readReply(conn.reader)
+}
+
+// readReply разбирает один ответ RESP2
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, ErrUnexpectedReply
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, RedisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, ErrUnexpectedReply
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		value := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, err
+		}
+		return value[:length], nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, ErrUnexpectedReply
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			value, err := readReply(reader)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return nil, ErrUnexpectedReply
+}
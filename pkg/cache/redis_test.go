@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubRedis — сервер RESP в памяти, понимающий команды клиента Redis
+type stubRedis struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newStubRedis(t *testing.T) *stubRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubRedis{listener: listener, values: make(map[string]string)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (stub *stubRedis) url(userinfo, database string) string {
+	return "redis://" + userinfo + stub.listener.Addr().String() + database
+}
+
+func (stub *stubRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		parts, ok := request.([]interface{})
+		if !ok || len(parts) == 0 {
+			return
+		}
+		args := make([]string, 0, len(parts))
+		for _, part := range parts {
+			args = append(args, string(part.([]byte)))
+		}
+		fmt.Fprint(conn, stub.execute(args))
+	}
+}
+
+func (stub *stubRedis) execute(args []string) string {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	stub.commands = append(stub.commands, strings.Join(args, " "))
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := stub.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		stub.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "INCR":
+		counter, err := strconv.ParseInt(stub.values[args[1]], 10, 64)
+		if err != nil && stub.values[args[1]] != "" {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		counter++
+		stub.values[args[1]] = strconv.FormatInt(counter, 10)
+		return fmt.Sprintf(":%d\r\n", counter)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (stub *stubRedis) received(command string) bool {
+	return slices.Contains(stub.log(), command)
+}
+
+func (stub *stubRedis) log() []string {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	return append([]string(nil), stub.commands...)
+}
+
+func TestRedisGetSetIncr(t *testing.T) {
+	stub := newStubRedis(t)
+	client, err := NewRedis(stub.url("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := client.Get("missing"); err != nil || ok {
+		t.Fatalf("Get(missing) = %v, %v", ok, err)
+	}
+
+	if err := client.Set("key", []byte("value\r\nwith crlf"), 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if !stub.received("SET key value\r\nwith crlf PX 1500") {
+		t.Errorf("SET without PX: %q", stub.log())
+	}
+	value, ok, err := client.Get("key")
+	if err != nil || !ok || string(value) != "value\r\nwith crlf" {
+		t.Fatalf("Get(key) = %q, %v, %v", value, ok, err)
+	}
+
+	for want := int64(1); want <= 2; want++ {
+		counter, err := client.Incr("counter")
+		if err != nil || counter != want {
+			t.Fatalf("Incr = %d, %v, want %d", counter, err, want)
+		}
+	}
+}
+
+func TestRedisSetWithoutTTL(t *testing.T) {
+	stub := newStubRedis(t)
+	client, err := NewRedis(stub.url("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Set("key", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if !stub.received("SET key value") {
+		t.Errorf("unexpected commands %q", stub.log())
+	}
+}
+
+func TestRedisServerError(t *testing.T) {
+	stub := newStubRedis(t)
+	client, err := NewRedis(stub.url("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Set("key", []byte("text"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Incr("key"); err == nil {
+		t.Fatal("Incr of a string succeeded")
+	} else if _, ok := err.(RedisError); !ok {
+		t.Fatalf("Incr error %T, want RedisError", err)
+	}
+
+	// Ошибка сервера не рвёт соединение, и клиент продолжает работать
+	if _, ok, err := client.Get("key"); err != nil || !ok {
+		t.Fatalf("Get after error = %v, %v", ok, err)
+	}
+}
+
+func TestRedisAuthAndSelect(t *testing.T) {
+	stub := newStubRedis(t)
+	if _, err := NewRedis(stub.url(":secret@", "/2")); err != nil {
+		t.Fatal(err)
+	}
+	if !stub.received("AUTH secret") || !stub.received("SELECT 2") {
+		t.Errorf("unexpected commands %q", stub.log())
+	}
+}
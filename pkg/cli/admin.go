@@ -0,0 +1,323 @@
+package cli
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/feed"
+	"blog/pkg/models"
+	"blog/pkg/password"
+	"blog/pkg/storage"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const adminUsage = `Использование: blog admin <команда>
+
+Команды:
+  user create [-role R] LOGIN     создать пользователя
+  user disable LOGIN              заблокировать учётную запись
+  user enable LOGIN               снять блокировку
+  user delete -yes LOGIN          удалить пользователя, его статьи и файлы
+  user reset-password LOGIN       задать новый пароль
+  user grant LOGIN ROLE           назначить роль (user или admin)
+  articles list LOGIN             статьи автора
+  articles purge -yes LOGIN       удалить все статьи автора
+  stats                           сводная статистика
+
+Пароль читается из первой строки стандартного ввода.
+`
+
+// Сколько файлов пользователя запрашивается за раз при удалении
+const mediaBatchSize = 100
+
+var errNotConfirmed = errors.New("Операция необратима, повторите её с флагом -yes")
+
+// Admin выполняет команду blog admin и возвращает код завершения.
+// Изменения проходят через dbwork и сбрасывают общий кеш в Redis. Кеш
+// CACHE_BACKEND=memory живёт в процессе сервера, и там прежние ответы
+// остаются до истечения CACHE_TTL_SECONDS
+func Admin(args []string) int {
+	ctx := context.Background()
+	in := bufio.NewReader(os.Stdin)
+
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, adminUsage)
+		return 2
+	}
+
+	var err error
+	switch strings.Join(args[:min(2, len(args))], " ") {
+	case "user create":
+		err = createUser(ctx, in, args[2:])
+	case "user disable":
+		err = setDisabled(ctx, args[2:], true)
+	case "user enable":
+		err = setDisabled(ctx, args[2:], false)
+	case "user delete":
+		err = deleteUser(ctx, args[2:])
+	case "user reset-password":
+		err = resetPassword(ctx, in, args[2:])
+	case "user grant":
+		err = grantRole(ctx, args[2:])
+	case "articles list":
+		err = listArticles(ctx, os.Stdout, args[2:])
+	case "articles purge":
+		err = purgeArticles(ctx, args[2:])
+	default:
+		if len(args) == 1 && args[0] == "stats" {
+			err = printStats(ctx, os.Stdout)
+			break
+		}
+		fmt.Fprint(os.Stderr, adminUsage)
+		return 2
+	}
+	return exit(err)
+}
+
+func createUser(ctx context.Context, in *bufio.Reader, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	role := flags.String("role", models.RoleUser, "роль пользователя")
+	login, err := parseLogin(flags, args)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(models.Roles, *role) {
+		return fmt.Errorf("%w: неизвестная роль %s", errUsage, *role)
+	}
+	if err := password.ValidateLogin(login); err != nil {
+		return err
+	}
+
+	plainPassword, err := readPassword(in)
+	if err != nil {
+		return err
+	}
+	if err := password.ValidatePassword(login, plainPassword); err != nil {
+		return err
+	}
+
+	if err := wait(func(ch chan error) { dbwork.DB.CreateUser(ctx, login, plainPassword, ch) }); err != nil {
+		return err
+	}
+	if *role != models.RoleUser {
+		if err := wait(func(ch chan error) { dbwork.DB.SetUserRole(ctx, login, *role, ch) }); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Пользователь %s создан с ролью %s\n", login, *role)
+	return nil
+}
+
+func setDisabled(ctx context.Context, args []string, disabled bool) error {
+	login, err := parseLogin(flag.NewFlagSet("disable", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+
+	if err := wait(func(ch chan error) { dbwork.DB.SetUserDisabled(ctx, login, disabled, ch) }); err != nil {
+		return userError(login, err)
+	}
+	if disabled {
+		fmt.Printf("Пользователь %s заблокирован\n", login)
+	} else {
+		fmt.Printf("Пользователь %s разблокирован\n", login)
+	}
+	return nil
+}
+
+// deleteUser удаляет запись пользователя, а затем его файлы из хранилища.
+// Список файлов читается заранее: записи о них удаляются каскадно
+func deleteUser(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	confirmed := flags.Bool("yes", false, "подтвердить удаление")
+	login, err := parseLogin(flags, args)
+	if err != nil {
+		return err
+	}
+	if _, err := dbwork.DB.GetAccount(ctx, login); err != nil {
+		return userError(login, err)
+	}
+	if !*confirmed {
+		return errNotConfirmed
+	}
+
+	files := make([]models.Media, 0)
+	for offset := 0; ; offset += mediaBatchSize {
+		batch, err := dbwork.DB.GetUserMedia(ctx, login, mediaBatchSize, offset)
+		if err != nil {
+			return err
+		}
+		files = append(files, batch...)
+		if len(batch) < mediaBatchSize {
+			break
+		}
+	}
+
+	if err := wait(func(ch chan error) { dbwork.DB.DeleteUser(ctx, login, ch) }); err != nil {
+		return userError(login, err)
+	}
+
+	failed := 0
+	for _, file := range files {
+		for _, key := range []string{file.StorageKey, file.ThumbnailKey} {
+			if err := storage.Store.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+				fmt.Fprintf(os.Stderr, "Не удалось удалить файл %s: %v\n", key, err)
+				failed++
+			}
+		}
+	}
+	fmt.Printf("Пользователь %s удалён, файлов: %d\n", login, len(files))
+	if failed > 0 {
+		return fmt.Errorf("Не удалось удалить файлов из хранилища: %d", failed)
+	}
+	return nil
+}
+
+func resetPassword(ctx context.Context, in *bufio.Reader, args []string) error {
+	login, err := parseLogin(flag.NewFlagSet("reset-password", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if _, err := dbwork.DB.GetAccount(ctx, login); err != nil {
+		return userError(login, err)
+	}
+
+	plainPassword, err := readPassword(in)
+	if err != nil {
+		return err
+	}
+	if err := password.ValidatePassword(login, plainPassword); err != nil {
+		return err
+	}
+
+	if err := wait(func(ch chan error) { dbwork.DB.UpdatePassword(ctx, login, plainPassword, ch) }); err != nil {
+		return err
+	}
+	fmt.Printf("Пароль пользователя %s изменён\n", login)
+	return nil
+}
+
+func grantRole(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	login, role := args[0], args[1]
+	if !slices.Contains(models.Roles, role) {
+		return fmt.Errorf("%w: неизвестная роль %s", errUsage, role)
+	}
+
+	if err := wait(func(ch chan error) { dbwork.DB.SetUserRole(ctx, login, role, ch) }); err != nil {
+		return userError(login, err)
+	}
+	fmt.Printf("Пользователю %s назначена роль %s\n", login, role)
+	return nil
+}
+
+func listArticles(ctx context.Context, out io.Writer, args []string) error {
+	login, err := parseLogin(flag.NewFlagSet("list", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if _, err := dbwork.DB.GetAccount(ctx, login); err != nil {
+		return userError(login, err)
+	}
+
+	articles, err := dbwork.DB.GetAllArticle(ctx, models.ArticleFilter{Author: login, Sort: models.SortNewest})
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tСОЗДАНА\tРЕВИЗИЯ\tЗАГОЛОВОК")
+	for _, article := range articles {
+		fmt.Fprintf(writer, "%d\t%s\t%d\t%s\n",
+			article.ID, article.CreatedAt.Format(time.DateTime), article.Revision, feed.Title(article))
+	}
+	return writer.Flush()
+}
+
+func purgeArticles(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	confirmed := flags.Bool("yes", false, "подтвердить удаление")
+	login, err := parseLogin(flags, args)
+	if err != nil {
+		return err
+	}
+	if _, err := dbwork.DB.GetAccount(ctx, login); err != nil {
+		return userError(login, err)
+	}
+
+	articles, err := dbwork.DB.GetAllArticle(ctx, models.ArticleFilter{Author: login})
+	if err != nil {
+		return err
+	}
+	if !*confirmed {
+		fmt.Printf("Будет удалено статей: %d\n", len(articles))
+		return errNotConfirmed
+	}
+
+	if err := wait(func(ch chan error) { dbwork.DB.DeleteUserArticles(ctx, login, ch) }); err != nil {
+		return err
+	}
+	fmt.Printf("Удалено статей: %d\n", len(articles))
+	return nil
+}
+
+func printStats(ctx context.Context, out io.Writer) error {
+	stats, err := dbwork.DB.GetStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "Пользователи\t%d\n", stats.Users)
+	fmt.Fprintf(writer, "Заблокированы\t%d\n", stats.DisabledUsers)
+	fmt.Fprintf(writer, "Администраторы\t%d\n", stats.Admins)
+	fmt.Fprintf(writer, "Статьи\t%d\n", stats.Articles)
+	fmt.Fprintf(writer, "Реакции\t%d\n", stats.Reactions)
+	fmt.Fprintf(writer, "Закладки\t%d\n", stats.Bookmarks)
+	fmt.Fprintf(writer, "Подписки\t%d\n", stats.Follows)
+	fmt.Fprintf(writer, "Файлы\t%d (%d байт)\n", stats.Media, stats.MediaBytes)
+	fmt.Fprintf(writer, "Персональные токены\t%d\n", stats.APITokens)
+	return writer.Flush()
+}
+
+// parseLogin разбирает флаги команды и единственный аргумент — логин
+func parseLogin(flags *flag.FlagSet, args []string) (string, error) {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return "", errUsage
+	}
+	return flags.Arg(0), nil
+}
+
+func readPassword(in *bufio.Reader) (string, error) {
+	fmt.Fprint(os.Stderr, "Пароль: ")
+	line, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("Не удалось прочитать пароль: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// wait вызывает метод записи dbwork и дожидается результата
+func wait(write func(ch chan error)) error {
+	ch := make(chan error, 1)
+	write(ch)
+	return <-ch
+}
+
+func userError(login string, err error) error {
+	if err == dbwork.ErrNotFound {
+		return fmt.Errorf("Пользователь %s не найден", login)
+	}
+	return err
+}
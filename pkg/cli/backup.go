@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"blog/pkg/backup"
+	"blog/pkg/models"
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const exportUsage = `Использование: blog export [-format jsonl|tar] [-passwords] [-o FILE]
+
+Выгружает пользователей, статьи, реакции, закладки, подписки и файлы.
+Без -o выгрузка пишется в стандартный вывод.
+`
+
+const importUsage = `Использование: blog import FILE
+
+Загружает выгрузку в формате jsonl или tar. Если FILE равен -,
+выгрузка читается из стандартного ввода.
+`
+
+// Типы записей в порядке вывода итогов импорта
+var backupTypes = []string{
+	models.BackupUser,
+	models.BackupArticle,
+	models.BackupReaction,
+	models.BackupBookmark,
+	models.BackupFollow,
+	models.BackupMedia,
+}
+
+// Export выполняет команду blog export и возвращает код завершения
+func Export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", backup.FormatJSONL, "формат выгрузки")
+	passwords := flags.Bool("passwords", false, "выгрузить хеши паролей")
+	output := flags.String("o", "", "файл выгрузки")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 ||
+		!slices.Contains([]string{backup.FormatJSONL, backup.FormatTar}, *format) {
+		fmt.Fprint(os.Stderr, exportUsage)
+		return 2
+	}
+
+	return exit(exportTo(*output, backup.Options{Format: *format, Passwords: *passwords}))
+}
+
+// exportTo пишет выгрузку во временный файл рядом с целевым и переименовывает
+// его в конце, чтобы прерванная выгрузка не заменила предыдущую
+func exportTo(name string, options backup.Options) error {
+	ctx := context.Background()
+	if name == "" {
+		out := bufio.NewWriter(os.Stdout)
+		if err := backup.Export(ctx, out, options); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), ".blog-export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	out := bufio.NewWriter(file)
+	if err := backup.Export(ctx, out, options); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), name)
+}
+
+// Import выполняет команду blog import и возвращает код завершения
+func Import(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, importUsage)
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return exit(err)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	applied, err := backup.Import(context.Background(), in)
+	printApplied(applied)
+	return exit(err)
+}
+
+// printApplied выводит число применённых записей, в том числе
+// если импорт прервался на середине
+func printApplied(applied map[string]int) {
+	for _, recordType := range backupTypes {
+		fmt.Printf("%s: %d\n", recordType, applied[recordType])
+	}
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"blog/pkg/legacy"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const legacyUsage = `Использование:
+  blog import-wxr [параметры] FILE        импорт выгрузки WordPress (WXR)
+  blog import-markdown [параметры] DIR    импорт Markdown-файлов с front-matter
+
+Параметры:
+  -dry-run               только показать, что будет импортировано
+  -author SRC=LOGIN      автор SRC становится пользователем LOGIN, можно повторять
+  -default-author LOGIN  пользователь для записей без найденного автора
+  -create-users          создать пользователей для ненайденных авторов
+
+Повторный импорт тех же записей обновляет статьи, а не создаёт копии.
+`
+
+// ImportWXR выполняет команду blog import-wxr и возвращает код завершения
+func ImportWXR(args []string) int {
+	return importLegacy(args, func(name string) (legacy.Source, error) {
+		file, err := os.Open(name)
+		if err != nil {
+			return legacy.Source{}, err
+		}
+		defer file.Close()
+		return legacy.ReadWXR(file)
+	})
+}
+
+// ImportMarkdown выполняет команду blog import-markdown и возвращает код завершения
+func ImportMarkdown(args []string) int {
+	return importLegacy(args, func(name string) (legacy.Source, error) {
+		info, err := os.Stat(name)
+		if err != nil {
+			return legacy.Source{}, err
+		}
+		if !info.IsDir() {
+			return legacy.Source{}, fmt.Errorf("%s не является каталогом", name)
+		}
+		return legacy.ReadMarkdown(os.DirFS(name))
+	})
+}
+
+func importLegacy(args []string, read func(name string) (legacy.Source, error)) int {
+	options := legacy.Options{Authors: make(map[string]string)}
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.BoolVar(&options.DryRun, "dry-run", false, "только показать отчёт")
+	flags.StringVar(&options.DefaultAuthor, "default-author", "", "пользователь по умолчанию")
+	flags.BoolVar(&options.CreateUsers, "create-users", false, "создать ненайденных пользователей")
+	flags.Func("author", "соответствие SRC=LOGIN", func(value string) error {
+		source, login, found := strings.Cut(value, "=")
+		if !found || login == "" {
+			return errUsage
+		}
+		options.Authors[source] = login
+		return nil
+	})
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, legacyUsage)
+		return 2
+	}
+
+	source, err := read(flags.Arg(0))
+	if err != nil {
+		return exit(err)
+	}
+	report, err := legacy.Import(context.Background(), source, options)
+	printReport(os.Stdout, report, options.DryRun)
+	return exit(err)
+}
+
+func printReport(out io.Writer, report legacy.Report, dryRun bool) {
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	if dryRun {
+		fmt.Fprintln(writer, "Пробный запуск, изменения не записаны")
+		fmt.Fprintln(writer)
+	}
+
+	fmt.Fprintf(writer, "Статьи: %d\n", len(report.Articles))
+	if len(report.Articles) > 0 {
+		fmt.Fprintln(writer, "ИСТОЧНИК\tАВТОР\tДАТА\tЗАГОЛОВОК")
+	}
+	for _, article := range report.Articles {
+		date := "-"
+		if !article.CreatedAt.IsZero() {
+			date = article.CreatedAt.Format(time.DateOnly)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", article.Source, article.Author, date, article.Title)
+	}
+
+	if len(report.NewUsers) > 0 {
+		fmt.Fprintf(writer, "\nНовые пользователи: %s\n", strings.Join(report.NewUsers, ", "))
+	}
+	if len(report.MissingAuthors) > 0 {
+		authors := make([]string, 0, len(report.MissingAuthors))
+		for _, author := range report.MissingAuthors {
+			if author == "" {
+				author = "(не указан)"
+			}
+			authors = append(authors, author)
+		}
+		fmt.Fprintf(writer, "\nНе найдены пользователи для авторов: %s\n", strings.Join(authors, ", "))
+		fmt.Fprintln(writer, "Укажите -author, -default-author или -create-users")
+	}
+
+	if len(report.Skipped) > 0 {
+		fmt.Fprintf(writer, "\nПропущено: %d\n", len(report.Skipped))
+		for _, skipped := range report.Skipped {
+			fmt.Fprintf(writer, "%s\t%s\n", skipped.Source, skipped.Reason)
+		}
+	}
+
+	if !dryRun && report.Applied != nil {
+		fmt.Fprintln(writer)
+		for _, recordType := range backupTypes {
+			if count, ok := report.Applied[recordType]; ok {
+				fmt.Fprintf(writer, "%s: %d\n", recordType, count)
+			}
+		}
+	}
+	writer.Flush()
+}
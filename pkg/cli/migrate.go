@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"blog/pkg/dbwork"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+const migrateUsage = `Использование: blog migrate <команда>
+
+Команды:
+  up                 применить все новые миграции
+  down N             откатить N последних миграций
+  goto V             перейти к версии V
+  version            показать текущую версию схемы
+  force V            записать версию V без выполнения миграций
+                     (после ручного исправления незавершённой миграции)
+  create [-dir D] NAME
+                     создать пустые файлы N_NAME.up.sql и N_NAME.down.sql
+`
+
+// Каталог исходных файлов миграций для команды create
+const defaultMigrationsDir = "pkg/dbwork/migrations"
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Migrate выполняет команду blog migrate и возвращает код завершения.
+// Параметры БД читаются только командами, которым нужно подключение
+func Migrate(args []string, config func() dbwork.PostgresDBParams) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	command, args := args[0], args[1:]
+	if command == "create" {
+		return exit(createMigration(os.Stdout, args))
+	}
+
+	// Аргументы проверяются до подключения к БД
+	run, err := parseMigrateCommand(command, args)
+	if err != nil {
+		if err == errUnknownCommand {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+		return exit(err)
+	}
+
+	db, err := dbwork.OpenDB(config())
+	if err != nil {
+		return exit(err)
+	}
+	m, err := dbwork.NewMigrate(db)
+	if err != nil {
+		db.Close()
+		return exit(err)
+	}
+	defer m.Close()
+	m.Log = migrateLogger{}
+
+	return exit(run(m))
+}
+
+func parseMigrateCommand(command string, args []string) (func(*migrate.Migrate) error, error) {
+	switch command {
+	case "up":
+		if len(args) != 0 {
+			return nil, errUsage
+		}
+		return func(m *migrate.Migrate) error {
+			return noChange(m.Up())
+		}, nil
+	case "down":
+		// Откат требует явного числа шагов, чтобы случайно не удалить всю схему
+		steps, err := positiveArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return func(m *migrate.Migrate) error {
+			return noChange(m.Steps(-steps))
+		}, nil
+	case "goto":
+		version, err := positiveArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return func(m *migrate.Migrate) error {
+			return noChange(m.Migrate(uint(version)))
+		}, nil
+	case "version":
+		if len(args) != 0 {
+			return nil, errUsage
+		}
+		return printVersion, nil
+	case "force":
+		// Значение -1 означает, что ни одна миграция не применена
+		if len(args) != 1 {
+			return nil, errUsage
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < -1 {
+			return nil, errUsage
+		}
+		return func(m *migrate.Migrate) error {
+			if err := m.Force(version); err != nil {
+				return err
+			}
+			fmt.Printf("Установлена версия %d\n", version)
+			return nil
+		}, nil
+	}
+	return nil, errUnknownCommand
+}
+
+func printVersion(m *migrate.Migrate) error {
+	expected, err := dbwork.LatestMigration(dbwork.Migrations())
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		fmt.Printf("Миграции не применялись, последняя версия %d\n", expected)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Версия %d, последняя версия %d", version, expected)
+	if dirty {
+		fmt.Print(", миграция не завершена")
+	}
+	fmt.Println()
+	return nil
+}
+
+// createMigration создаёт пару файлов со следующим номером. Файлы
+// пишутся в исходный каталог и попадут в бинарный файл при сборке
+func createMigration(out io.Writer, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	dir := flags.String("dir", defaultMigrationsDir, "каталог миграций")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 || !migrationName.MatchString(flags.Arg(0)) {
+		return fmt.Errorf("%w: имя может содержать только строчные латинские буквы, цифры и _", errUsage)
+	}
+
+	latest, err := dbwork.LatestMigration(os.DirFS(*dir))
+	if err != nil {
+		return err
+	}
+
+	prefix := filepath.Join(*dir, fmt.Sprintf("%d_%s", latest+1, flags.Arg(0)))
+	for _, name := range []string{prefix + ".up.sql", prefix + ".down.sql"} {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return err
+		}
+		file.Close()
+		fmt.Fprintln(out, name)
+	}
+	return nil
+}
+
+func positiveArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errUsage
+	}
+	value, err := strconv.Atoi(args[0])
+	if err != nil || value <= 0 {
+		return 0, errUsage
+	}
+	return value, nil
+}
+
+func noChange(err error) error {
+	if err == migrate.ErrNoChange {
+		fmt.Println("Изменений нет")
+		return nil
+	}
+	return err
+}
+
+// migrateLogger выводит шаги миграции в stderr
+type migrateLogger struct{}
+
+func (migrateLogger) Printf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, v...)
+}
+
+func (migrateLogger) Verbose() bool {
+	return false
+}
+
+var (
+	errUsage          = errors.New("Неверные аргументы команды")
+	errUnknownCommand = errors.New("Неизвестная команда")
+)
+
+// exit печатает ошибку и возвращает код завершения команды
+func exit(err error) int {
+	if err == nil {
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, err)
+	if errors.Is(err, errUsage) {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"blog/pkg/feed"
+	"blog/pkg/site"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const buildStaticUsage = `Использование: blog build-static -out DIR [-page-size N] [-base-url URL]
+
+Собирает статическую копию блога: страницы статей, список статей
+с пагинацией, страницы авторов, ленты и карту сайта. Ссылки на страницах
+отсчитываются от корня сайта, поэтому DIR нужно публиковать по адресу /.
+Каталог DIR заменяется целиком; непустой каталог, созданный не этой
+командой, не перезаписывается.
+
+  -base-url URL   публичный адрес копии для лент и карты сайта,
+                  по умолчанию SITE_URL
+`
+
+// BuildStatic выполняет команду blog build-static и возвращает код завершения
+func BuildStatic(args []string) int {
+	options := site.DefaultStaticOptions()
+	flags := flag.NewFlagSet("build-static", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&options.Out, "out", "", "каталог сборки")
+	flags.IntVar(&options.PageSize, "page-size", options.PageSize, "статей на странице")
+	baseURL := flags.String("base-url", "", "публичный адрес копии")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || options.Out == "" || options.PageSize < 1 {
+		fmt.Fprint(os.Stderr, buildStaticUsage)
+		return 2
+	}
+
+	// В статической копии у статей есть только HTML-страницы
+	config := feed.CurrentConfig()
+	config.HTMLPages = true
+	if *baseURL != "" {
+		config.SiteURL = *baseURL
+	}
+	feed.InitializationFeed(config)
+
+	result, err := site.Build(context.Background(), options)
+	if err != nil {
+		return exit(err)
+	}
+	fmt.Printf("Статей: %d, авторов: %d, файлов: %d\n", result.Articles, result.Authors, result.Files)
+	return 0
+}
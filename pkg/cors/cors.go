@@ -0,0 +1,183 @@
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Параметры политики CORS
+type Config struct {
+	// Разрешённые источники: "*", точное значение или шаблон вида https://*.example.com
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// Время кеширования preflight-ответа в секундах
+	MaxAge int
+}
+
+// Методы, для которых проверяется наличие маршрута при preflight-запросе
+var candidateMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+var ErrWildcardCredentials = errors.New("CORS: нельзя разрешать credentials для любого источника")
+
+type handler struct {
+	config   Config
+	router   *mux.Router
+	wildcard bool
+	headers  map[string]bool
+}
+
+// New оборачивает роутер: отвечает на preflight-запросы, перечисляя методы,
+// которые действительно зарегистрированы для пути, и добавляет заголовки
+// к обычным запросам с разрешённых источников
+func New(config Config, router *mux.Router) (http.Handler, error) {
+	wildcard := slices.Contains(config.AllowedOrigins, "*")
+	if wildcard && config.AllowCredentials {
+		return nil, ErrWildcardCredentials
+	}
+
+	headers := make(map[string]bool)
+	for _, header := range config.AllowedHeaders {
+		headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return &handler{config: config, router: router, wildcard: wildcard, headers: headers}, nil
+}
+
+func (h *handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		h.router.ServeHTTP(rw, r)
+		return
+	}
+
+	rw.Header().Add("Vary", "Origin")
+	allowed := h.allowedOrigin(origin)
+
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		h.preflight(rw, r, origin, allowed)
+		return
+	}
+
+	if allowed {
+		h.setOrigin(rw, origin)
+		if len(h.config.ExposedHeaders) > 0 {
+			rw.Header().Set("Access-Control-Expose-Headers", strings.Join(h.config.ExposedHeaders, ", "))
+		}
+	}
+	h.router.ServeHTTP(rw, r)
+}
+
+func (h *handler) preflight(rw http.ResponseWriter, r *http.Request, origin string, allowed bool) {
+	rw.Header().Add("Vary", "Access-Control-Request-Method")
+	rw.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	if !allowed {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	methods := h.routeMethods(r)
+	if len(methods) == 0 {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	requested := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !slices.Contains(methods, requested) {
+		rw.Header().Set("Allow", strings.Join(methods, ", "))
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestHeaders := make([]string, 0)
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+		if !h.headers[header] {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		requestHeaders = append(requestHeaders, header)
+	}
+
+	h.setOrigin(rw, origin)
+	rw.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(requestHeaders) > 0 {
+		rw.Header().Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+	}
+	if h.config.MaxAge > 0 {
+		rw.Header().Set("Access-Control-Max-Age", strconv.Itoa(h.config.MaxAge))
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) setOrigin(rw http.ResponseWriter, origin string) {
+	if h.wildcard {
+		rw.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	rw.Header().Set("Access-Control-Allow-Origin", origin)
+	if h.config.AllowCredentials {
+		rw.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// routeMethods возвращает методы, для которых в роутере есть маршрут по этому пути
+func (h *handler) routeMethods(r *http.Request) []string {
+	methods := make([]string, 0, len(candidateMethods))
+	for _, method := range candidateMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+
+		match := mux.RouteMatch{}
+		if h.router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+func (h *handler) allowedOrigin(origin string) bool {
+	for _, allowed := range h.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if matchPattern(strings.ToLower(allowed), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern сопоставляет источник с шаблоном, содержащим одну звёздочку.
+// Звёздочка соответствует непустой части без "/", например поддомену или порту
+func matchPattern(pattern, origin string) bool {
+	prefix, suffix, found := strings.Cut(pattern, "*")
+	if !found {
+		return false
+	}
+	if len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+	if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	middle := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.Contains(middle, "/")
+}
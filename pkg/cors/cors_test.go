@@ -0,0 +1,137 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMatchPattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		origin  string
+		match   bool
+	}{
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://app.example.com.evil.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://evil.com/.example.com", false},
+		{"http://localhost:*", "http://localhost:5173", true},
+		{"http://localhost:*", "http://localhost:", false},
+		{"https://example.com", "https://example.com", false},
+	} {
+		if match := matchPattern(test.pattern, test.origin); match != test.match {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", test.pattern, test.origin, match, test.match)
+		}
+	}
+}
+
+func TestAllowedOrigin(t *testing.T) {
+	h := &handler{config: Config{AllowedOrigins: []string{"https://Blog.example", "https://*.preview.example"}}}
+	for _, test := range []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://blog.example", true},
+		{"https://BLOG.EXAMPLE", true},
+		{"https://pr-1.Preview.example", true},
+		{"https://other.example", false},
+		{"null", false},
+	} {
+		if allowed := h.allowedOrigin(test.origin); allowed != test.allowed {
+			t.Errorf("allowedOrigin(%q) = %v, want %v", test.origin, allowed, test.allowed)
+		}
+	}
+}
+
+func TestNewRejectsWildcardCredentials(t *testing.T) {
+	_, err := New(Config{AllowedOrigins: []string{"*"}, AllowCredentials: true}, mux.NewRouter())
+	if err != ErrWildcardCredentials {
+		t.Fatalf("New = %v, want ErrWildcardCredentials", err)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	router := mux.NewRouter()
+	noop := func(rw http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/articles", noop).Methods("GET", "POST")
+	router.HandleFunc("/articles/{id}", noop).Methods("DELETE")
+
+	handler, err := New(Config{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedHeaders:   []string{"content-type", "X-CSRF-Token"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		origin  string
+		path    string
+		method  string
+		headers string
+		code    int
+		methods string
+	}{
+		{"allowed", "https://app.example.com", "/articles", "POST", "Content-Type, x-csrf-token", http.StatusNoContent, "GET, POST"},
+		{"foreign origin", "https://evil.com", "/articles", "POST", "", http.StatusForbidden, ""},
+		{"method not routed", "https://app.example.com", "/articles", "DELETE", "", http.StatusMethodNotAllowed, ""},
+		{"unknown path", "https://app.example.com", "/missing", "GET", "", http.StatusNotFound, ""},
+		{"header not allowed", "https://app.example.com", "/articles/1", "DELETE", "Authorization", http.StatusForbidden, ""},
+	} {
+		r := httptest.NewRequest(http.MethodOptions, test.path, nil)
+		r.Header.Set("Origin", test.origin)
+		r.Header.Set("Access-Control-Request-Method", test.method)
+		if test.headers != "" {
+			r.Header.Set("Access-Control-Request-Headers", test.headers)
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, r)
+
+		if rw.Code != test.code {
+			t.Errorf("%s: status %d, want %d", test.name, rw.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusNoContent {
+			if rw.Header().Get("Access-Control-Allow-Origin") != "" {
+				t.Errorf("%s: rejected preflight allowed the origin", test.name)
+			}
+			continue
+		}
+		header := rw.Header()
+		if header.Get("Access-Control-Allow-Origin") != test.origin ||
+			header.Get("Access-Control-Allow-Credentials") != "true" ||
+			header.Get("Access-Control-Allow-Methods") != test.methods ||
+			header.Get("Access-Control-Allow-Headers") != "Content-Type, X-Csrf-Token" ||
+			header.Get("Access-Control-Max-Age") != "600" {
+			t.Errorf("%s: headers %v", test.name, header)
+		}
+	}
+}
+
+func TestSimpleRequestFromForeignOrigin(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {})
+	handler, err := New(Config{AllowedOrigins: []string{"https://blog.example"}}, router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, r)
+	// Запрос выполняется, но браузер не отдаст ответ чужому источнику
+	if rw.Code != http.StatusOK || rw.Header().Get("Access-Control-Allow-Origin") != "" || rw.Header().Get("Vary") != "Origin" {
+		t.Fatalf("status %d, headers %v", rw.Code, rw.Header())
+	}
+}
@@ -0,0 +1,120 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+	"database/sql"
+)
+
+func (postgres *PostgresDataBase) GetAccount(ctx context.Context, login string) (models.Account, error) {
+	getAccountQuery := `SELECT login, role, disabled_at FROM users WHERE login=$1`
+	account := models.Account{}
+	err := postgres.db.QueryRowContext(ctx, getAccountQuery, login).Scan(&account.Login, &account.Role, &account.DisabledAt)
+	if err == sql.ErrNoRows {
+		return account, ErrNotFound
+	}
+	return account, err
+}
+
+func (postgres *PostgresDataBase) GetStats(ctx context.Context) (models.Stats, error) {
+	getStatsQuery := `SELECT
+	                    (SELECT COUNT(*) FROM users),
+	                    (SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL),
+	                    (SELECT COUNT(*) FROM users WHERE role='admin'),
+	                    (SELECT COUNT(*) FROM articles),
+	                    (SELECT COUNT(*) FROM article_reactions),
+	                    (SELECT COUNT(*) FROM bookmarks),
+	                    (SELECT COUNT(*) FROM follows),
+	                    (SELECT COUNT(*) FROM media),
+	                    (SELECT COALESCE(SUM(size), 0) FROM media),
+	                    (SELECT COUNT(*) FROM api_tokens)`
+	stats := models.Stats{}
+	err := postgres.db.QueryRowContext(ctx, getStatsQuery).Scan(
+		&stats.Users, &stats.DisabledUsers, &stats.Admins, &stats.Articles, &stats.Reactions,
+		&stats.Bookmarks, &stats.Follows, &stats.Media, &stats.MediaBytes, &stats.APITokens,
+	)
+	return stats, err
+}
+
+// SetUserDisabled блокирует или разблокирует учётную запись. Заблокированный
+// пользователь не может войти, а выданные ему токены перестают приниматься
+func (postgres *PostgresDataBase) SetUserDisabled(ctx context.Context, login string, disabled bool, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventSetUserDisabled, login: login, disabled: disabled, error: ch})
+}
+
+func (postgres *PostgresDataBase) SetUserRole(ctx context.Context, login, role string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventSetUserRole, login: login, role: role, error: ch})
+}
+
+// DeleteUser удаляет пользователя вместе со статьями, токенами и кодами
+// восстановления. Записи о загруженных файлах удаляются каскадно,
+// сами файлы из хранилища удаляет вызывающий
+func (postgres *PostgresDataBase) DeleteUser(ctx context.Context, login string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventDeleteUser, login: login, error: ch})
+}
+
+func (postgres *PostgresDataBase) DeleteUserArticles(ctx context.Context, login string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventDeleteUserArticles, login: login, error: ch})
+}
+
+func (postgres *PostgresDataBase) setUserDisabledInDB(ctx context.Context, login string, disabled bool) error {
+	setDisabledQuery := `UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END
+	                     WHERE login=$1`
+	return postgres.execUserUpdate(ctx, setDisabledQuery, login, disabled)
+}
+
+func (postgres *PostgresDataBase) setUserRoleInDB(ctx context.Context, login, role string) error {
+	setRoleQuery := `UPDATE users SET role=$2 WHERE login=$1`
+	return postgres.execUserUpdate(ctx, setRoleQuery, login, role)
+}
+
+func (postgres *PostgresDataBase) execUserUpdate(ctx context.Context, query, login string, value interface{}) error {
+	result, err := postgres.db.ExecContext(ctx, query, login, value)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (postgres *PostgresDataBase) deleteUserInDB(ctx context.Context, login string) error {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID := -1
+	err = tx.QueryRowContext(ctx, `SELECT id FROM users WHERE login=$1`, login).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// У статей нет внешнего ключа на автора, остальные данные пользователя
+	// удаляются каскадно
+	for _, query := range []string{
+		`DELETE FROM articles WHERE user_id=$1`,
+		`DELETE FROM users WHERE id=$1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (postgres *PostgresDataBase) deleteUserArticlesInDB(ctx context.Context, login string) error {
+	deleteArticlesQuery := `DELETE FROM articles WHERE user_id=(SELECT id FROM users WHERE login=$1)`
+	_, err := postgres.db.ExecContext(ctx, deleteArticlesQuery, login)
+	return err
+}
@@ -0,0 +1,291 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ExportContent передаёт emit все записи выгрузки в порядке, нужном для
+// импорта. Чтение идёт в одной транзакции, поэтому выгрузка согласована
+func (postgres *PostgresDataBase) ExportContent(ctx context.Context, withPasswords bool, emit func(models.BackupRecord) error) error {
+	tx, err := postgres.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exports := []struct {
+		query string
+		scan  func(*sql.Rows) (models.BackupRecord, error)
+	}{
+		{
+			`SELECT login, role, disabled_at, COALESCE(password, '') FROM users ORDER BY id`,
+			func(rows *sql.Rows) (models.BackupRecord, error) {
+				user := &models.BackupUserData{}
+				err := rows.Scan(&user.Login, &user.Role, &user.DisabledAt, &user.PasswordHash)
+				if !withPasswords {
+					user.PasswordHash = ""
+				}
+				return models.BackupRecord{Type: models.BackupUser, User: user}, err
+			},
+		},
+		{
+			`SELECT articles.id, articles.uid, users.login, articles.text, articles.revision,
+			        articles.created_at, articles.updated_at
+			 FROM articles, users WHERE articles.user_id = users.id ORDER BY articles.id`,
+			func(rows *sql.Rows) (models.BackupRecord, error) {
+				article := &models.BackupArticleData{}
+				err := rows.Scan(&article.ID, &article.UID, &article.Author, &article.Text,
+					&article.Revision, &article.CreatedAt, &article.UpdatedAt)
+				return models.BackupRecord{Type: models.BackupArticle, Article: article}, err
+			},
+		},
+		{
+			`SELECT article_reactions.article_id, users.login, article_reactions.kind, article_reactions.created_at
+			 FROM article_reactions, users WHERE article_reactions.user_id = users.id
+			 ORDER BY article_reactions.article_id, article_reactions.created_at`,
+			func(rows *sql.Rows) (models.BackupRecord, error) {
+				reaction := &models.BackupReactionData{}
+				err := rows.Scan(&reaction.ArticleID, &reaction.Login, &reaction.Kind, &reaction.CreatedAt)
+				return models.BackupRecord{Type: models.BackupReaction, Reaction: reaction}, err
+			},
+		},
+		{
+			`SELECT bookmarks.article_id, users.login, bookmarks.created_at
+			 FROM bookmarks, users WHERE bookmarks.user_id = users.id
+			 ORDER BY bookmarks.created_at`,
+			func(rows *sql.Rows) (models.BackupRecord, error) {
+				bookmark := &models.BackupBookmarkData{}
+				err := rows.Scan(&bookmark.ArticleID, &bookmark.Login, &bookmark.CreatedAt)
+				return models.BackupRecord{Type: models.BackupBookmark, Bookmark: bookmark}, err
+			},
+		},
+		{
+			`SELECT followers.login, followees.login, follows.created_at
+			 FROM follows, users AS followers, users AS followees
+			 WHERE follows.follower_id = followers.id AND follows.followee_id = followees.id
+			 ORDER BY follows.created_at`,
+			func(rows *sql.Rows) (models.BackupRecord, error) {
+				follow := &models.BackupFollowData{}
+				err := rows.Scan(&follow.Follower, &follow.Followee, &follow.CreatedAt)
+				return models.BackupRecord{Type: models.BackupFollow, Follow: follow}, err
+			},
+		},
+		{
+			`SELECT media.id, users.login, media.storage_key, media.thumbnail_key, media.thumbnail_type,
+			        media.content_type, media.size, media.original_name, media.created_at
+			 FROM media, users WHERE media.user_id = users.id ORDER BY media.created_at`,
+			func(rows *sql.Rows) (models.BackupRecord, error) {
+				file := &models.BackupMediaData{}
+				err := rows.Scan(&file.ID, &file.Owner, &file.StorageKey, &file.ThumbnailKey, &file.ThumbnailType,
+					&file.ContentType, &file.Size, &file.Name, &file.CreatedAt)
+				return models.BackupRecord{Type: models.BackupMedia, Media: file}, err
+			},
+		},
+	}
+
+	for _, export := range exports {
+		if err := exportRows(ctx, tx, export.query, export.scan, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportRows(ctx context.Context, tx *sql.Tx, query string, scan func(*sql.Rows) (models.BackupRecord, error), emit func(models.BackupRecord) error) error {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := emit(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportBatch применяет пачку записей выгрузки в одной транзакции.
+// Повторный импорт тех же записей ничего не дублирует: пользователи
+// сопоставляются по логину, статьи по uid, остальное по первичным ключам
+func (postgres *PostgresDataBase) ImportBatch(ctx context.Context, batch *models.ImportBatch, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventImportBatch, batch: batch, error: ch})
+}
+
+func (postgres *PostgresDataBase) importBatchInDB(ctx context.Context, batch *models.ImportBatch) error {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Соответствия и счётчики попадают в batch только после фиксации
+	articleIDs := &importedArticles{committed: batch.ArticleIDs, pending: make(map[int]int)}
+	applied := make(map[string]int)
+	for _, record := range batch.Records {
+		ok, err := importRecord(ctx, tx, articleIDs, record)
+		if err != nil {
+			return fmt.Errorf("%s: %w", record.Type, err)
+		}
+		if ok {
+			applied[record.Type]++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for sourceID, id := range articleIDs.pending {
+		batch.ArticleIDs[sourceID] = id
+	}
+	for recordType, count := range applied {
+		batch.Applied[recordType] += count
+	}
+	return nil
+}
+
+type importedArticles struct {
+	committed map[int]int
+	pending   map[int]int
+}
+
+func (articles *importedArticles) get(sourceID int) (int, bool) {
+	if id, ok := articles.pending[sourceID]; ok {
+		return id, true
+	}
+	id, ok := articles.committed[sourceID]
+	return id, ok
+}
+
+// importRecord возвращает false, если запись уже была в БД
+// или ссылается на отсутствующего пользователя
+func importRecord(ctx context.Context, tx *sql.Tx, articleIDs *importedArticles, record models.BackupRecord) (bool, error) {
+	switch {
+	case record.User != nil:
+		user := record.User
+		// Строка без изменений не обновляется, иначе повторный импорт
+		// считал бы каждого пользователя применённым
+		result, err := tx.ExecContext(ctx,
+			`UPDATE users SET role=$2, disabled_at=$3, password=COALESCE(NULLIF($4, ''), password)
+			 WHERE login=$1 AND (role IS DISTINCT FROM $2 OR disabled_at IS DISTINCT FROM $3
+			   OR (NULLIF($4, '') IS NOT NULL AND password IS DISTINCT FROM $4))`,
+			user.Login, user.Role, user.DisabledAt, user.PasswordHash,
+		)
+		if err != nil {
+			return false, err
+		}
+		if count, err := result.RowsAffected(); err != nil || count > 0 {
+			return count > 0, err
+		}
+		exists := false
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE login=$1)`, user.Login).Scan(&exists)
+		if err != nil || exists {
+			return false, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO users (login, password, role, disabled_at) VALUES($1, NULLIF($4, ''), $2, $3)`,
+			user.Login, user.Role, user.DisabledAt, user.PasswordHash,
+		)
+		return err == nil, err
+
+	case record.Article != nil:
+		article := record.Article
+		// Ревизия из выгрузки берётся только для новой статьи. Существующая
+		// обновляется, лишь если текст изменился, и получает следующую ревизию:
+		// пара (id, ревизия) не должна указывать на другой текст, иначе кеш
+		// Markdown и ETag отдадут старую версию
+		id := 0
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO articles (uid, user_id, text, revision, created_at, updated_at)
+			 SELECT COALESCE(NULLIF($1, '')::uuid, gen_random_uuid()), users.id, $3, $4, $5, $6
+			 FROM users WHERE users.login=$2
+			 ON CONFLICT (uid) DO UPDATE SET user_id=EXCLUDED.user_id, text=EXCLUDED.text,
+			   revision=articles.revision + 1, created_at=EXCLUDED.created_at, updated_at=EXCLUDED.updated_at
+			 WHERE articles.text IS DISTINCT FROM EXCLUDED.text
+			 RETURNING id`,
+			article.UID, article.Author, article.Text, article.Revision, article.CreatedAt, article.UpdatedAt,
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			// Статья с тем же текстом уже есть, либо нет автора
+			err = tx.QueryRowContext(ctx, `SELECT id FROM articles WHERE uid=NULLIF($1, '')::uuid`, article.UID).Scan(&id)
+			if err == sql.ErrNoRows {
+				return false, fmt.Errorf("автор %s не найден", article.Author)
+			}
+			if err != nil {
+				return false, err
+			}
+			articleIDs.pending[article.ID] = id
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		articleIDs.pending[article.ID] = id
+		return true, nil
+
+	case record.Reaction != nil:
+		reaction := record.Reaction
+		articleID, ok := articleIDs.get(reaction.ArticleID)
+		if !ok {
+			return false, fmt.Errorf("статья %d отсутствует в выгрузке", reaction.ArticleID)
+		}
+		return execInserted(ctx, tx,
+			`INSERT INTO article_reactions (article_id, user_id, kind, created_at)
+			 SELECT $1, id, $3, $4 FROM users WHERE login=$2
+			 ON CONFLICT DO NOTHING`,
+			articleID, reaction.Login, reaction.Kind, reaction.CreatedAt,
+		)
+
+	case record.Bookmark != nil:
+		bookmark := record.Bookmark
+		articleID, ok := articleIDs.get(bookmark.ArticleID)
+		if !ok {
+			return false, fmt.Errorf("статья %d отсутствует в выгрузке", bookmark.ArticleID)
+		}
+		return execInserted(ctx, tx,
+			`INSERT INTO bookmarks (user_id, article_id, created_at)
+			 SELECT id, $1, $3 FROM users WHERE login=$2
+			 ON CONFLICT DO NOTHING`,
+			articleID, bookmark.Login, bookmark.CreatedAt,
+		)
+
+	case record.Follow != nil:
+		follow := record.Follow
+		return execInserted(ctx, tx,
+			`INSERT INTO follows (follower_id, followee_id, created_at)
+			 SELECT followers.id, followees.id, $3 FROM users AS followers, users AS followees
+			 WHERE followers.login=$1 AND followees.login=$2 AND followers.id <> followees.id
+			 ON CONFLICT DO NOTHING`,
+			follow.Follower, follow.Followee, follow.CreatedAt,
+		)
+
+	case record.Media != nil:
+		file := record.Media
+		return execInserted(ctx, tx,
+			`INSERT INTO media (id, user_id, storage_key, thumbnail_key, thumbnail_type,
+			                    content_type, size, original_name, created_at)
+			 SELECT $1, id, $3, $4, $5, $6, $7, $8, $9 FROM users WHERE login=$2
+			 ON CONFLICT (id) DO NOTHING`,
+			file.ID, file.Owner, file.StorageKey, file.ThumbnailKey, file.ThumbnailType,
+			file.ContentType, file.Size, file.Name, file.CreatedAt,
+		)
+	}
+	return false, nil
+}
+
+func execInserted(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (bool, error) {
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
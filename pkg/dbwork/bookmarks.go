@@ -0,0 +1,72 @@
+package dbwork
+
+import (
+	"context"
+	"github.com/lib/pq"
+)
+
+func (postgres *PostgresDataBase) SetBookmark(ctx context.Context, articleID int, login string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventSetBookmark, id: articleID, login: login, error: ch})
+}
+
+func (postgres *PostgresDataBase) DeleteBookmark(ctx context.Context, articleID int, login string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventDeleteBookmark, id: articleID, login: login, error: ch})
+}
+
+// GetBookmarkedIDs сообщает, какие из переданных статей есть в закладках пользователя
+func (postgres *PostgresDataBase) GetBookmarkedIDs(ctx context.Context, login string, ids []int) (map[int]bool, error) {
+	bookmarked := make(map[int]bool, len(ids))
+	if len(ids) == 0 {
+		return bookmarked, nil
+	}
+
+	articleIDs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		articleIDs = append(articleIDs, int64(id))
+	}
+
+	getBookmarksQuery := `SELECT bookmarks.article_id FROM bookmarks, users
+	                      WHERE users.login=$1 AND bookmarks.user_id=users.id
+	                        AND bookmarks.article_id = ANY($2)`
+	rows, err := postgres.db.QueryContext(ctx, getBookmarksQuery, login, pq.Array(articleIDs))
+	if err != nil {
+		return bookmarked, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return bookmarked, err
+		}
+		bookmarked[id] = true
+	}
+	return bookmarked, rows.Err()
+}
+
+// setBookmarkInDB идемпотентна: повторное добавление ничего не меняет
+func (postgres *PostgresDataBase) setBookmarkInDB(ctx context.Context, articleID int, login string) error {
+	var exists bool
+	err := postgres.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM articles WHERE id=$1)`, articleID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	setBookmarkQuery := `INSERT INTO bookmarks
+	                     (user_id, article_id)
+	                     SELECT id, $1 FROM users WHERE login=$2
+	                     ON CONFLICT DO NOTHING`
+	_, err = postgres.db.ExecContext(ctx, setBookmarkQuery, articleID, login)
+	return err
+}
+
+func (postgres *PostgresDataBase) deleteBookmarkInDB(ctx context.Context, articleID int, login string) error {
+	deleteBookmarkQuery := `DELETE FROM bookmarks
+	                        WHERE article_id=$1 AND user_id=(SELECT id FROM users WHERE login=$2)`
+	_, err := postgres.db.ExecContext(ctx, deleteBookmarkQuery, articleID, login)
+	return err
+}
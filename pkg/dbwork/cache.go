@@ -0,0 +1,170 @@
+package dbwork
+
+import (
+	"blog/pkg/cache"
+	"blog/pkg/models"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Ключ счётчика поколений. Все ключи статей включают текущее поколение,
+// поэтому любое изменение делает прежние записи недостижимыми
+const generationKey = "blog:generation"
+
+// CachedDataBase кеширует чтение статей поверх другой реализации DataBase.
+// Запись проходит в исходную реализацию, а после её завершения поколение
+// кеша увеличивается до того, как вызывающий получит результат
+type CachedDataBase struct {
+	DataBase
+	backend cache.Backend
+	ttl     time.Duration
+}
+
+func NewCachedDataBase(inner DataBase, backend cache.Backend, ttl time.Duration) *CachedDataBase {
+	return &CachedDataBase{DataBase: inner, backend: backend, ttl: ttl}
+}
+
+// InitializationCache оборачивает текущую DB кешем
+func InitializationCache(backend cache.Backend, ttl time.Duration) {
+	DB = NewCachedDataBase(DB, backend, ttl)
+}
+
+func (cached *CachedDataBase) GetArticle(ctx context.Context, id int) (models.Article, error) {
+	key := cached.key("article:" + strconv.Itoa(id))
+
+	article := models.Article{}
+	if cached.load(key, &article) {
+		return article, nil
+	}
+
+	article, err := cached.DataBase.GetArticle(ctx, id)
+	// Отсутствующая статья не кешируется, чтобы её создание было видно сразу
+	if err == nil && article.ID != 0 {
+		cached.store(key, article)
+	}
+	return article, err
+}
+
+func (cached *CachedDataBase) GetAllArticle(ctx context.Context, filter models.ArticleFilter) ([]models.Article, error) {
+	encodedFilter, err := json.Marshal(filter)
+	if err != nil {
+		return cached.DataBase.GetAllArticle(ctx, filter)
+	}
+	key := cached.key("articles:" + string(encodedFilter))
+
+	articles := make([]models.Article, 0)
+	if cached.load(key, &articles) {
+		return articles, nil
+	}
+
+	articles, err = cached.DataBase.GetAllArticle(ctx, filter)
+	if err == nil {
+		cached.store(key, articles)
+	}
+	return articles, err
+}
+
+func (cached *CachedDataBase) CreateArticle(ctx context.Context, author, text string, ch chan error) {
+	cached.DataBase.CreateArticle(ctx, author, text, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) UpdateArticle(ctx context.Context, id int, text string, expectedRevision int, ch chan error) {
+	cached.DataBase.UpdateArticle(ctx, id, text, expectedRevision, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) DeleteArticle(ctx context.Context, id int, ch chan error) {
+	cached.DataBase.DeleteArticle(ctx, id, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) SetReaction(ctx context.Context, articleID int, login, kind string, ch chan error) {
+	cached.DataBase.SetReaction(ctx, articleID, login, kind, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) DeleteReaction(ctx context.Context, articleID int, login, kind string, ch chan error) {
+	cached.DataBase.DeleteReaction(ctx, articleID, login, kind, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) SetBookmark(ctx context.Context, articleID int, login string, ch chan error) {
+	cached.DataBase.SetBookmark(ctx, articleID, login, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) DeleteBookmark(ctx context.Context, articleID int, login string, ch chan error) {
+	cached.DataBase.DeleteBookmark(ctx, articleID, login, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) Follow(ctx context.Context, follower, followee string, ch chan error) {
+	cached.DataBase.Follow(ctx, follower, followee, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) Unfollow(ctx context.Context, follower, followee string, ch chan error) {
+	cached.DataBase.Unfollow(ctx, follower, followee, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) DeleteUser(ctx context.Context, login string, ch chan error) {
+	cached.DataBase.DeleteUser(ctx, login, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) DeleteUserArticles(ctx context.Context, login string, ch chan error) {
+	cached.DataBase.DeleteUserArticles(ctx, login, cached.invalidate(ch))
+}
+
+func (cached *CachedDataBase) ImportBatch(ctx context.Context, batch *models.ImportBatch, ch chan error) {
+	cached.DataBase.ImportBatch(ctx, batch, cached.invalidate(ch))
+}
+
+// invalidate подменяет канал результата: когда управляющая горутина
+// завершит запись, поколение увеличивается, и только затем результат
+// передаётся вызывающему. Так он сразу прочитает свои изменения
+func (cached *CachedDataBase) invalidate(ch chan error) chan error {
+	result := make(chan error, 1)
+	go func() {
+		err := <-result
+		if _, incrErr := cached.backend.Incr(generationKey); incrErr != nil {
+			slog.Error("Не удалось сменить поколение кеша", "error", incrErr)
+		}
+		ch <- err
+		close(ch)
+	}()
+	return result
+}
+
+// key добавляет к ключу текущее поколение. Поколение читается до запроса
+// к БД: если запись завершится во время чтения, результат попадёт под
+// старое поколение и не будет выдан
+func (cached *CachedDataBase) key(name string) string {
+	value, ok, err := cached.backend.Get(generationKey)
+	if err != nil {
+		slog.Warn("Не удалось прочитать поколение кеша", "error", err)
+	}
+	generation := "0"
+	if ok {
+		generation = string(value)
+	}
+	return "blog:" + generation + ":" + name
+}
+
+func (cached *CachedDataBase) load(key string, target interface{}) bool {
+	value, ok, err := cached.backend.Get(key)
+	if err != nil {
+		slog.Warn("Ошибка чтения кеша", "key", key, "error", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(value, target) == nil
+}
+
+func (cached *CachedDataBase) store(key string, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		slog.Error("Не удалось сериализовать значение для кеша", "key", key, "error", err)
+		return
+	}
+	if err := cached.backend.Set(key, encoded, cached.ttl); err != nil {
+		slog.Warn("Ошибка записи в кеш", "key", key, "error", err)
+	}
+}
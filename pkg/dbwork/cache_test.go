@@ -0,0 +1,59 @@
+package dbwork
+
+import (
+	"blog/pkg/cache"
+	"blog/pkg/models"
+	"context"
+	"testing"
+	"time"
+)
+
+// articleDB хранит одну статью и считает обращения к ней
+type articleDB struct {
+	DataBase
+	article models.Article
+	reads   int
+}
+
+func (db *articleDB) GetArticle(ctx context.Context, id int) (models.Article, error) {
+	db.reads++
+	return db.article, nil
+}
+
+func (db *articleDB) UpdateArticle(ctx context.Context, id int, text string, expectedRevision int, ch chan error) {
+	db.article.Text = text
+	db.article.Revision++
+	ch <- nil
+	close(ch)
+}
+
+func TestCachedDataBaseInvalidatesAfterWrite(t *testing.T) {
+	inner := &articleDB{article: models.Article{ID: 1, Text: "old", Revision: 1}}
+	cached := NewCachedDataBase(inner, cache.NewMemory(16), time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if article, err := cached.GetArticle(ctx, 1); err != nil || article.Text != "old" {
+			t.Fatalf("GetArticle = %q, %v", article.Text, err)
+		}
+	}
+	if inner.reads != 1 {
+		t.Fatalf("second read went to the database: %d reads", inner.reads)
+	}
+
+	ch := make(chan error, 1)
+	cached.UpdateArticle(ctx, 1, "new", 1, ch)
+	if err := <-ch; err != nil {
+		t.Fatal(err)
+	}
+
+	// Результат записи приходит после смены поколения, поэтому
+	// следующее чтение уже не видит старую статью
+	article, err := cached.GetArticle(ctx, 1)
+	if err != nil || article.Text != "new" || article.Revision != 2 {
+		t.Fatalf("GetArticle after update = %q rev %d, %v", article.Text, article.Revision, err)
+	}
+	if inner.reads != 2 {
+		t.Fatalf("read after update served from cache: %d reads", inner.reads)
+	}
+}
@@ -1,18 +1,19 @@
 package dbwork
 
 import (
+	"blog/pkg/metrics"
 	"blog/pkg/models"
+	"blog/pkg/password"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
+	"log/slog"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Интерфейс для работы с БД
@@ -20,32 +21,96 @@ import (
 
 var DB DataBase
 
+var (
+	ErrNotFound = errors.New("Объект не найден")
+	// Статья изменилась после того, как клиент получил её версию
+	ErrRevisionConflict = errors.New("Статья была изменена")
+)
+
 type DataBase interface {
-	DeleteArticle(id int, ch chan error)
-	CreateArticle(author, text string, ch chan error)
-	GetArticle(id int) (models.Article, error)
-	UpdateArticle(id int, text string, ch chan error)
-	CreateUser(login, password string, ch chan error)
-	GetAllArticle() ([]models.Article, error)
-	VerifyPassword(login, password string) (bool, error)
-	VerifyArticleToUser(id int, login string) (bool, error)
+	DeleteArticle(ctx context.Context, id int, ch chan error)
+	CreateArticle(ctx context.Context, author, text string, ch chan error)
+	GetArticle(ctx context.Context, id int) (models.Article, error)
+	UpdateArticle(ctx context.Context, id int, text string, expectedRevision int, ch chan error)
+	CreateUser(ctx context.Context, login, password string, ch chan error)
+	UpdatePassword(ctx context.Context, login, password string, ch chan error)
+	GetAllArticle(ctx context.Context, filter models.ArticleFilter) ([]models.Article, error)
+	VerifyPassword(ctx context.Context, login, password string) (bool, error)
+	VerifyArticleToUser(ctx context.Context, id int, login string) (bool, error)
+	GetTOTP(ctx context.Context, login string) (models.TOTP, error)
+	SetTOTPSecret(ctx context.Context, login, secret string, ch chan error)
+	EnableTOTP(ctx context.Context, login string, recoveryHashes []string, ch chan error)
+	DisableTOTP(ctx context.Context, login string, ch chan error)
+	UseTOTPStep(ctx context.Context, login string, step int64, ch chan error)
+	UseRecoveryCode(ctx context.Context, login, codeHash string, ch chan error)
+	// CreateAPIToken после записи заполняет token.ID и token.CreatedAt
+	CreateAPIToken(ctx context.Context, login string, token *models.APIToken, tokenHash string, ch chan error)
+	GetAPITokens(ctx context.Context, login string) ([]models.APIToken, error)
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (models.APIToken, error)
+	DeleteAPIToken(ctx context.Context, login string, id int, ch chan error)
+	TouchAPIToken(ctx context.Context, id int, ch chan error)
+	GetLoginByIdentity(ctx context.Context, issuer, subject string) (string, error)
+	ProvisionExternalUser(ctx context.Context, login, issuer, subject string, link bool, ch chan error)
+	SetReaction(ctx context.Context, articleID int, login, kind string, ch chan error)
+	DeleteReaction(ctx context.Context, articleID int, login, kind string, ch chan error)
+	UserExists(ctx context.Context, login string) (bool, error)
+	Follow(ctx context.Context, follower, followee string, ch chan error)
+	Unfollow(ctx context.Context, follower, followee string, ch chan error)
+	GetFollowers(ctx context.Context, login string, limit, offset int) ([]models.Follow, error)
+	GetFollowing(ctx context.Context, login string, limit, offset int) ([]models.Follow, error)
+	SetBookmark(ctx context.Context, articleID int, login string, ch chan error)
+	DeleteBookmark(ctx context.Context, articleID int, login string, ch chan error)
+	GetBookmarkedIDs(ctx context.Context, login string, ids []int) (map[int]bool, error)
+	CreateMedia(ctx context.Context, login string, media models.Media, ch chan error)
+	GetMedia(ctx context.Context, id string) (models.Media, error)
+	GetUserMedia(ctx context.Context, login string, limit, offset int) ([]models.Media, error)
+	DeleteMedia(ctx context.Context, login, id string, ch chan error)
+	GetArticleTimestamps(ctx context.Context, limit, offset int) ([]models.Article, error)
+	GetArticlePagesModified(ctx context.Context, pageSize int) ([]time.Time, error)
+	Status(ctx context.Context) (models.DBStatus, error)
+	GetAccount(ctx context.Context, login string) (models.Account, error)
+	GetStats(ctx context.Context) (models.Stats, error)
+	SetUserDisabled(ctx context.Context, login string, disabled bool, ch chan error)
+	SetUserRole(ctx context.Context, login, role string, ch chan error)
+	DeleteUser(ctx context.Context, login string, ch chan error)
+	DeleteUserArticles(ctx context.Context, login string, ch chan error)
+	ExportContent(ctx context.Context, withPasswords bool, emit func(models.BackupRecord) error) error
+	ImportBatch(ctx context.Context, batch *models.ImportBatch, ch chan error)
 	Run()
 }
 
 type PostgresDataBase struct {
-	db     *sql.DB
+	db     *instrumentedDB
 	events chan event
+	// Последняя версия миграций в каталоге приложения
+	expectedVersion uint
+	// Работает ли управляющая горутина
+	running atomic.Bool
 }
 
 type event struct {
 	id        int
 	userID    int
+	revision  int
 	eventType eventType
 	author    string
 	text      string
 	login     string
 	password  string
+	step      int64
+	codes     []string
+	token     *models.APIToken
+	issuer    string
+	subject   string
+	link      bool
+	media     models.Media
+	role      string
+	disabled  bool
+	batch     *models.ImportBatch
 	error     chan error
+	// Контекст вызова и время постановки в очередь, нужны для трассировки
+	ctx      context.Context
+	enqueued time.Time
 }
 
 type eventType byte
@@ -56,6 +121,29 @@ const (
 	eventCreate
 	eventUpdate
 	eventCreateUser
+	eventUpdatePassword
+	eventSetTOTPSecret
+	eventEnableTOTP
+	eventDisableTOTP
+	eventUseTOTPStep
+	eventUseRecoveryCode
+	eventCreateAPIToken
+	eventDeleteAPIToken
+	eventTouchAPIToken
+	eventProvisionExternalUser
+	eventSetReaction
+	eventDeleteReaction
+	eventFollow
+	eventUnfollow
+	eventSetBookmark
+	eventDeleteBookmark
+	eventCreateMedia
+	eventDeleteMedia
+	eventSetUserDisabled
+	eventSetUserRole
+	eventDeleteUser
+	eventDeleteUserArticles
+	eventImportBatch
 )
 
 // Параметры подключения к БД
@@ -67,34 +155,34 @@ type PostgresDBParams struct {
 	Password string `json:"password"`
 	Port     int    `json:"port"`
 	SSLMode  string `json:"sslmode"`
+	// Применять новые миграции при запуске
+	AutoMigrate bool `json:"autoMigrate"`
 }
 
 func InitializationDB(config PostgresDBParams) error {
-	connStr := fmt.Sprintf(
-		"postgres://%v:%v@%v:%v/%v?sslmode=%s",
-		config.User,
-		config.Password,
-		config.Host,
-		config.Port,
-		config.DBName,
-		config.SSLMode,
-	)
-
-	db, err := sql.Open("postgres", connStr)
+	db, err := OpenDB(config)
 	if err != nil {
 		return err
 	}
 
-	if err = db.Ping(); err != nil {
+	expectedVersion, err := LatestMigration(Migrations())
+	if err != nil {
 		return err
 	}
 
 	events := make(chan event, 16)
 
-	postgres := &PostgresDataBase{db: db, events: events}
+	postgres := &PostgresDataBase{db: &instrumentedDB{DB: db}, events: events, expectedVersion: expectedVersion}
+	metrics.RegisterDB(db, func() int { return len(events) })
 
-	if err := postgres.runMigrations(); err != nil {
-		return err
+	if config.AutoMigrate {
+		if err := postgres.runMigrations(); err != nil {
+			return err
+		}
+	} else if status, err := postgres.Status(context.Background()); err == nil &&
+		(status.Dirty || status.MigrationVersion != status.ExpectedVersion) {
+		slog.Warn("Схема БД не соответствует приложению, выполните blog migrate up",
+			"version", status.MigrationVersion, "expected", status.ExpectedVersion, "dirty", status.Dirty)
 	}
 
 	DB = postgres
@@ -102,70 +190,68 @@ func InitializationDB(config PostgresDBParams) error {
 	return nil
 }
 
-func (postgre PostgresDataBase) runMigrations() error {
-	driver, err := postgres.WithInstance(postgre.db, &postgres.Config{})
-	if err != nil {
-		return err
-	}
+// OpenDB подключается к БД и проверяет соединение
+func OpenDB(config PostgresDBParams) (*sql.DB, error) {
+	connStr := fmt.Sprintf(
+		"postgres://%v:%v@%v:%v/%v?sslmode=%s",
+		config.User,
+		config.Password,
+		config.Host,
+		config.Port,
+		config.DBName,
+		config.SSLMode,
+	)
 
-	wd, err := os.Getwd()
+	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	path := "file://" + filepath.Join(wd, "pkg/dbwork/migrations")
-
-	m, err := migrate.NewWithDatabaseInstance(
-		path,
-		"postgres", driver,
-	)
-	if err != nil {
-		return err
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
+	return db, nil
+}
 
-	version, dirty, err := m.Version()
-	if err != nil && err != migrate.ErrNilVersion {
+// runMigrations применяет новые миграции при запуске. Незавершённая
+// миграция не исправляется автоматически: схему нужно проверить вручную
+// и выполнить blog migrate force
+func (postgres *PostgresDataBase) runMigrations() error {
+	m, err := NewMigrate(postgres.db.DB)
+	if err != nil {
 		return err
 	}
 
-	if dirty {
-		if err := m.Force(int(version)); err != nil {
-			return err
-		}
+	err = m.Up()
+	var dirtyErr migrate.ErrDirty
+	if errors.As(err, &dirtyErr) {
+		return fmt.Errorf("%w: миграция %d не завершена, проверьте схему и выполните blog migrate force", err, dirtyErr.Version)
 	}
-
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		if dirtyErr, ok := err.(migrate.ErrDirty); ok {
-			if err := m.Force(int(dirtyErr.Version)); err != nil {
-				return err
-			}
-			if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-				return err
-			}
-		}
+	if err != nil && err != migrate.ErrNoChange {
 		return err
 	}
 	return nil
 }
 
-func (postgres *PostgresDataBase) DeleteArticle(id int, ch chan error) {
-	postgres.events <- event{eventType: eventDelete, id: id, error: ch}
+func (postgres *PostgresDataBase) DeleteArticle(ctx context.Context, id int, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventDelete, id: id, error: ch})
 }
 
-func (postgres *PostgresDataBase) CreateArticle(author, text string, ch chan error) {
-	id, err := postgres.getUserID(author)
+func (postgres *PostgresDataBase) CreateArticle(ctx context.Context, author, text string, ch chan error) {
+	id, err := postgres.getUserID(ctx, author)
 	if err != nil {
 		ch <- err
-		log.Println(err)
+		slog.Error("CreateArticle: поиск автора", "error", err)
 		return
 	}
-	postgres.events <- event{eventType: eventCreate, userID: id, text: text, error: ch}
+	postgres.enqueue(ctx, event{eventType: eventCreate, userID: id, text: text, error: ch})
 }
 
-func (postgres *PostgresDataBase) getUserID(login string) (int, error) {
+func (postgres *PostgresDataBase) getUserID(ctx context.Context, login string) (int, error) {
 	id := -1
 	getUserQuery := `SELECT id FROM users WHERE login=$1`
-	rows, err := postgres.db.Query(getUserQuery, login)
+	rows, err := postgres.db.QueryContext(ctx, getUserQuery, login)
 	if err != nil {
 		return id, err
 	}
@@ -180,9 +266,9 @@ func (postgres *PostgresDataBase) getUserID(login string) (int, error) {
 	return id, err
 }
 
-func (postgres *PostgresDataBase) VerifyArticleToUser(id int, login string) (bool, error) {
+func (postgres *PostgresDataBase) VerifyArticleToUser(ctx context.Context, id int, login string) (bool, error) {
 	getQuery := `SELECT articles.id FROM users, articles WHERE users.login=$1 AND users.id = articles.user_id AND articles.id = $2`
-	rows, err := postgres.db.Query(getQuery, login, id)
+	rows, err := postgres.db.QueryContext(ctx, getQuery, login, id)
 	if err != nil {
 		return false, err
 	}
@@ -200,29 +286,81 @@ func (postgres *PostgresDataBase) VerifyArticleToUser(id int, login string) (boo
 	return temp == id, nil
 }
 
-func (postgres *PostgresDataBase) GetArticle(id int) (models.Article, error) {
-	getArticleQuery := `SELECT articles.id, articles.text, users.login  FROM articles, users WHERE articles.id=$1 AND articles.user_id=users.id`
+func (postgres *PostgresDataBase) GetArticle(ctx context.Context, id int) (models.Article, error) {
+	getArticleQuery := `SELECT articles.id, articles.text, users.login, articles.created_at, articles.updated_at, articles.revision
+	                    FROM articles, users WHERE articles.id=$1 AND articles.user_id=users.id`
 	article := models.Article{}
 
-	rows, err := postgres.db.Query(getArticleQuery, id)
+	rows, err := postgres.db.QueryContext(ctx, getArticleQuery, id)
 	if err != nil {
 		return article, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		err = rows.Scan(&article.ID, &article.Text, &article.Author)
+		err = rows.Scan(&article.ID, &article.Text, &article.Author, &article.CreatedAt, &article.UpdatedAt, &article.Revision)
 		if err != nil {
 			return article, err
 		}
 	}
-	return article, nil
+
+	articles := []models.Article{article}
+	err = postgres.fillReactions(ctx, articles)
+	return articles[0], err
 }
 
-func (postgres *PostgresDataBase) GetAllArticle() ([]models.Article, error) {
-	getArticleQuery := `SELECT articles.id, articles.text, users.login  FROM articles, users WHERE articles.user_id = users.id`
+func (postgres *PostgresDataBase) GetAllArticle(ctx context.Context, filter models.ArticleFilter) ([]models.Article, error) {
+	getArticleQuery := `SELECT articles.id, articles.text, users.login, articles.created_at, articles.updated_at, articles.revision
+	                    FROM articles, users WHERE articles.user_id = users.id`
+	args := make([]interface{}, 0)
+
+	if filter.BookmarkedBy != "" {
+		args = append(args, filter.BookmarkedBy)
+		getArticleQuery = fmt.Sprintf(`SELECT articles.id, articles.text, users.login, articles.created_at, articles.updated_at, articles.revision
+		                    FROM articles, users, bookmarks, users AS readers
+		                    WHERE articles.user_id = users.id
+		                      AND bookmarks.article_id = articles.id AND bookmarks.user_id = readers.id
+		                      AND readers.login = $%d`, len(args))
+	}
+
+	if filter.FollowedBy != "" {
+		args = append(args, filter.FollowedBy)
+		getArticleQuery += fmt.Sprintf(` AND articles.user_id IN (
+		                                   SELECT follows.followee_id FROM follows, users AS followers
+		                                   WHERE followers.login = $%d AND follows.follower_id = followers.id)`, len(args))
+	}
+
+	if filter.Author != "" {
+		args = append(args, filter.Author)
+		getArticleQuery += fmt.Sprintf(` AND users.login = $%d`, len(args))
+	}
+
+	switch filter.Sort {
+	case models.SortMostLiked:
+		getArticleQuery += ` ORDER BY (SELECT COUNT(*) FROM article_reactions
+		                               WHERE article_reactions.article_id = articles.id
+		                                 AND article_reactions.kind = 'like') DESC, articles.id DESC`
+	case models.SortNewest:
+		getArticleQuery += ` ORDER BY articles.created_at DESC, articles.id DESC`
+	default:
+		if filter.BookmarkedBy != "" {
+			getArticleQuery += ` ORDER BY bookmarks.created_at DESC, articles.id DESC`
+		} else {
+			getArticleQuery += ` ORDER BY articles.id`
+		}
+	}
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		getArticleQuery += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		getArticleQuery += fmt.Sprintf(` OFFSET $%d`, len(args))
+	}
+
 	articles := make([]models.Article, 0)
-	rows, err := postgres.db.Query(getArticleQuery)
+	rows, err := postgres.db.QueryContext(ctx, getArticleQuery, args...)
 	if err != nil {
 		return articles, err
 	}
@@ -230,19 +368,21 @@ func (postgres *PostgresDataBase) GetAllArticle() ([]models.Article, error) {
 
 	for rows.Next() {
 		temp := models.Article{}
-		err = rows.Scan(&temp.ID, &temp.Text, &temp.Author)
+		err = rows.Scan(&temp.ID, &temp.Text, &temp.Author, &temp.CreatedAt, &temp.UpdatedAt, &temp.Revision)
 		if err != nil {
 			return articles, err
 		}
 		articles = append(articles, temp)
 	}
-	return articles, nil
+
+	err = postgres.fillReactions(ctx, articles)
+	return articles, err
 }
 
-func (postgres *PostgresDataBase) getUserName(id int) (string, error) {
+func (postgres *PostgresDataBase) getUserName(ctx context.Context, id int) (string, error) {
 	getUserQuery := `SELECT login FROM users WHERE id=$1`
 	name := "None"
-	rows, err := postgres.db.Query(getUserQuery, id)
+	rows, err := postgres.db.QueryContext(ctx, getUserQuery, id)
 	if err != nil {
 		return name, err
 	}
@@ -257,117 +397,193 @@ func (postgres *PostgresDataBase) getUserName(id int) (string, error) {
 	return name, err
 }
 
-func (postgres *PostgresDataBase) UpdateArticle(id int, text string, ch chan error) {
-	postgres.events <- event{eventType: eventUpdate, id: id, text: text, error: ch}
+// UpdateArticle меняет текст статьи. Если expectedRevision больше нуля,
+// изменение применяется только к этой ревизии, иначе возвращается ErrRevisionConflict
+func (postgres *PostgresDataBase) UpdateArticle(ctx context.Context, id int, text string, expectedRevision int, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventUpdate, id: id, text: text, revision: expectedRevision, error: ch})
 }
 
-func (postgres *PostgresDataBase) CreateUser(login, password string, ch chan error) {
-	postgres.events <- event{eventType: eventCreateUser, login: login, password: password, error: ch}
+// Хеширование выполняется до постановки в очередь, чтобы не задерживать управляющую горутину
+func (postgres *PostgresDataBase) CreateUser(ctx context.Context, login, plainPassword string, ch chan error) {
+	hashPassword, err := password.Hash(plainPassword)
+	if err != nil {
+		ch <- err
+		slog.Error("Ошибка хеширования пароля", "error", err)
+		return
+	}
+	postgres.enqueue(ctx, event{eventType: eventCreateUser, login: login, password: hashPassword, error: ch})
+}
+
+func (postgres *PostgresDataBase) UpdatePassword(ctx context.Context, login, plainPassword string, ch chan error) {
+	hashPassword, err := password.Hash(plainPassword)
+	if err != nil {
+		ch <- err
+		slog.Error("Ошибка хеширования пароля", "error", err)
+		return
+	}
+	postgres.enqueue(ctx, event{eventType: eventUpdatePassword, login: login, password: hashPassword, error: ch})
 }
 
 func (postgres *PostgresDataBase) Run() {
+	postgres.running.Store(true)
 	go func() {
 		defer postgres.db.Close()
-		defer log.Println("Управляющая горутина заверишлась")
+		defer postgres.running.Store(false)
+		defer slog.Info("Управляющая горутина завершилась")
 		for event := range postgres.events {
+			start := time.Now()
+			ctx, span := traceEvent(event, start)
+			var err error
 			switch event.eventType {
 			case eventDelete:
-				err := postgres.deleteAticleInDB(event.id)
-				if err != nil {
-					log.Println(err)
-				}
-				event.error <- err
-				close(event.error)
+				err = postgres.deleteAticleInDB(ctx, event.id)
 			case eventCreate:
-				err := postgres.createArticleInDB(event.userID, event.text)
-				if err != nil {
-					log.Println(err)
-				}
-				event.error <- err
-				close(event.error)
-
+				err = postgres.createArticleInDB(ctx, event.userID, event.text)
 			case eventUpdate:
-				err := postgres.updateArticleInDB(event.id, event.text)
-				if err != nil {
-					log.Println(err)
-				}
-				event.error <- err
-				close(event.error)
+				err = postgres.updateArticleInDB(ctx, event.id, event.text, event.revision)
 			case eventCreateUser:
-				err := postgres.createUserInDB(event.login, event.password)
-				if err != nil {
-					log.Println(err)
-				}
-				event.error <- err
-				close(event.error)
+				err = postgres.createUserInDB(ctx, event.login, event.password)
+			case eventUpdatePassword:
+				err = postgres.updatePasswordInDB(ctx, event.login, event.password)
+			case eventSetTOTPSecret:
+				err = postgres.setTOTPSecretInDB(ctx, event.login, event.text)
+			case eventEnableTOTP:
+				err = postgres.enableTOTPInDB(ctx, event.login, event.codes)
+			case eventDisableTOTP:
+				err = postgres.disableTOTPInDB(ctx, event.login)
+			case eventUseTOTPStep:
+				err = postgres.useTOTPStepInDB(ctx, event.login, event.step)
+			case eventUseRecoveryCode:
+				err = postgres.useRecoveryCodeInDB(ctx, event.login, event.text)
+			case eventCreateAPIToken:
+				err = postgres.createAPITokenInDB(ctx, event.login, event.token, event.text)
+			case eventDeleteAPIToken:
+				err = postgres.deleteAPITokenInDB(ctx, event.login, event.id)
+			case eventTouchAPIToken:
+				err = postgres.touchAPITokenInDB(ctx, event.id)
+			case eventProvisionExternalUser:
+				err = postgres.provisionExternalUserInDB(ctx, event.login, event.issuer, event.subject, event.link)
+			case eventSetReaction:
+				err = postgres.setReactionInDB(ctx, event.id, event.login, event.text)
+			case eventDeleteReaction:
+				err = postgres.deleteReactionInDB(ctx, event.id, event.login, event.text)
+			case eventFollow:
+				err = postgres.followInDB(ctx, event.login, event.author)
+			case eventUnfollow:
+				err = postgres.unfollowInDB(ctx, event.login, event.author)
+			case eventSetBookmark:
+				err = postgres.setBookmarkInDB(ctx, event.id, event.login)
+			case eventDeleteBookmark:
+				err = postgres.deleteBookmarkInDB(ctx, event.id, event.login)
+			case eventCreateMedia:
+				err = postgres.createMediaInDB(ctx, event.login, event.media)
+			case eventDeleteMedia:
+				err = postgres.deleteMediaInDB(ctx, event.login, event.text)
+			case eventSetUserDisabled:
+				err = postgres.setUserDisabledInDB(ctx, event.login, event.disabled)
+			case eventSetUserRole:
+				err = postgres.setUserRoleInDB(ctx, event.login, event.role)
+			case eventDeleteUser:
+				err = postgres.deleteUserInDB(ctx, event.login)
+			case eventDeleteUserArticles:
+				err = postgres.deleteUserArticlesInDB(ctx, event.login)
+			case eventImportBatch:
+				err = postgres.importBatchInDB(ctx, event.batch)
+			default:
+				err = fmt.Errorf("Неизвестное событие %d", event.eventType)
+			}
+			if err != nil {
+				slog.Error("Ошибка записи в БД", "event", event.eventType.String(), "error", err)
 			}
+			event.error <- err
+			close(event.error)
+			span.End()
+			metrics.ObserveEvent(event.eventType.String(), time.Since(start))
 		}
 	}()
 }
 
-func (postgres *PostgresDataBase) deleteAticleInDB(id int) error {
+func (postgres *PostgresDataBase) deleteAticleInDB(ctx context.Context, id int) error {
 	deleteArticleQuery := `DELETE FROM articles WHERE id = $1`
-	_, err := postgres.db.Exec(deleteArticleQuery, id)
+	_, err := postgres.db.ExecContext(ctx, deleteArticleQuery, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (postgres *PostgresDataBase) createArticleInDB(userID int, text string) error {
+func (postgres *PostgresDataBase) createArticleInDB(ctx context.Context, userID int, text string) error {
 	createArticleQuery := `INSERT INTO articles
 	                        (user_id, text)
 	                        VALUES($1, $2)`
-	_, err := postgres.db.Exec(createArticleQuery, userID, text)
+	_, err := postgres.db.ExecContext(ctx, createArticleQuery, userID, text)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (postgres *PostgresDataBase) updateArticleInDB(id int, text string) error {
+func (postgres *PostgresDataBase) updateArticleInDB(ctx context.Context, id int, text string, expectedRevision int) error {
 	updateArticleQuery := `UPDATE articles
-	                       SET text=$1
-	                       WHERE id=$2`
-	_, err := postgres.db.Exec(updateArticleQuery, text, id)
+	                       SET text=$1, updated_at=NOW(), revision=revision+1
+	                       WHERE id=$2 AND ($3 = 0 OR revision=$3)`
+	result, err := postgres.db.ExecContext(ctx, updateArticleQuery, text, id, expectedRevision)
 	if err != nil {
 		return err
 	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 && expectedRevision > 0 {
+		return ErrRevisionConflict
+	}
 	return nil
 }
 
-func (postgres *PostgresDataBase) createUserInDB(login, password string) error {
+func (postgres *PostgresDataBase) createUserInDB(ctx context.Context, login, hashPassword string) error {
 	createUserQuery := `INSERT INTO users
                      (login, password)
                      VALUES($1, $2);`
-	id, err := postgres.getUserID(login)
+	id, err := postgres.getUserID(ctx, login)
 	if err != nil {
 		return err
 	}
 	if id != -1 {
 		return fmt.Errorf("Аккаунт с таким логином уже существует")
 	}
-	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	_, err = postgres.db.ExecContext(ctx, createUserQuery, login, hashPassword)
 	if err != nil {
 		return err
 	}
-	_, err = postgres.db.Exec(createUserQuery, login, hashPassword)
+	return nil
+}
+
+func (postgres *PostgresDataBase) updatePasswordInDB(ctx context.Context, login, hashPassword string) error {
+	updatePasswordQuery := `UPDATE users
+	                        SET password=$1
+	                        WHERE login=$2`
+	_, err := postgres.db.ExecContext(ctx, updatePasswordQuery, hashPassword, login)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (postgres *PostgresDataBase) VerifyPassword(login, password string) (bool, error) {
-	getUserQuery := `SELECT password FROM users WHERE login=$1`
+// VerifyPassword проверяет пароль и, если хеш устарел (bcrypt или старые
+// параметры argon2id), пересчитывает его в фоне
+func (postgres *PostgresDataBase) VerifyPassword(ctx context.Context, login, plainPassword string) (bool, error) {
+	// Заблокированный пользователь проверяется так же, как несуществующий
+	getUserQuery := `SELECT password FROM users WHERE login=$1 AND disabled_at IS NULL`
 
-	rows, err := postgres.db.Query(getUserQuery, login)
+	rows, err := postgres.db.QueryContext(ctx, getUserQuery, login)
 	if err != nil {
 		return false, err
 	}
 	defer rows.Close()
 
-	var realPassword []byte
+	var realPassword sql.NullString
 
 	for rows.Next() {
 		err = rows.Scan(&realPassword)
@@ -376,7 +592,22 @@ func (postgres *PostgresDataBase) VerifyPassword(login, password string) (bool,
 		}
 	}
 
-	err = bcrypt.CompareHashAndPassword(realPassword, []byte(password))
+	// Пользователи, созданные через внешнего провайдера, не имеют локального пароля
+	if !realPassword.Valid {
+		password.VerifyDummy(plainPassword)
+		return false, nil
+	}
+
+	ok, rehash, err := password.Verify(realPassword.String, plainPassword)
+	if err != nil {
+		return false, err
+	}
+
+	// Хеширование занимает заметное время, поэтому вход его не ждёт,
+	// а завершение запроса не отменяет запись
+	if ok && rehash {
+		go postgres.UpdatePassword(context.WithoutCancel(ctx), login, plainPassword, make(chan error, 1))
+	}
 
-	return err == nil, nil
+	return ok, nil
 }
@@ -0,0 +1,88 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+)
+
+func (postgres *PostgresDataBase) UserExists(ctx context.Context, login string) (bool, error) {
+	id, err := postgres.getUserID(ctx, login)
+	return id != -1, err
+}
+
+func (postgres *PostgresDataBase) Follow(ctx context.Context, follower, followee string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventFollow, login: follower, author: followee, error: ch})
+}
+
+func (postgres *PostgresDataBase) Unfollow(ctx context.Context, follower, followee string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventUnfollow, login: follower, author: followee, error: ch})
+}
+
+func (postgres *PostgresDataBase) GetFollowers(ctx context.Context, login string, limit, offset int) ([]models.Follow, error) {
+	getFollowersQuery := `SELECT followers.login, follows.created_at
+	                      FROM follows, users AS followers, users AS followees
+	                      WHERE followees.login=$1 AND follows.followee_id=followees.id
+	                        AND follows.follower_id=followers.id
+	                      ORDER BY follows.created_at DESC
+	                      LIMIT $2 OFFSET $3`
+	return postgres.queryFollows(ctx, getFollowersQuery, login, limit, offset)
+}
+
+func (postgres *PostgresDataBase) GetFollowing(ctx context.Context, login string, limit, offset int) ([]models.Follow, error) {
+	getFollowingQuery := `SELECT followees.login, follows.created_at
+	                      FROM follows, users AS followers, users AS followees
+	                      WHERE followers.login=$1 AND follows.follower_id=followers.id
+	                        AND follows.followee_id=followees.id
+	                      ORDER BY follows.created_at DESC
+	                      LIMIT $2 OFFSET $3`
+	return postgres.queryFollows(ctx, getFollowingQuery, login, limit, offset)
+}
+
+func (postgres *PostgresDataBase) queryFollows(ctx context.Context, query, login string, limit, offset int) ([]models.Follow, error) {
+	follows := make([]models.Follow, 0)
+	rows, err := postgres.db.QueryContext(ctx, query, login, limit, offset)
+	if err != nil {
+		return follows, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		temp := models.Follow{}
+		err = rows.Scan(&temp.Login, &temp.Since)
+		if err != nil {
+			return follows, err
+		}
+		follows = append(follows, temp)
+	}
+	return follows, rows.Err()
+}
+
+// followInDB идемпотентна: повторная подписка ничего не меняет
+func (postgres *PostgresDataBase) followInDB(ctx context.Context, follower, followee string) error {
+	followerID, err := postgres.getUserID(ctx, follower)
+	if err != nil {
+		return err
+	}
+	followeeID, err := postgres.getUserID(ctx, followee)
+	if err != nil {
+		return err
+	}
+	if followerID == -1 || followeeID == -1 {
+		return ErrNotFound
+	}
+
+	followQuery := `INSERT INTO follows
+	                (follower_id, followee_id)
+	                VALUES($1, $2)
+	                ON CONFLICT DO NOTHING`
+	_, err = postgres.db.ExecContext(ctx, followQuery, followerID, followeeID)
+	return err
+}
+
+func (postgres *PostgresDataBase) unfollowInDB(ctx context.Context, follower, followee string) error {
+	unfollowQuery := `DELETE FROM follows
+	                  WHERE follower_id=(SELECT id FROM users WHERE login=$1)
+	                    AND followee_id=(SELECT id FROM users WHERE login=$2)`
+	_, err := postgres.db.ExecContext(ctx, unfollowQuery, follower, followee)
+	return err
+}
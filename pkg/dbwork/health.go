@@ -0,0 +1,29 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+	"database/sql"
+)
+
+// Status проверяет соединение с БД и возвращает версию схемы
+// и состояние очереди управляющей горутины
+func (postgres *PostgresDataBase) Status(ctx context.Context) (models.DBStatus, error) {
+	status := models.DBStatus{
+		ExpectedVersion: postgres.expectedVersion,
+		WriterRunning:   postgres.running.Load(),
+		QueueLength:     len(postgres.events),
+		QueueCapacity:   cap(postgres.events),
+	}
+
+	if err := postgres.db.PingContext(ctx); err != nil {
+		return status, err
+	}
+
+	getVersionQuery := `SELECT version, dirty FROM schema_migrations LIMIT 1`
+	err := postgres.db.QueryRowContext(ctx, getVersionQuery).Scan(&status.MigrationVersion, &status.Dirty)
+	if err == sql.ErrNoRows {
+		return status, nil
+	}
+	return status, err
+}
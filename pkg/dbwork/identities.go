@@ -0,0 +1,116 @@
+package dbwork
+
+import (
+	"blog/pkg/password"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrIdentityLinked = errors.New("Учётную запись провайдера нельзя привязать к этому пользователю")
+
+func (postgres *PostgresDataBase) GetLoginByIdentity(ctx context.Context, issuer, subject string) (string, error) {
+	getLoginQuery := `SELECT users.login FROM users, user_identities
+	                  WHERE user_identities.issuer=$1 AND user_identities.subject=$2
+	                    AND user_identities.user_id=users.id`
+	login := ""
+	err := postgres.db.QueryRowContext(ctx, getLoginQuery, issuer, subject).Scan(&login)
+	if err == sql.ErrNoRows {
+		return login, ErrNotFound
+	}
+	return login, err
+}
+
+// ProvisionExternalUser связывает внешнюю учётную запись с пользователем login,
+// если link, и иначе создаёт для неё пользователя без локального пароля
+func (postgres *PostgresDataBase) ProvisionExternalUser(ctx context.Context, login, issuer, subject string, link bool, ch chan error) {
+	postgres.enqueue(ctx, event{
+		eventType: eventProvisionExternalUser,
+		login:     login,
+		issuer:    issuer,
+		subject:   subject,
+		link:      link,
+		error:     ch,
+	})
+}
+
+func (postgres *PostgresDataBase) provisionExternalUserInDB(ctx context.Context, login, issuer, subject string, link bool) error {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM user_identities WHERE issuer=$1 AND subject=$2)`,
+		issuer, subject,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	userID := -1
+	if link {
+		err = tx.QueryRowContext(ctx,
+			`SELECT id FROM users WHERE login=$1
+			 AND NOT EXISTS(SELECT 1 FROM user_identities WHERE user_id=users.id AND issuer=$2)`,
+			login, issuer,
+		).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return ErrIdentityLinked
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if userID == -1 {
+		freeLogin, err := findFreeLogin(ctx, tx, login)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, `INSERT INTO users (login) VALUES($1) RETURNING id`, freeLogin).Scan(&userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_identities (user_id, issuer, subject) VALUES($1, $2, $3)`,
+		userID, issuer, subject,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// findFreeLogin добавляет к логину числовой суффикс, пока не найдёт свободный
+func findFreeLogin(ctx context.Context, tx *sql.Tx, login string) (string, error) {
+	maxLength := password.CurrentPolicy().LoginMaxLength
+	candidate := login
+
+	for i := 2; i < 1000; i++ {
+		var taken bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE login=$1)`, candidate).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		suffix := fmt.Sprint(i)
+		base := login
+		if len(base)+len(suffix) > maxLength {
+			base = base[:maxLength-len(suffix)]
+		}
+		candidate = base + suffix
+	}
+	return "", fmt.Errorf("Не удалось подобрать свободный логин для %s", login)
+}
@@ -0,0 +1,90 @@
+package dbwork
+
+import (
+	"blog/pkg/metrics"
+	"context"
+	"database/sql"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// instrumentedDB замеряет время запросов и подписывает их именем
+// вызвавшего метода dbwork, например GetArticle
+type instrumentedDB struct {
+	*sql.DB
+}
+
+func (db *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(time.Now())
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer observeQuery(time.Now())
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(time.Now())
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func observeQuery(start time.Time) {
+	metrics.ObserveQuery(callerName(), time.Since(start))
+}
+
+// callerName возвращает имя метода, из которого выполнен запрос
+func callerName() string {
+	// observeQuery, метод instrumentedDB и вызывающий метод
+	pc, _, _, ok := runtime.Caller(3)
+	if !ok {
+		return "unknown"
+	}
+	function := runtime.FuncForPC(pc)
+	if function == nil {
+		return "unknown"
+	}
+	name := function.Name()
+	if index := strings.LastIndex(name, "."); index >= 0 {
+		name = name[index+1:]
+	}
+	return name
+}
+
+var eventNames = map[eventType]string{
+	eventDelete:                "delete_article",
+	eventCreate:                "create_article",
+	eventUpdate:                "update_article",
+	eventCreateUser:            "create_user",
+	eventUpdatePassword:        "update_password",
+	eventSetTOTPSecret:         "set_totp_secret",
+	eventEnableTOTP:            "enable_totp",
+	eventDisableTOTP:           "disable_totp",
+	eventUseTOTPStep:           "use_totp_step",
+	eventUseRecoveryCode:       "use_recovery_code",
+	eventCreateAPIToken:        "create_api_token",
+	eventDeleteAPIToken:        "delete_api_token",
+	eventTouchAPIToken:         "touch_api_token",
+	eventProvisionExternalUser: "provision_external_user",
+	eventSetReaction:           "set_reaction",
+	eventDeleteReaction:        "delete_reaction",
+	eventFollow:                "follow",
+	eventUnfollow:              "unfollow",
+	eventSetBookmark:           "set_bookmark",
+	eventDeleteBookmark:        "delete_bookmark",
+	eventCreateMedia:           "create_media",
+	eventDeleteMedia:           "delete_media",
+	eventSetUserDisabled:       "set_user_disabled",
+	eventSetUserRole:           "set_user_role",
+	eventDeleteUser:            "delete_user",
+	eventDeleteUserArticles:    "delete_user_articles",
+	eventImportBatch:           "import_batch",
+}
+
+func (t eventType) String() string {
+	if name, ok := eventNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,100 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+	"database/sql"
+)
+
+func (postgres *PostgresDataBase) CreateMedia(ctx context.Context, login string, media models.Media, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventCreateMedia, login: login, media: media, error: ch})
+}
+
+func (postgres *PostgresDataBase) DeleteMedia(ctx context.Context, login, id string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventDeleteMedia, login: login, text: id, error: ch})
+}
+
+func (postgres *PostgresDataBase) GetMedia(ctx context.Context, id string) (models.Media, error) {
+	getMediaQuery := `SELECT media.id, users.login, media.content_type, media.size, media.original_name,
+	                         media.created_at, media.storage_key, media.thumbnail_key, media.thumbnail_type
+	                  FROM media, users
+	                  WHERE media.id=$1 AND media.user_id=users.id`
+	media := models.Media{}
+
+	err := postgres.db.QueryRowContext(ctx, getMediaQuery, id).Scan(
+		&media.ID, &media.Owner, &media.ContentType, &media.Size, &media.Name,
+		&media.CreatedAt, &media.StorageKey, &media.ThumbnailKey, &media.ThumbnailType,
+	)
+	if err == sql.ErrNoRows {
+		return media, ErrNotFound
+	}
+	return media, err
+}
+
+func (postgres *PostgresDataBase) GetUserMedia(ctx context.Context, login string, limit, offset int) ([]models.Media, error) {
+	getMediaQuery := `SELECT media.id, users.login, media.content_type, media.size, media.original_name,
+	                         media.created_at, media.storage_key, media.thumbnail_key, media.thumbnail_type
+	                  FROM media, users
+	                  WHERE users.login=$1 AND media.user_id=users.id
+	                  ORDER BY media.created_at DESC
+	                  LIMIT $2 OFFSET $3`
+	result := make([]models.Media, 0)
+
+	rows, err := postgres.db.QueryContext(ctx, getMediaQuery, login, limit, offset)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		temp := models.Media{}
+		err = rows.Scan(
+			&temp.ID, &temp.Owner, &temp.ContentType, &temp.Size, &temp.Name,
+			&temp.CreatedAt, &temp.StorageKey, &temp.ThumbnailKey, &temp.ThumbnailType,
+		)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, temp)
+	}
+	return result, rows.Err()
+}
+
+func (postgres *PostgresDataBase) createMediaInDB(ctx context.Context, login string, media models.Media) error {
+	userID, err := postgres.getUserID(ctx, login)
+	if err != nil {
+		return err
+	}
+	if userID == -1 {
+		return ErrNotFound
+	}
+
+	createMediaQuery := `INSERT INTO media
+	                     (id, user_id, storage_key, thumbnail_key, thumbnail_type, content_type, size, original_name)
+	                     VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = postgres.db.ExecContext(ctx,
+		createMediaQuery,
+		media.ID, userID, media.StorageKey, media.ThumbnailKey, media.ThumbnailType,
+		media.ContentType, media.Size, media.Name,
+	)
+	return err
+}
+
+// deleteMediaInDB удаляет только файл, принадлежащий пользователю
+func (postgres *PostgresDataBase) deleteMediaInDB(ctx context.Context, login, id string) error {
+	deleteMediaQuery := `DELETE FROM media
+	                     WHERE id=$1 AND user_id=(SELECT id FROM users WHERE login=$2)`
+	result, err := postgres.db.ExecContext(ctx, deleteMediaQuery, id, login)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
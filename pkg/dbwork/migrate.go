@@ -0,0 +1,68 @@
+package dbwork
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Миграции встроены в бинарный файл, поэтому он не зависит от рабочего каталога
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations возвращает встроенные миграции
+func Migrations() fs.FS {
+	migrations, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+// NewMigrate создаёт мигратор встроенных миграций для подключения db.
+// Close у мигратора закрывает и само подключение
+func NewMigrate(db *sql.DB) (*migrate.Migrate, error) {
+	source, err := iofs.New(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithInstance("iofs", source, "postgres", driver)
+}
+
+// LatestMigration находит наибольший номер миграции вида N_name.up.sql
+func LatestMigration(migrations fs.FS) (uint, error) {
+	entries, err := fs.ReadDir(migrations, ".")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		number, _, found := strings.Cut(name, "_")
+		if !found {
+			continue
+		}
+		version, err := strconv.ParseUint(number, 10, 64)
+		if err != nil {
+			continue
+		}
+		latest = max(latest, uint(version))
+	}
+	return latest, nil
+}
@@ -0,0 +1,4 @@
+ALTER TABLE articles
+  ADD COLUMN uid UUID NOT NULL DEFAULT gen_random_uuid();
+
+CREATE UNIQUE INDEX articles_uid_idx ON articles(uid);
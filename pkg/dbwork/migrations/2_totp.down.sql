@@ -0,0 +1,5 @@
+DROP TABLE recovery_codes;
+ALTER TABLE users
+  DROP COLUMN totp_secret,
+  DROP COLUMN totp_enabled,
+  DROP COLUMN totp_last_step;
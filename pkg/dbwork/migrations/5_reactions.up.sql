@@ -0,0 +1,9 @@
+CREATE TABLE article_reactions(
+  article_id BIGINT NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(article_id, user_id, kind)
+);
+
+CREATE INDEX article_reactions_kind_idx ON article_reactions(kind, article_id);
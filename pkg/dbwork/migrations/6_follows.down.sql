@@ -0,0 +1,5 @@
+DROP TABLE follows;
+DROP INDEX articles_user_id_created_at_idx;
+ALTER TABLE articles
+  DROP COLUMN created_at,
+  DROP COLUMN updated_at;
@@ -0,0 +1,2 @@
+ALTER TABLE articles
+  DROP COLUMN revision;
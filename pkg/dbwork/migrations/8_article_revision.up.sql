@@ -0,0 +1,2 @@
+ALTER TABLE articles
+  ADD COLUMN revision INT NOT NULL DEFAULT 1;
@@ -0,0 +1,77 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+
+	"github.com/lib/pq"
+)
+
+func (postgres *PostgresDataBase) SetReaction(ctx context.Context, articleID int, login, kind string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventSetReaction, id: articleID, login: login, text: kind, error: ch})
+}
+
+func (postgres *PostgresDataBase) DeleteReaction(ctx context.Context, articleID int, login, kind string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventDeleteReaction, id: articleID, login: login, text: kind, error: ch})
+}
+
+// fillReactions одним запросом подсчитывает реакции для всех переданных статей
+func (postgres *PostgresDataBase) fillReactions(ctx context.Context, articles []models.Article) error {
+	ids := make([]int64, 0, len(articles))
+	index := make(map[int]int, len(articles))
+	for i := range articles {
+		articles[i].Reactions = make(map[string]int)
+		ids = append(ids, int64(articles[i].ID))
+		index[articles[i].ID] = i
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	countQuery := `SELECT article_id, kind, COUNT(*) FROM article_reactions
+	               WHERE article_id = ANY($1)
+	               GROUP BY article_id, kind`
+	rows, err := postgres.db.QueryContext(ctx, countQuery, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		var kind string
+		err = rows.Scan(&id, &kind, &count)
+		if err != nil {
+			return err
+		}
+		articles[index[id]].Reactions[kind] = count
+	}
+	return rows.Err()
+}
+
+// setReactionInDB идемпотентна: повторная реакция того же вида ничего не меняет
+func (postgres *PostgresDataBase) setReactionInDB(ctx context.Context, articleID int, login, kind string) error {
+	var exists bool
+	err := postgres.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM articles WHERE id=$1)`, articleID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	setReactionQuery := `INSERT INTO article_reactions
+	                     (article_id, user_id, kind)
+	                     SELECT $1, id, $3 FROM users WHERE login=$2
+	                     ON CONFLICT DO NOTHING`
+	_, err = postgres.db.ExecContext(ctx, setReactionQuery, articleID, login, kind)
+	return err
+}
+
+func (postgres *PostgresDataBase) deleteReactionInDB(ctx context.Context, articleID int, login, kind string) error {
+	deleteReactionQuery := `DELETE FROM article_reactions
+	                        WHERE article_id=$1 AND kind=$3
+	                          AND user_id=(SELECT id FROM users WHERE login=$2)`
+	_, err := postgres.db.ExecContext(ctx, deleteReactionQuery, articleID, login, kind)
+	return err
+}
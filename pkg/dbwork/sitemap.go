@@ -0,0 +1,61 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+	"time"
+)
+
+// GetArticleTimestamps возвращает статьи без текста и реакций, упорядоченные по ID:
+// этого достаточно для карты сайта и не требует читать содержимое
+func (postgres *PostgresDataBase) GetArticleTimestamps(ctx context.Context, limit, offset int) ([]models.Article, error) {
+	getTimestampsQuery := `SELECT articles.id, users.login, articles.created_at, articles.updated_at, articles.revision
+	                       FROM articles, users WHERE articles.user_id = users.id
+	                       ORDER BY articles.id
+	                       LIMIT $1 OFFSET $2`
+	articles := make([]models.Article, 0)
+
+	rows, err := postgres.db.QueryContext(ctx, getTimestampsQuery, limit, offset)
+	if err != nil {
+		return articles, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		temp := models.Article{}
+		err = rows.Scan(&temp.ID, &temp.Author, &temp.CreatedAt, &temp.UpdatedAt, &temp.Revision)
+		if err != nil {
+			return articles, err
+		}
+		articles = append(articles, temp)
+	}
+	return articles, rows.Err()
+}
+
+// GetArticlePagesModified делит статьи, упорядоченные по ID, на страницы
+// по pageSize и возвращает время последнего изменения для каждой страницы
+func (postgres *PostgresDataBase) GetArticlePagesModified(ctx context.Context, pageSize int) ([]time.Time, error) {
+	getPagesQuery := `SELECT MAX(numbered.updated_at) FROM (
+	                    SELECT updated_at, (ROW_NUMBER() OVER (ORDER BY id) - 1) / $1 AS page
+	                    FROM articles
+	                  ) AS numbered
+	                  GROUP BY numbered.page
+	                  ORDER BY numbered.page`
+	pages := make([]time.Time, 0)
+
+	rows, err := postgres.db.QueryContext(ctx, getPagesQuery, pageSize)
+	if err != nil {
+		return pages, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var modified time.Time
+		err = rows.Scan(&modified)
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, modified)
+	}
+	return pages, rows.Err()
+}
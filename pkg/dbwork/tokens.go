@@ -0,0 +1,123 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+func (postgres *PostgresDataBase) CreateAPIToken(ctx context.Context, login string, token *models.APIToken, tokenHash string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventCreateAPIToken, login: login, token: token, text: tokenHash, error: ch})
+}
+
+func (postgres *PostgresDataBase) DeleteAPIToken(ctx context.Context, login string, id int, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventDeleteAPIToken, login: login, id: id, error: ch})
+}
+
+func (postgres *PostgresDataBase) TouchAPIToken(ctx context.Context, id int, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventTouchAPIToken, id: id, error: ch})
+}
+
+func (postgres *PostgresDataBase) GetAPITokens(ctx context.Context, login string) ([]models.APIToken, error) {
+	getTokensQuery := `SELECT api_tokens.id, api_tokens.name, api_tokens.scopes, api_tokens.created_at,
+	                          api_tokens.last_used_at, api_tokens.expires_at
+	                   FROM api_tokens, users
+	                   WHERE users.login=$1 AND api_tokens.user_id=users.id
+	                   ORDER BY api_tokens.id`
+	tokens := make([]models.APIToken, 0)
+
+	rows, err := postgres.db.QueryContext(ctx, getTokensQuery, login)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		temp := models.APIToken{Login: login}
+		var lastUsed, expires sql.NullTime
+		err = rows.Scan(&temp.ID, &temp.Name, pq.Array(&temp.Scopes), &temp.CreatedAt, &lastUsed, &expires)
+		if err != nil {
+			return tokens, err
+		}
+		if lastUsed.Valid {
+			temp.LastUsedAt = &lastUsed.Time
+		}
+		if expires.Valid {
+			temp.ExpiresAt = &expires.Time
+		}
+		tokens = append(tokens, temp)
+	}
+	return tokens, rows.Err()
+}
+
+func (postgres *PostgresDataBase) GetAPITokenByHash(ctx context.Context, tokenHash string) (models.APIToken, error) {
+	getTokenQuery := `SELECT api_tokens.id, users.login, api_tokens.name, api_tokens.scopes,
+	                         api_tokens.created_at, api_tokens.last_used_at, api_tokens.expires_at
+	                  FROM api_tokens, users
+	                  WHERE api_tokens.token_hash=$1 AND api_tokens.user_id=users.id`
+	token := models.APIToken{}
+	var lastUsed, expires sql.NullTime
+
+	err := postgres.db.QueryRowContext(ctx, getTokenQuery, tokenHash).Scan(
+		&token.ID, &token.Login, &token.Name, pq.Array(&token.Scopes),
+		&token.CreatedAt, &lastUsed, &expires,
+	)
+	if err == sql.ErrNoRows {
+		return token, ErrNotFound
+	}
+	if err != nil {
+		return token, err
+	}
+
+	if lastUsed.Valid {
+		token.LastUsedAt = &lastUsed.Time
+	}
+	if expires.Valid {
+		token.ExpiresAt = &expires.Time
+	}
+	return token, nil
+}
+
+// createAPITokenInDB возвращает идентификатор новой записи через token,
+// чтобы клиент мог сразу отозвать токен
+func (postgres *PostgresDataBase) createAPITokenInDB(ctx context.Context, login string, token *models.APIToken, tokenHash string) error {
+	createTokenQuery := `INSERT INTO api_tokens
+	                     (user_id, name, token_hash, scopes, expires_at)
+	                     SELECT id, $2, $3, $4, $5 FROM users WHERE login=$1
+	                     RETURNING id, created_at`
+	err := postgres.db.QueryRowContext(ctx,
+		createTokenQuery, login, token.Name, tokenHash, pq.Array(token.Scopes), token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (postgres *PostgresDataBase) deleteAPITokenInDB(ctx context.Context, login string, id int) error {
+	deleteTokenQuery := `DELETE FROM api_tokens
+	                     WHERE id=$1 AND user_id=(SELECT id FROM users WHERE login=$2)`
+	result, err := postgres.db.ExecContext(ctx, deleteTokenQuery, id, login)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// touchAPITokenInDB обновляет время использования не чаще раза в минуту
+func (postgres *PostgresDataBase) touchAPITokenInDB(ctx context.Context, id int) error {
+	touchTokenQuery := `UPDATE api_tokens
+	                    SET last_used_at=NOW()
+	                    WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	_, err := postgres.db.ExecContext(ctx, touchTokenQuery, id)
+	return err
+}
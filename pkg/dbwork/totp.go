@@ -0,0 +1,152 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrTOTPReplay       = errors.New("Код уже был использован")
+	ErrRecoveryNotFound = errors.New("Код восстановления не найден или уже использован")
+)
+
+func (postgres *PostgresDataBase) GetTOTP(ctx context.Context, login string) (models.TOTP, error) {
+	getTOTPQuery := `SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE login=$1`
+	totp := models.TOTP{}
+
+	rows, err := postgres.db.QueryContext(ctx, getTOTPQuery, login)
+	if err != nil {
+		return totp, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var secret sql.NullString
+		err = rows.Scan(&secret, &totp.Enabled, &totp.LastStep)
+		if err != nil {
+			return totp, err
+		}
+		totp.Secret = secret.String
+	}
+	return totp, nil
+}
+
+func (postgres *PostgresDataBase) SetTOTPSecret(ctx context.Context, login, secret string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventSetTOTPSecret, login: login, text: secret, error: ch})
+}
+
+func (postgres *PostgresDataBase) EnableTOTP(ctx context.Context, login string, recoveryHashes []string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventEnableTOTP, login: login, codes: recoveryHashes, error: ch})
+}
+
+func (postgres *PostgresDataBase) DisableTOTP(ctx context.Context, login string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventDisableTOTP, login: login, error: ch})
+}
+
+// UseTOTPStep запоминает последний принятый временной шаг, чтобы код нельзя было использовать повторно
+func (postgres *PostgresDataBase) UseTOTPStep(ctx context.Context, login string, step int64, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventUseTOTPStep, login: login, step: step, error: ch})
+}
+
+func (postgres *PostgresDataBase) UseRecoveryCode(ctx context.Context, login, codeHash string, ch chan error) {
+	postgres.enqueue(ctx, event{eventType: eventUseRecoveryCode, login: login, text: codeHash, error: ch})
+}
+
+func (postgres *PostgresDataBase) setTOTPSecretInDB(ctx context.Context, login, secret string) error {
+	setSecretQuery := `UPDATE users
+	                   SET totp_secret=$1, totp_enabled=FALSE, totp_last_step=0
+	                   WHERE login=$2`
+	_, err := postgres.db.ExecContext(ctx, setSecretQuery, secret, login)
+	return err
+}
+
+func (postgres *PostgresDataBase) enableTOTPInDB(ctx context.Context, login string, recoveryHashes []string) error {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx, `UPDATE users SET totp_enabled=TRUE WHERE login=$1 RETURNING id`, login).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id=$1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (postgres *PostgresDataBase) disableTOTPInDB(ctx context.Context, login string) error {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRowContext(ctx,
+		`UPDATE users
+		 SET totp_secret=NULL, totp_enabled=FALSE, totp_last_step=0
+		 WHERE login=$1 RETURNING id`,
+		login,
+	).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id=$1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (postgres *PostgresDataBase) useTOTPStepInDB(ctx context.Context, login string, step int64) error {
+	useStepQuery := `UPDATE users
+	                 SET totp_last_step=$1
+	                 WHERE login=$2 AND totp_last_step < $1`
+	result, err := postgres.db.ExecContext(ctx, useStepQuery, step, login)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTOTPReplay
+	}
+	return nil
+}
+
+func (postgres *PostgresDataBase) useRecoveryCodeInDB(ctx context.Context, login, codeHash string) error {
+	useCodeQuery := `UPDATE recovery_codes
+	                 SET used_at=NOW()
+	                 WHERE code_hash=$1 AND used_at IS NULL
+	                   AND user_id=(SELECT id FROM users WHERE login=$2)`
+	result, err := postgres.db.ExecContext(ctx, useCodeQuery, codeHash, login)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRecoveryNotFound
+	}
+	return nil
+}
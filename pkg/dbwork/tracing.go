@@ -0,0 +1,367 @@
+package dbwork
+
+import (
+	"blog/pkg/models"
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("blog/pkg/dbwork")
+
+// TracedDataBase создаёт спан на каждый вызов методов DataBase. Спан
+// записи длится до получения результата, поэтому включает и ожидание в
+// очереди управляющей горутины, и выполнение SQL: они видны отдельными
+// дочерними спанами dbwork.queue и dbwork.execute
+type TracedDataBase struct {
+	DataBase
+}
+
+func NewTracedDataBase(inner DataBase) *TracedDataBase {
+	return &TracedDataBase{DataBase: inner}
+}
+
+// InitializationTracing оборачивает текущую DB трассировкой
+func InitializationTracing() {
+	DB = NewTracedDataBase(DB)
+}
+
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "dbwork."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", method),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != ErrNotFound {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceResult подменяет канал результата так же, как кеш: спан
+// завершается, когда управляющая горутина передала результат записи
+func traceResult(span trace.Span, ch chan error) chan error {
+	result := make(chan error, 1)
+	go func() {
+		err := <-result
+		endSpan(span, err)
+		ch <- err
+		close(ch)
+	}()
+	return result
+}
+
+// enqueue ставит событие в очередь управляющей горутины, запоминая
+// контекст вызова и время постановки
+func (postgres *PostgresDataBase) enqueue(ctx context.Context, e event) {
+	e.ctx = ctx
+	e.enqueued = time.Now()
+	postgres.events <- e
+}
+
+// traceEvent записывает время ожидания события в очереди и открывает
+// спан его выполнения, который закрывает управляющая горутина. Запросы
+// события выполняются с возвращённым контекстом
+func traceEvent(e event, dequeued time.Time) (context.Context, trace.Span) {
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	name := attribute.String("db.event", e.eventType.String())
+
+	_, queued := tracer.Start(ctx, "dbwork.queue",
+		trace.WithTimestamp(e.enqueued),
+		trace.WithAttributes(name),
+	)
+	queued.End(trace.WithTimestamp(dequeued))
+
+	return tracer.Start(ctx, "dbwork.execute",
+		trace.WithTimestamp(dequeued),
+		trace.WithAttributes(name),
+	)
+}
+
+func (traced *TracedDataBase) DeleteArticle(ctx context.Context, id int, ch chan error) {
+	ctx, span := startSpan(ctx, "DeleteArticle")
+	traced.DataBase.DeleteArticle(ctx, id, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) CreateArticle(ctx context.Context, author, text string, ch chan error) {
+	ctx, span := startSpan(ctx, "CreateArticle")
+	traced.DataBase.CreateArticle(ctx, author, text, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) GetArticle(ctx context.Context, id int) (models.Article, error) {
+	ctx, span := startSpan(ctx, "GetArticle")
+	article, err := traced.DataBase.GetArticle(ctx, id)
+	endSpan(span, err)
+	return article, err
+}
+
+func (traced *TracedDataBase) UpdateArticle(ctx context.Context, id int, text string, expectedRevision int, ch chan error) {
+	ctx, span := startSpan(ctx, "UpdateArticle")
+	traced.DataBase.UpdateArticle(ctx, id, text, expectedRevision, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) CreateUser(ctx context.Context, login, password string, ch chan error) {
+	ctx, span := startSpan(ctx, "CreateUser")
+	traced.DataBase.CreateUser(ctx, login, password, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) UpdatePassword(ctx context.Context, login, password string, ch chan error) {
+	ctx, span := startSpan(ctx, "UpdatePassword")
+	traced.DataBase.UpdatePassword(ctx, login, password, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) GetAllArticle(ctx context.Context, filter models.ArticleFilter) ([]models.Article, error) {
+	ctx, span := startSpan(ctx, "GetAllArticle")
+	articles, err := traced.DataBase.GetAllArticle(ctx, filter)
+	endSpan(span, err)
+	return articles, err
+}
+
+func (traced *TracedDataBase) VerifyPassword(ctx context.Context, login, password string) (bool, error) {
+	ctx, span := startSpan(ctx, "VerifyPassword")
+	ok, err := traced.DataBase.VerifyPassword(ctx, login, password)
+	endSpan(span, err)
+	return ok, err
+}
+
+func (traced *TracedDataBase) VerifyArticleToUser(ctx context.Context, id int, login string) (bool, error) {
+	ctx, span := startSpan(ctx, "VerifyArticleToUser")
+	ok, err := traced.DataBase.VerifyArticleToUser(ctx, id, login)
+	endSpan(span, err)
+	return ok, err
+}
+
+func (traced *TracedDataBase) GetTOTP(ctx context.Context, login string) (models.TOTP, error) {
+	ctx, span := startSpan(ctx, "GetTOTP")
+	state, err := traced.DataBase.GetTOTP(ctx, login)
+	endSpan(span, err)
+	return state, err
+}
+
+func (traced *TracedDataBase) SetTOTPSecret(ctx context.Context, login, secret string, ch chan error) {
+	ctx, span := startSpan(ctx, "SetTOTPSecret")
+	traced.DataBase.SetTOTPSecret(ctx, login, secret, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) EnableTOTP(ctx context.Context, login string, recoveryHashes []string, ch chan error) {
+	ctx, span := startSpan(ctx, "EnableTOTP")
+	traced.DataBase.EnableTOTP(ctx, login, recoveryHashes, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) DisableTOTP(ctx context.Context, login string, ch chan error) {
+	ctx, span := startSpan(ctx, "DisableTOTP")
+	traced.DataBase.DisableTOTP(ctx, login, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) UseTOTPStep(ctx context.Context, login string, step int64, ch chan error) {
+	ctx, span := startSpan(ctx, "UseTOTPStep")
+	traced.DataBase.UseTOTPStep(ctx, login, step, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) UseRecoveryCode(ctx context.Context, login, codeHash string, ch chan error) {
+	ctx, span := startSpan(ctx, "UseRecoveryCode")
+	traced.DataBase.UseRecoveryCode(ctx, login, codeHash, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) CreateAPIToken(ctx context.Context, login string, token *models.APIToken, tokenHash string, ch chan error) {
+	ctx, span := startSpan(ctx, "CreateAPIToken")
+	traced.DataBase.CreateAPIToken(ctx, login, token, tokenHash, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) GetAPITokens(ctx context.Context, login string) ([]models.APIToken, error) {
+	ctx, span := startSpan(ctx, "GetAPITokens")
+	tokens, err := traced.DataBase.GetAPITokens(ctx, login)
+	endSpan(span, err)
+	return tokens, err
+}
+
+func (traced *TracedDataBase) GetAPITokenByHash(ctx context.Context, tokenHash string) (models.APIToken, error) {
+	ctx, span := startSpan(ctx, "GetAPITokenByHash")
+	token, err := traced.DataBase.GetAPITokenByHash(ctx, tokenHash)
+	endSpan(span, err)
+	return token, err
+}
+
+func (traced *TracedDataBase) DeleteAPIToken(ctx context.Context, login string, id int, ch chan error) {
+	ctx, span := startSpan(ctx, "DeleteAPIToken")
+	traced.DataBase.DeleteAPIToken(ctx, login, id, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) TouchAPIToken(ctx context.Context, id int, ch chan error) {
+	ctx, span := startSpan(ctx, "TouchAPIToken")
+	traced.DataBase.TouchAPIToken(ctx, id, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) GetLoginByIdentity(ctx context.Context, issuer, subject string) (string, error) {
+	ctx, span := startSpan(ctx, "GetLoginByIdentity")
+	login, err := traced.DataBase.GetLoginByIdentity(ctx, issuer, subject)
+	endSpan(span, err)
+	return login, err
+}
+
+func (traced *TracedDataBase) ProvisionExternalUser(ctx context.Context, login, issuer, subject string, link bool, ch chan error) {
+	ctx, span := startSpan(ctx, "ProvisionExternalUser")
+	traced.DataBase.ProvisionExternalUser(ctx, login, issuer, subject, link, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) SetReaction(ctx context.Context, articleID int, login, kind string, ch chan error) {
+	ctx, span := startSpan(ctx, "SetReaction")
+	traced.DataBase.SetReaction(ctx, articleID, login, kind, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) DeleteReaction(ctx context.Context, articleID int, login, kind string, ch chan error) {
+	ctx, span := startSpan(ctx, "DeleteReaction")
+	traced.DataBase.DeleteReaction(ctx, articleID, login, kind, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) UserExists(ctx context.Context, login string) (bool, error) {
+	ctx, span := startSpan(ctx, "UserExists")
+	ok, err := traced.DataBase.UserExists(ctx, login)
+	endSpan(span, err)
+	return ok, err
+}
+
+func (traced *TracedDataBase) Follow(ctx context.Context, follower, followee string, ch chan error) {
+	ctx, span := startSpan(ctx, "Follow")
+	traced.DataBase.Follow(ctx, follower, followee, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) Unfollow(ctx context.Context, follower, followee string, ch chan error) {
+	ctx, span := startSpan(ctx, "Unfollow")
+	traced.DataBase.Unfollow(ctx, follower, followee, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) GetFollowers(ctx context.Context, login string, limit, offset int) ([]models.Follow, error) {
+	ctx, span := startSpan(ctx, "GetFollowers")
+	follows, err := traced.DataBase.GetFollowers(ctx, login, limit, offset)
+	endSpan(span, err)
+	return follows, err
+}
+
+func (traced *TracedDataBase) GetFollowing(ctx context.Context, login string, limit, offset int) ([]models.Follow, error) {
+	ctx, span := startSpan(ctx, "GetFollowing")
+	follows, err := traced.DataBase.GetFollowing(ctx, login, limit, offset)
+	endSpan(span, err)
+	return follows, err
+}
+
+func (traced *TracedDataBase) SetBookmark(ctx context.Context, articleID int, login string, ch chan error) {
+	ctx, span := startSpan(ctx, "SetBookmark")
+	traced.DataBase.SetBookmark(ctx, articleID, login, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) DeleteBookmark(ctx context.Context, articleID int, login string, ch chan error) {
+	ctx, span := startSpan(ctx, "DeleteBookmark")
+	traced.DataBase.DeleteBookmark(ctx, articleID, login, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) GetBookmarkedIDs(ctx context.Context, login string, ids []int) (map[int]bool, error) {
+	ctx, span := startSpan(ctx, "GetBookmarkedIDs")
+	bookmarked, err := traced.DataBase.GetBookmarkedIDs(ctx, login, ids)
+	endSpan(span, err)
+	return bookmarked, err
+}
+
+func (traced *TracedDataBase) CreateMedia(ctx context.Context, login string, media models.Media, ch chan error) {
+	ctx, span := startSpan(ctx, "CreateMedia")
+	traced.DataBase.CreateMedia(ctx, login, media, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) GetMedia(ctx context.Context, id string) (models.Media, error) {
+	ctx, span := startSpan(ctx, "GetMedia")
+	file, err := traced.DataBase.GetMedia(ctx, id)
+	endSpan(span, err)
+	return file, err
+}
+
+func (traced *TracedDataBase) GetUserMedia(ctx context.Context, login string, limit, offset int) ([]models.Media, error) {
+	ctx, span := startSpan(ctx, "GetUserMedia")
+	files, err := traced.DataBase.GetUserMedia(ctx, login, limit, offset)
+	endSpan(span, err)
+	return files, err
+}
+
+func (traced *TracedDataBase) DeleteMedia(ctx context.Context, login, id string, ch chan error) {
+	ctx, span := startSpan(ctx, "DeleteMedia")
+	traced.DataBase.DeleteMedia(ctx, login, id, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) GetArticleTimestamps(ctx context.Context, limit, offset int) ([]models.Article, error) {
+	ctx, span := startSpan(ctx, "GetArticleTimestamps")
+	articles, err := traced.DataBase.GetArticleTimestamps(ctx, limit, offset)
+	endSpan(span, err)
+	return articles, err
+}
+
+func (traced *TracedDataBase) GetArticlePagesModified(ctx context.Context, pageSize int) ([]time.Time, error) {
+	ctx, span := startSpan(ctx, "GetArticlePagesModified")
+	modified, err := traced.DataBase.GetArticlePagesModified(ctx, pageSize)
+	endSpan(span, err)
+	return modified, err
+}
+
+func (traced *TracedDataBase) Status(ctx context.Context) (models.DBStatus, error) {
+	ctx, span := startSpan(ctx, "Status")
+	status, err := traced.DataBase.Status(ctx)
+	endSpan(span, err)
+	return status, err
+}
+
+func (traced *TracedDataBase) GetAccount(ctx context.Context, login string) (models.Account, error) {
+	ctx, span := startSpan(ctx, "GetAccount")
+	account, err := traced.DataBase.GetAccount(ctx, login)
+	endSpan(span, err)
+	return account, err
+}
+
+func (traced *TracedDataBase) GetStats(ctx context.Context) (models.Stats, error) {
+	ctx, span := startSpan(ctx, "GetStats")
+	stats, err := traced.DataBase.GetStats(ctx)
+	endSpan(span, err)
+	return stats, err
+}
+
+func (traced *TracedDataBase) SetUserDisabled(ctx context.Context, login string, disabled bool, ch chan error) {
+	ctx, span := startSpan(ctx, "SetUserDisabled")
+	traced.DataBase.SetUserDisabled(ctx, login, disabled, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) SetUserRole(ctx context.Context, login, role string, ch chan error) {
+	ctx, span := startSpan(ctx, "SetUserRole")
+	traced.DataBase.SetUserRole(ctx, login, role, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) DeleteUser(ctx context.Context, login string, ch chan error) {
+	ctx, span := startSpan(ctx, "DeleteUser")
+	traced.DataBase.DeleteUser(ctx, login, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) DeleteUserArticles(ctx context.Context, login string, ch chan error) {
+	ctx, span := startSpan(ctx, "DeleteUserArticles")
+	traced.DataBase.DeleteUserArticles(ctx, login, traceResult(span, ch))
+}
+
+func (traced *TracedDataBase) ExportContent(ctx context.Context, withPasswords bool, emit func(models.BackupRecord) error) error {
+	ctx, span := startSpan(ctx, "ExportContent")
+	err := traced.DataBase.ExportContent(ctx, withPasswords, emit)
+	endSpan(span, err)
+	return err
+}
+
+func (traced *TracedDataBase) ImportBatch(ctx context.Context, batch *models.ImportBatch, ch chan error) {
+	ctx, span := startSpan(ctx, "ImportBatch")
+	traced.DataBase.ImportBatch(ctx, batch, traceResult(span, ch))
+}
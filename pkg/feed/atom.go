@@ -0,0 +1,84 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// Документ Atom 1.0 (RFC 4287)
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  *atomPerson `xml:"author,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Author    atomPerson  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Atom формирует ленту Atom. Если author не пуст, лента относится к одному автору
+func Atom(entries []Entry, title, selfPath, author string) ([]byte, error) {
+	updated := LastModified(entries)
+	if updated.IsZero() {
+		// Поле обязательно, для пустой ленты берём фиксированную дату
+		updated = time.Unix(0, 0).UTC()
+	}
+
+	feed := atomFeed{
+		XMLNS:   atomNamespace,
+		ID:      URL(selfPath),
+		Title:   title,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: URL(selfPath), Rel: "self", Type: "application/atom+xml"},
+			{Href: URL("/"), Rel: "alternate"},
+		},
+		Entries: make([]atomEntry, 0, len(entries)),
+	}
+	if author != "" {
+		feed.Author = &atomPerson{Name: author}
+	}
+
+	for _, entry := range entries {
+		article := entry.Article
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        ArticleURL(article.ID),
+			Title:     Title(article),
+			Published: article.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   article.UpdatedAt.UTC().Format(time.RFC3339),
+			Link:      atomLink{Href: ArticleURL(article.ID), Rel: "alternate"},
+			Author:    atomPerson{Name: article.Author},
+			Content:   atomContent{Type: "html", Value: entry.HTML},
+		})
+	}
+
+	return marshal(feed)
+}
@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"blog/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Параметры лент
+type Config struct {
+	// Публичный адрес блога без завершающего слеша
+	SiteURL     string
+	Title       string
+	Description string
+	// Количество статей в ленте
+	ItemCount int
+	// Ссылки на статьи ведут на HTML-страницы /article/{id}/, а не на JSON API
+	HTMLPages bool
+}
+
+const maxTitleLength = 100
+
+var config = DefaultConfig()
+
+func DefaultConfig() Config {
+	return Config{
+		SiteURL:     "http://localhost:8080",
+		Title:       "Blog",
+		Description: "Новые статьи",
+		ItemCount:   20,
+	}
+}
+
+func InitializationFeed(newConfig Config) {
+	newConfig.SiteURL = strings.TrimSuffix(newConfig.SiteURL, "/")
+	config = newConfig
+}
+
+func CurrentConfig() Config {
+	return config
+}
+
+// Entry — статья, подготовленная для ленты
+type Entry struct {
+	Article models.Article
+	// Безопасный HTML статьи
+	HTML string
+}
+
+// URL возвращает абсолютный адрес пути на сайте
+func URL(path string) string {
+	return config.SiteURL + path
+}
+
+// ArticleURL возвращает адрес статьи для читателя: страницу, если сайт
+// отдаёт HTML, и адрес API в противном случае
+func ArticleURL(id int) string {
+	if config.HTMLPages {
+		return URL("/article/" + strconv.Itoa(id) + "/")
+	}
+	return URL("/article/" + strconv.Itoa(id))
+}
+
+// Title строится из первой непустой строки текста без разметки заголовка
+func Title(article models.Article) string {
+	for _, line := range strings.Split(article.Text, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#>*- "))
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > maxTitleLength {
+			runes := []rune(line)
+			line = strings.TrimSpace(string(runes[:maxTitleLength])) + "…"
+		}
+		return line
+	}
+	return "Статья " + strconv.Itoa(article.ID)
+}
+
+// LastModified — время последнего изменения среди статей ленты
+func LastModified(entries []Entry) time.Time {
+	var last time.Time
+	for _, entry := range entries {
+		if entry.Article.UpdatedAt.After(last) {
+			last = entry.Article.UpdatedAt
+		}
+	}
+	return last.UTC().Truncate(time.Second)
+}
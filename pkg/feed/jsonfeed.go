@@ -0,0 +1,64 @@
+package feed
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// Документ JSON Feed 1.1
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Authors     []jsonAuthor   `json:"authors,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url"`
+	Title         string       `json:"title"`
+	ContentHTML   string       `json:"content_html"`
+	DatePublished string       `json:"date_published"`
+	DateModified  string       `json:"date_modified"`
+	Authors       []jsonAuthor `json:"authors"`
+}
+
+// JSONFeed формирует ленту JSON Feed. Если author не пуст, лента относится к одному автору
+func JSONFeed(entries []Entry, title, selfPath, author string) ([]byte, error) {
+	document := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       title,
+		HomePageURL: URL("/"),
+		FeedURL:     URL(selfPath),
+		Description: config.Description,
+		Items:       make([]jsonFeedItem, 0, len(entries)),
+	}
+	if author != "" {
+		document.Authors = []jsonAuthor{{Name: author}}
+	}
+
+	for _, entry := range entries {
+		article := entry.Article
+		document.Items = append(document.Items, jsonFeedItem{
+			ID:            strconv.Itoa(article.ID),
+			URL:           ArticleURL(article.ID),
+			Title:         Title(article),
+			ContentHTML:   entry.HTML,
+			DatePublished: article.CreatedAt.UTC().Format(time.RFC3339),
+			DateModified:  article.UpdatedAt.UTC().Format(time.RFC3339),
+			Authors:       []jsonAuthor{{Name: article.Author}},
+		})
+	}
+
+	return json.MarshalIndent(document, "", "  ")
+}
@@ -0,0 +1,76 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const dublinCoreNamespace = "http://purl.org/dc/elements/1.1/"
+
+// Документ RSS 2.0
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	Creator     string  `xml:"dc:creator"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS формирует ленту RSS 2.0, selfPath — путь самой ленты
+func RSS(entries []Entry, title, selfPath string) ([]byte, error) {
+	channel := rssChannel{
+		Title:       title,
+		Link:        URL("/"),
+		Description: config.Description,
+		Self:        atomLink{Href: URL(selfPath), Rel: "self", Type: "application/rss+xml"},
+		Items:       make([]rssItem, 0, len(entries)),
+	}
+	if last := LastModified(entries); !last.IsZero() {
+		channel.LastBuildDate = last.Format(time.RFC1123Z)
+	}
+
+	for _, entry := range entries {
+		link := ArticleURL(entry.Article.ID)
+		channel.Items = append(channel.Items, rssItem{
+			Title:       Title(entry.Article),
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			Creator:     entry.Article.Author,
+			PubDate:     entry.Article.CreatedAt.UTC().Format(time.RFC1123Z),
+			Description: entry.HTML,
+		})
+	}
+
+	return marshal(rss{Version: "2.0", Atom: atomNamespace, DC: dublinCoreNamespace, Channel: channel})
+}
+
+func marshal(document interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"blog/pkg/backup"
+	"blog/pkg/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// swagger:route GET /admin/export admin exportContent
+//
+// # Выгрузка всех данных блога
+//
+// Только для администраторов. Формат jsonl содержит пользователей, статьи,
+// реакции, закладки, подписки и записи о файлах, формат tar — ещё и сами файлы.
+// Хеши паролей выгружаются только при passwords=true.
+//
+// produces:
+// - application/x-ndjson
+// - application/x-tar
+//
+// responses:
+//
+//	400: Response
+//	401: Response
+//	403: Response
+//	500: Response
+func ExportContent(rw http.ResponseWriter, r *http.Request) {
+	options := backup.Options{
+		Format:    r.URL.Query().Get("format"),
+		Passwords: r.URL.Query().Get("passwords") == "true",
+	}
+	if options.Format == "" {
+		options.Format = backup.FormatJSONL
+	}
+	if options.Format != backup.FormatJSONL && options.Format != backup.FormatTar {
+		models.ResponseNew(rw, "Формат выгрузки должен быть jsonl или tar", http.StatusBadRequest)
+		return
+	}
+	requestLogger(r).Info("ExportContent started", "format", options.Format, "passwords", options.Passwords)
+
+	name := fmt.Sprintf("blog-%s.%s", time.Now().UTC().Format("20060102-150405"), options.Format)
+	rw.Header().Set("Content-Type", backup.ContentType(options.Format))
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	rw.Header().Set("Cache-Control", "no-store")
+
+	// Ответ уже начат, поэтому об ошибке можно только записать в журнал:
+	// клиент получит оборванную выгрузку
+	if err := backup.Export(r.Context(), rw, options); err != nil {
+		requestLogger(r).Error("ExportContent failed", "error", err)
+	}
+}
+
+// Результат импорта
+type importResult struct {
+	// Число применённых записей каждого типа. Записи, которые уже
+	// были в БД, не учитываются
+	Applied map[string]int `json:"applied"`
+}
+
+// swagger:route POST /admin/import admin importContent
+//
+// # Загрузка выгрузки блога
+//
+// Только для администраторов. Принимает выгрузку в формате jsonl или tar.
+// Повторная загрузка той же выгрузки не создаёт копий: пользователи
+// сопоставляются по логину, статьи по uid, идентификаторы статей
+// назначаются заново.
+//
+// consumes:
+// - application/x-ndjson
+// - application/x-tar
+//
+// responses:
+//
+//	200: importResponse
+//	400: Response
+//	401: Response
+//	403: Response
+//	500: Response
+func ImportContent(rw http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Info("ImportContent started")
+
+	applied, err := backup.Import(r.Context(), r.Body)
+	if errors.Is(err, backup.ErrInvalidFormat) {
+		requestLogger(r).Warn("ImportContent: invalid backup", "error", err, "applied", applied)
+		models.ResponseNew(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("ImportContent failed", "error", err, "applied", applied)
+		models.ResponseErrorServer(rw)
+		return
+	}
+	requestLogger(r).Info("ImportContent finished", "applied", applied)
+
+	writeJSON(rw, r, importResult{Applied: applied})
+}
+
+// swagger:parameters exportContent
+type ExportParams struct {
+	// jsonl или tar
+	// in: query
+	Format string `json:"format"`
+	// Выгрузить хеши паролей
+	// in: query
+	Passwords bool `json:"passwords"`
+}
+
+// swagger:response importResponse
+type ImportResponse struct {
+	// in:body
+	Body importResult
+}
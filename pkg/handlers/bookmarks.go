@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// swagger:route PUT /article/{id}/bookmark article setBookmark
+//
+// # Добавление статьи в закладки
+//
+// responses:
+//
+//	200: Response
+//	401: Response
+//	404: Response
+//	500: Response
+func SetBookmark(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		models.ResponseNotFound(rw)
+		return
+	}
+	requestLogger(r).Debug("SetBookmark started", "id", id)
+
+	ch := make(chan error, 1)
+	dbwork.DB.SetBookmark(r.Context(), id, login, ch)
+	err = <-ch
+	if err == dbwork.ErrNotFound {
+		models.ResponseNotFound(rw)
+		return
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	models.ResponseOK(rw)
+}
+
+// swagger:route DELETE /article/{id}/bookmark article deleteBookmark
+//
+// # Удаление статьи из закладок
+//
+// responses:
+//
+//	200: Response
+//	401: Response
+//	404: Response
+//	500: Response
+func DeleteBookmark(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		models.ResponseNotFound(rw)
+		return
+	}
+	requestLogger(r).Debug("DeleteBookmark started", "id", id)
+
+	ch := make(chan error, 1)
+	dbwork.DB.DeleteBookmark(r.Context(), id, login, ch)
+	err = <-ch
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	models.ResponseOK(rw)
+}
+
+// swagger:route GET /user/me/bookmarks user getBookmarks
+//
+// # Статьи из закладок
+//
+// Статьи отсортированы от недавно добавленных.
+//
+// responses:
+//
+//	200: articlesResponse
+//	400: Response
+//	401: Response
+//	500: Response
+func GetBookmarks(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	limit, offset, ok := parsePagination(r, defaultPageSize)
+	if !ok {
+		models.ResponseBadRequest(rw)
+		return
+	}
+	requestLogger(r).Debug("GetBookmarks started", "login", login)
+
+	articles, err := dbwork.DB.GetAllArticle(r.Context(), models.ArticleFilter{
+		BookmarkedBy: login,
+		Limit:        limit,
+		Offset:       offset,
+	})
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	if err := prepareArticles(r, articles); err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	writeJSON(rw, r, articles)
+}
+
+// markBookmarks проставляет флаг bookmarked, если запрос авторизован
+func markBookmarks(r *http.Request, articles []models.Article) error {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		return nil
+	}
+
+	ids := make([]int, 0, len(articles))
+	for _, article := range articles {
+		ids = append(ids, article.ID)
+	}
+
+	bookmarked, err := dbwork.DB.GetBookmarkedIDs(r.Context(), login, ids)
+	if err != nil {
+		return err
+	}
+	for i := range articles {
+		value := bookmarked[articles[i].ID]
+		articles[i].Bookmarked = &value
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"blog/pkg/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// bodyETag — сильный ETag по содержимому ответа
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified выставляет ETag и отвечает 304, если у клиента уже есть
+// актуальная версия. Last-Modified не отдаётся: реакции, закладки и
+// удаление статей не меняют время изменения, и If-Modified-Since давал
+// бы устаревшие 304
+func notModified(rw http.ResponseWriter, r *http.Request, etag string) bool {
+	rw.Header().Set("ETag", etag)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	match := r.Header.Get("If-None-Match")
+	if match == "" || !etagMatches(match, etag, true) {
+		return false
+	}
+	rw.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches проверяет список ETag из заголовка. При слабом сравнении
+// префикс W/ не учитывается
+func etagMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// articleETag — сильный ETag статьи вида "id-ревизия-хеш". Ревизия меняется
+// вместе с текстом, хеш — вместе с реакциями и флагом закладки
+func articleETag(article models.Article) string {
+	variant := sha256.New()
+	for _, kind := range models.ReactionKinds {
+		fmt.Fprintf(variant, "%s=%d;", kind, article.Reactions[kind])
+	}
+	switch {
+	case article.Bookmarked == nil:
+		variant.Write([]byte("-"))
+	case *article.Bookmarked:
+		variant.Write([]byte("1"))
+	default:
+		variant.Write([]byte("0"))
+	}
+
+	return fmt.Sprintf(`"%d-%d-%s"`, article.ID, article.Revision, hex.EncodeToString(variant.Sum(nil)[:6]))
+}
+
+// articlesETag — сильный ETag списка статей с учётом их порядка
+func articlesETag(articles []models.Article) string {
+	list := sha256.New()
+	for _, article := range articles {
+		list.Write([]byte(articleETag(article)))
+	}
+	return `"` + hex.EncodeToString(list.Sum(nil)[:16]) + `"`
+}
+
+// preconditionFailed отвечает 412, если статья изменилась после того,
+// как клиент получил её ревизию
+func preconditionFailed(rw http.ResponseWriter) {
+	models.ResponseNew(rw, "Статья была изменена, получите актуальную версию", http.StatusPreconditionFailed)
+}
+
+// articleRevisionMatches проверяет If-Match для изменения статьи. Сравнивается
+// только ревизия: реакции и закладки не мешают сохранить новый текст
+func articleRevisionMatches(header string, article models.Article) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		parts := strings.SplitN(strings.Trim(candidate, `"`), "-", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		id, err := strconv.Atoi(parts[0])
+		if err != nil || id != article.ID {
+			continue
+		}
+		revision, err := strconv.Atoi(parts[1])
+		if err == nil && revision == article.Revision {
+			return true
+		}
+	}
+	return false
+}
+
+// setArticleCacheHeaders помечает ответ как зависящий от пользователя:
+// флаг закладки есть только в авторизованных ответах
+func setArticleCacheHeaders(rw http.ResponseWriter) {
+	rw.Header().Add("Vary", "Authorization")
+	rw.Header().Add("Vary", "Cookie")
+	rw.Header().Set("Cache-Control", "private, no-cache")
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/feed"
+	"blog/pkg/markdown"
+	"blog/pkg/models"
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	contentTypeRSS  = "application/rss+xml; charset=utf-8"
+	contentTypeAtom = "application/atom+xml; charset=utf-8"
+	contentTypeJSON = "application/feed+json; charset=utf-8"
+)
+
+// swagger:route GET /feed.rss feed getRSSFeed
+//
+// # Лента новых статей в формате RSS 2.0
+//
+// Поддерживаются условные запросы по If-None-Match.
+//
+// produces:
+// - application/rss+xml
+//
+// responses:
+//
+//	500: Response
+func GetRSSFeed(rw http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("GetRSSFeed started")
+
+	entries, err := feedEntries(r.Context(), models.ArticleFilter{})
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	body, err := feed.RSS(entries, feed.CurrentConfig().Title, "/feed.rss")
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	writeFeed(rw, r, body, contentTypeRSS)
+}
+
+// swagger:route GET /feed.atom feed getAtomFeed
+//
+// # Лента новых статей в формате Atom
+//
+// Поддерживаются условные запросы по If-None-Match.
+//
+// produces:
+// - application/atom+xml
+//
+// responses:
+//
+//	500: Response
+func GetAtomFeed(rw http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("GetAtomFeed started")
+
+	entries, err := feedEntries(r.Context(), models.ArticleFilter{})
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	body, err := feed.Atom(entries, feed.CurrentConfig().Title, "/feed.atom", "")
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	writeFeed(rw, r, body, contentTypeAtom)
+}
+
+// swagger:route GET /feed.json feed getJSONFeed
+//
+// # Лента новых статей в формате JSON Feed 1.1
+//
+// Поддерживаются условные запросы по If-None-Match.
+//
+// produces:
+// - application/feed+json
+//
+// responses:
+//
+//	500: Response
+func GetJSONFeed(rw http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("GetJSONFeed started")
+
+	entries, err := feedEntries(r.Context(), models.ArticleFilter{})
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	body, err := feed.JSONFeed(entries, feed.CurrentConfig().Title, "/feed.json", "")
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	writeFeed(rw, r, body, contentTypeJSON)
+}
+
+// swagger:route GET /user/{login}/feed.atom feed getAuthorAtomFeed
+//
+// # Лента статей автора в формате Atom
+//
+// produces:
+// - application/atom+xml
+//
+// responses:
+//
+//	404: Response
+//	500: Response
+func GetAuthorAtomFeed(rw http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+	requestLogger(r).Debug("GetAuthorAtomFeed started", "login", login)
+
+	exists, err := dbwork.DB.UserExists(r.Context(), login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	if !exists {
+		models.ResponseNotFound(rw)
+		return
+	}
+
+	entries, err := feedEntries(r.Context(), models.ArticleFilter{Author: login})
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	title := feed.CurrentConfig().Title + ": " + login
+	body, err := feed.Atom(entries, title, "/user/"+login+"/feed.atom", login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	writeFeed(rw, r, body, contentTypeAtom)
+}
+
+// feedEntries выбирает последние статьи и готовит их HTML
+func feedEntries(ctx context.Context, filter models.ArticleFilter) ([]feed.Entry, error) {
+	filter.Sort = models.SortNewest
+	filter.Limit = feed.CurrentConfig().ItemCount
+
+	articles, err := dbwork.DB.GetAllArticle(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]feed.Entry, 0, len(articles))
+	for _, article := range articles {
+		html, err := markdown.RenderRevision(article.ID, article.Revision, article.Text)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, feed.Entry{Article: article, HTML: html})
+	}
+	return entries, nil
+}
+
+// writeFeed отдаёт сгенерированный документ с поддержкой условных запросов
+func writeFeed(rw http.ResponseWriter, r *http.Request, body []byte, contentType string) {
+	rw.Header().Set("Cache-Control", "public, max-age=300")
+	if notModified(rw, r, bodyETag(body)) {
+		return
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	rw.Write(body)
+}
+
+// swagger:parameters getAuthorAtomFeed
+type AuthorFeedParams struct {
+	// in: path
+	// required: true
+	Login string `json:"login"`
+}
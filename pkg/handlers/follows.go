@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// swagger:route POST /user/{login}/follow user follow
+//
+// # Подписка на автора
+//
+// responses:
+//
+//	200: Response
+//	400: Response
+//	401: Response
+//	404: Response
+//	500: Response
+func FollowUser(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	followee := mux.Vars(r)["login"]
+	if followee == login {
+		models.ResponseNew(rw, "Нельзя подписаться на себя", http.StatusBadRequest)
+		return
+	}
+	requestLogger(r).Debug("FollowUser started", "login", login, "followee", followee)
+
+	ch := make(chan error, 1)
+	dbwork.DB.Follow(r.Context(), login, followee, ch)
+	err := <-ch
+	if err == dbwork.ErrNotFound {
+		models.ResponseNotFound(rw)
+		return
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	models.ResponseOK(rw)
+}
+
+// swagger:route DELETE /user/{login}/follow user unfollow
+//
+// # Отписка от автора
+//
+// responses:
+//
+//	200: Response
+//	401: Response
+//	500: Response
+func UnfollowUser(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	followee := mux.Vars(r)["login"]
+	requestLogger(r).Debug("UnfollowUser started", "login", login, "followee", followee)
+
+	ch := make(chan error, 1)
+	dbwork.DB.Unfollow(r.Context(), login, followee, ch)
+	err := <-ch
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	models.ResponseOK(rw)
+}
+
+// swagger:route GET /user/{login}/followers user getFollowers
+//
+// # Подписчики пользователя
+//
+// responses:
+//
+//	200: followsResponse
+//	400: Response
+//	404: Response
+//	500: Response
+func GetFollowers(rw http.ResponseWriter, r *http.Request) {
+	listFollows(rw, r, dbwork.DB.GetFollowers)
+}
+
+// swagger:route GET /user/{login}/following user getFollowing
+//
+// # Авторы, на которых подписан пользователь
+//
+// responses:
+//
+//	200: followsResponse
+//	400: Response
+//	404: Response
+//	500: Response
+func GetFollowing(rw http.ResponseWriter, r *http.Request) {
+	listFollows(rw, r, dbwork.DB.GetFollowing)
+}
+
+func listFollows(rw http.ResponseWriter, r *http.Request, query func(context.Context, string, int, int) ([]models.Follow, error)) {
+	login := mux.Vars(r)["login"]
+
+	limit, offset, ok := parsePagination(r, defaultPageSize)
+	if !ok {
+		models.ResponseBadRequest(rw)
+		return
+	}
+
+	exists, err := dbwork.DB.UserExists(r.Context(), login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	if !exists {
+		models.ResponseNotFound(rw)
+		return
+	}
+
+	follows, err := query(r.Context(), login, limit, offset)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	writeJSON(rw, r, follows)
+}
+
+// swagger:response followsResponse
+type FollowsResponse struct {
+	// in:body
+	Body []models.Follow
+}
+
+// swagger:route GET /feed article getFeed
+//
+// # Лента статей авторов, на которых подписан пользователь
+//
+// Статьи отсортированы от новых к старым.
+//
+// responses:
+//
+//	200: articlesResponse
+//	400: Response
+//	401: Response
+//	500: Response
+func GetFeed(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	limit, offset, ok := parsePagination(r, defaultPageSize)
+	if !ok {
+		models.ResponseBadRequest(rw)
+		return
+	}
+	requestLogger(r).Debug("GetFeed started", "login", login)
+
+	articles, err := dbwork.DB.GetAllArticle(r.Context(), models.ArticleFilter{
+		Sort:       models.SortNewest,
+		FollowedBy: login,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	if err := prepareArticles(r, articles); err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	writeJSON(rw, r, articles)
+}
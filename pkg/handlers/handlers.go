@@ -3,61 +3,120 @@ package handlers
 import (
 	"blog/pkg/auth"
 	"blog/pkg/dbwork"
+	"blog/pkg/logging"
+	"blog/pkg/metrics"
 	"blog/pkg/models"
+	"blog/pkg/password"
 	"bytes"
 	"encoding/json"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var logger = log.New(os.Stdout, "[HTTP] ", log.LstdFlags|log.Lshortfile)
+const (
+	RequestIDHeader = "X-Request-ID"
+	maxRequestID    = 128
+	// Тела больше этого размера не попадают в журнал
+	maxLoggedBody = 16 << 10
+)
 
+// LoggingMiddleware присваивает запросу идентификатор, кладёт в контекст
+// логгер с этим идентификатором и записывает начало и итог запроса.
+// Заголовки и JSON-тело пишутся только на уровне debug, секреты скрываются
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		logger.Printf("Incoming %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		rw.Header().Set(RequestIDHeader, requestID)
 
-		headers := make(map[string]string)
-		for k, v := range r.Header {
-			if k != "Authorization" {
-				headers[k] = strings.Join(v, ", ")
-			}
+		log := slog.Default().With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			log = log.With("trace_id", spanContext.TraceID().String())
 		}
-		logger.Printf("Headers: %+v", headers)
-
-		var bodyBytes []byte
-		if r.Body != nil && r.URL.Path != "/login" && r.URL.Path != "/register" {
-			bodyBytes, _ = io.ReadAll(r.Body)
-			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-			if len(bodyBytes) > 0 {
-				maxBodySize := 1024
-				if len(bodyBytes) > maxBodySize {
-					logger.Printf("Body (truncated): %s", string(bodyBytes[:maxBodySize]))
-				} else {
-					logger.Printf("Body: %s", string(bodyBytes))
-				}
+		r = r.WithContext(logging.WithLogger(r.Context(), log))
+
+		log.Info("Request started", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+		if log.Enabled(r.Context(), slog.LevelDebug) {
+			attrs := []any{"headers", logging.RedactHeaders(r.Header)}
+			if query := r.URL.Query(); len(query) > 0 {
+				attrs = append(attrs, "query", logging.RedactQuery(query))
+			}
+			if body, ok := peekJSONBody(r); ok {
+				attrs = append(attrs, "body", body)
 			}
+			log.Debug("Request details", attrs...)
 		}
 
-		lrw := &loggingResponseWriter{ResponseWriter: rw}
+		lrw := &loggingResponseWriter{ResponseWriter: rw, status: http.StatusOK}
 
 		next.ServeHTTP(lrw, r)
 
-		duration := time.Since(start)
-		logger.Printf("Completed %s %s | Status: %d | Duration: %v",
-			r.Method, r.URL.Path, lrw.status, duration)
+		level := slog.LevelInfo
+		if lrw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		log.Log(r.Context(), level, "Request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", lrw.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
 	})
 }
 
+// requestLogger возвращает логгер текущего запроса
+func requestLogger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context())
+}
+
+// validRequestID принимает идентификатор клиента или прокси, только если
+// он короткий и не содержит символов, ломающих журнал
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// peekJSONBody читает JSON-тело для журнала и возвращает его в запрос.
+// Загружаемые файлы и прочие типы содержимого не читаются
+func peekJSONBody(r *http.Request) (interface{}, bool) {
+	contentType := r.Header.Get("Content-Type")
+	if r.Body == nil || (contentType != "" && !strings.Contains(contentType, "json")) {
+		return nil, false
+	}
+
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if err != nil || len(head) == 0 || len(head) > maxLoggedBody {
+		return nil, false
+	}
+	return logging.RedactJSON(head)
+}
+
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	status int
@@ -68,6 +127,19 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+// writeJSON отдаёт значение со статусом 200. Кодировщик пишет в ответ
+// только готовый документ, поэтому ошибка означает обрыв соединения,
+// и начатый ответ уже не заменить сообщением об ошибке
+func writeJSON(rw http.ResponseWriter, r *http.Request, value interface{}) {
+	if err := json.NewEncoder(rw).Encode(value); err != nil {
+		requestLogger(r).Warn("Failed to write response", "error", err)
+	}
+}
+
 // Стандартная ошибка API
 // swagger:model
 type APIError struct {
@@ -93,7 +165,7 @@ type APIError struct {
 //     schema:
 //     $ref: "#/definitions/Article"
 func CreateArticle(rw http.ResponseWriter, r *http.Request) {
-	logger.Printf("CreateArticle started")
+	requestLogger(r).Debug("CreateArticle started")
 	login, ok := r.Context().Value("login").(string)
 	if !ok {
 		models.ResponseUnauthorized(rw)
@@ -102,7 +174,7 @@ func CreateArticle(rw http.ResponseWriter, r *http.Request) {
 
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Println(err)
+		requestLogger(r).Error("CreateArticle: read body", "error", err)
 		models.ResponseErrorServer(rw)
 		return
 	}
@@ -110,13 +182,13 @@ func CreateArticle(rw http.ResponseWriter, r *http.Request) {
 	article := models.Article{}
 	err = json.Unmarshal(data, &article)
 	if err != nil {
-		log.Println(err)
+		requestLogger(r).Warn("CreateArticle: invalid body", "error", err)
 		models.ResponseBadRequest(rw)
 		return
 	}
 
 	ch := make(chan error, 1)
-	dbwork.DB.CreateArticle(login, article.Text, ch)
+	dbwork.DB.CreateArticle(r.Context(), login, article.Text, ch)
 	err = <-ch
 	if err != nil {
 		models.ResponseErrorServer(rw)
@@ -129,7 +201,7 @@ func CreateArticle(rw http.ResponseWriter, r *http.Request) {
 //
 // # Удаление статьи
 //
-// Требует аутентификации и проверки владельца.
+// Требует аутентификации. Удалить статью может её автор или администратор.
 //
 // responses:
 //
@@ -157,20 +229,30 @@ func DeleteArticle(rw http.ResponseWriter, r *http.Request) {
 		models.ResponseBadRequest(rw)
 		return
 	}
-	logger.Printf("DeleteArticle started for ID: %s", strId)
-	ok, err = dbwork.DB.VerifyArticleToUser(id, login)
+	requestLogger(r).Debug("DeleteArticle started", "id", id)
+	ok, err = dbwork.DB.VerifyArticleToUser(r.Context(), id, login)
 	if err != nil {
 		models.ResponseErrorServer(rw)
 		return
 	}
 
+	// Администратор может удалить любую статью
+	if !ok {
+		account, err := dbwork.DB.GetAccount(r.Context(), login)
+		if err != nil {
+			models.ResponseErrorServer(rw)
+			return
+		}
+		ok = account.Role == models.RoleAdmin
+	}
+
 	if !ok {
 		models.ResponseNew(rw, "Вы не можете изменять не свои записи", http.StatusBadRequest)
 		return
 	}
 
 	ch := make(chan error, 1)
-	dbwork.DB.DeleteArticle(id, ch)
+	dbwork.DB.DeleteArticle(r.Context(), id, ch)
 	err = <-ch
 	if err != nil {
 		models.ResponseErrorServer(rw)
@@ -209,27 +291,19 @@ func Register(rw http.ResponseWriter, r *http.Request) {
 		models.ResponseBadRequest(rw)
 		return
 	}
-	logger.Printf("Register started for user: %s", user.Login)
-	if len(user.Login) < 5 || len(user.Password) < 8 {
-		models.ResponseNew(
-			rw,
-			"Логин не может быть короче 5 символов, а пароль короче 8 символов",
-			http.StatusBadRequest,
-		)
+	requestLogger(r).Info("Register started", "login", user.Login)
+	if err := password.ValidateLogin(user.Login); err != nil {
+		models.ResponseNew(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if len(user.Login) >= 16 || len(user.Password) >= 20 {
-		models.ResponseNew(
-			rw,
-			"Логин не может быть длиннее 16 символов, а пороль длинее 20 символов",
-			http.StatusBadRequest,
-		)
+	if err := password.ValidatePassword(user.Login, user.Password); err != nil {
+		models.ResponseNew(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	ch := make(chan error, 1)
-	dbwork.DB.CreateUser(user.Login, user.Password, ch)
+	dbwork.DB.CreateUser(r.Context(), user.Login, user.Password, ch)
 	err = <-ch
 	if err != nil {
 		models.ResponseErrorServer(rw)
@@ -260,19 +334,25 @@ func GetArticle(rw http.ResponseWriter, r *http.Request) {
 		models.ResponseNotFound(rw)
 		return
 	}
-	logger.Printf("GetArticle started for ID: %s", strId)
-	articles, err := dbwork.DB.GetArticle(id)
+	requestLogger(r).Debug("GetArticle started", "id", id)
+	article, err := dbwork.DB.GetArticle(r.Context(), id)
 	if err != nil {
 		models.ResponseErrorServer(rw)
 		return
 	}
 
-	encoder := json.NewEncoder(rw)
-	err = encoder.Encode(articles)
-	if err != nil {
+	articles := []models.Article{article}
+	if err := prepareArticles(r, articles); err != nil {
 		models.ResponseErrorServer(rw)
 		return
 	}
+
+	setArticleCacheHeaders(rw)
+	if notModified(rw, r, articleETag(articles[0])) {
+		return
+	}
+
+	writeJSON(rw, r, articles[0])
 }
 
 // swagger:response articleResponse
@@ -285,24 +365,47 @@ type ArticleResponse struct {
 //
 // # Получение всех статей
 //
+// Параметр sort=most_liked сортирует статьи по числу лайков, sort=newest — от новых к старым.
+//
 // responses:
 //
 //	200: articlesResponse
+//	400: Response
 //	500: Response
 func GetAllArticle(rw http.ResponseWriter, r *http.Request) {
-	logger.Printf("GetAllArticle started")
-	article, err := dbwork.DB.GetAllArticle()
+	requestLogger(r).Debug("GetAllArticle started")
+	filter := models.ArticleFilter{Sort: r.URL.Query().Get("sort")}
+	switch filter.Sort {
+	case models.SortDefault, models.SortMostLiked, models.SortNewest:
+	default:
+		models.ResponseNew(rw, "Неизвестный порядок сортировки", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, ok := parsePagination(r, 0)
+	if !ok {
+		models.ResponseBadRequest(rw)
+		return
+	}
+	filter.Limit, filter.Offset = limit, offset
+
+	article, err := dbwork.DB.GetAllArticle(r.Context(), filter)
 	if err != nil {
 		models.ResponseNotFound(rw)
 		return
 	}
 
-	encoder := json.NewEncoder(rw)
-	err = encoder.Encode(article)
-	if err != nil {
+	if err := prepareArticles(r, article); err != nil {
 		models.ResponseErrorServer(rw)
 		return
 	}
+
+	setArticleCacheHeaders(rw)
+	if notModified(rw, r, articlesETag(article)) {
+		return
+	}
+
+	writeJSON(rw, r, article)
 }
 
 // swagger:response articlesResponse
@@ -315,7 +418,9 @@ type ArticlesResponse struct {
 //
 // # Обновление статьи
 //
-// Требует аутентификации и проверки владельца.
+// Требует аутентификации и проверки владельца. С заголовком If-Match,
+// содержащим ETag из GET /article/{id}, статья изменится только если
+// её текст с тех пор не менялся, иначе вернётся 412.
 //
 // responses:
 //
@@ -323,6 +428,7 @@ type ArticlesResponse struct {
 //	400: Response
 //	401: Response
 //	403: Response
+//	412: Response
 //	500: Response
 //
 // Параметры:
@@ -347,12 +453,12 @@ func UpdateArticle(rw http.ResponseWriter, r *http.Request) {
 	article := models.Article{}
 	err = json.Unmarshal(data, &article)
 	if err != nil {
-		log.Println(err)
+		requestLogger(r).Warn("UpdateArticle: invalid body", "error", err)
 		models.ResponseBadRequest(rw)
 		return
 	}
-	logger.Printf("UpdateArticle started for ID: %d", article.ID)
-	ok, err = dbwork.DB.VerifyArticleToUser(article.ID, login)
+	requestLogger(r).Debug("UpdateArticle started", "id", article.ID)
+	ok, err = dbwork.DB.VerifyArticleToUser(r.Context(), article.ID, login)
 	if err != nil {
 		models.ResponseErrorServer(rw)
 		return
@@ -363,13 +469,40 @@ func UpdateArticle(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expectedRevision := 0
+	if match := r.Header.Get("If-Match"); match != "" {
+		current, err := dbwork.DB.GetArticle(r.Context(), article.ID)
+		if err != nil {
+			models.ResponseErrorServer(rw)
+			return
+		}
+		if !articleRevisionMatches(match, current) {
+			preconditionFailed(rw)
+			return
+		}
+		expectedRevision = current.Revision
+	}
+
 	ch := make(chan error, 1)
-	dbwork.DB.UpdateArticle(article.ID, article.Text, ch)
+	dbwork.DB.UpdateArticle(r.Context(), article.ID, article.Text, expectedRevision, ch)
 	err = <-ch
+	if err == dbwork.ErrRevisionConflict {
+		preconditionFailed(rw)
+		return
+	}
 	if err != nil {
 		models.ResponseErrorServer(rw)
 		return
 	}
+
+	// Новый ETag позволяет сразу отправить следующее изменение с If-Match
+	updated, err := dbwork.DB.GetArticle(r.Context(), article.ID)
+	if err == nil {
+		articles := []models.Article{updated}
+		if markBookmarks(r, articles) == nil {
+			rw.Header().Set("ETag", articleETag(articles[0]))
+		}
+	}
 	models.ResponseOK(rw)
 }
 
@@ -377,6 +510,9 @@ func UpdateArticle(rw http.ResponseWriter, r *http.Request) {
 //
 // # Аутентификация
 //
+// Если у пользователя включена двухфакторная аутентификация, вместо JWT
+// возвращается токен первого шага для POST /login/2fa.
+//
 // responses:
 //
 //	200: jwtToken
@@ -403,22 +539,68 @@ func LoginHandler(rw http.ResponseWriter, r *http.Request) {
 		models.ResponseBadRequest(rw)
 		return
 	}
-	logger.Printf("Login attempt for: %s", loginRequest.Login)
-	verify, err := dbwork.DB.VerifyPassword(loginRequest.Login, loginRequest.Password)
+	requestLogger(r).Info("Login attempt", "login", loginRequest.Login)
+	verify, err := dbwork.DB.VerifyPassword(r.Context(), loginRequest.Login, loginRequest.Password)
 	if err != nil || !verify {
+		metrics.LoginAttempt(metrics.LoginPassword, false)
 		models.ResponseNew(rw, "Не верны пароль или логин", http.StatusUnauthorized)
 		return
 	}
+	metrics.LoginAttempt(metrics.LoginPassword, true)
 
-	token, err := auth.GenerateJWT(
-		loginRequest.Login,
-	)
+	state, err := dbwork.DB.GetTOTP(r.Context(), loginRequest.Login)
 	if err != nil {
 		models.ResponseErrorServer(rw)
 		return
 	}
+	if state.Enabled {
+		challenge, err := auth.GenerateChallengeJWT(loginRequest.Login)
+		if err != nil {
+			models.ResponseErrorServer(rw)
+			return
+		}
+		json.NewEncoder(rw).Encode(models.TwoFactorChallenge{
+			TwoFactorRequired: true,
+			Challenge:         challenge,
+		})
+		return
+	}
 
-	json.NewEncoder(rw).Encode(map[string]string{
-		"token": token,
-	})
+	issueSession(rw, loginRequest.Login)
+}
+
+// issueSession выдаёт JWT в теле ответа и/или в cookie в зависимости от режима аутентификации
+func issueSession(rw http.ResponseWriter, login string) {
+	token, err := auth.GenerateJWT(login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	response := make(map[string]string)
+	if auth.CookieEnabled() {
+		csrf, err := auth.SetSession(rw, token)
+		if err != nil {
+			models.ResponseErrorServer(rw)
+			return
+		}
+		response["csrf_token"] = csrf
+	}
+	if auth.BearerEnabled() {
+		response["token"] = token
+	}
+
+	json.NewEncoder(rw).Encode(response)
+}
+
+// swagger:route POST /logout user logout
+//
+// # Завершение cookie-сессии
+//
+// responses:
+//
+//	200: Response
+func Logout(rw http.ResponseWriter, r *http.Request) {
+	auth.ClearSession(rw)
+	models.ResponseOK(rw)
 }
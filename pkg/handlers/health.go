@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+	// Время, за которое БД должна ответить на проверку готовности
+	readinessTimeout = 2 * time.Second
+)
+
+var startedAt = time.Now()
+
+// Результат проверки готовности
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// swagger:route GET /healthz health healthz
+//
+// # Проверка, что процесс запущен
+//
+// Не обращается к БД и всегда отвечает 200, пока сервер принимает запросы.
+//
+// responses:
+//
+//	200: readinessResponse
+func Healthz(rw http.ResponseWriter, r *http.Request) {
+	writeHealth(rw, http.StatusOK, readiness{Status: statusOK})
+}
+
+// swagger:route GET /readyz health readyz
+//
+// # Проверка готовности принимать запросы
+//
+// Проверяет соединение с БД, версию миграций, работу управляющей горутины
+// и заполненность её очереди. Если хотя бы одна проверка не пройдена,
+// возвращается 503.
+//
+// responses:
+//
+//	200: readinessResponse
+//	503: readinessResponse
+func Readyz(rw http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	status, err := dbwork.DB.Status(ctx)
+	result := checkReadiness(status, err)
+
+	code := http.StatusOK
+	if result.Status != statusOK {
+		code = http.StatusServiceUnavailable
+		requestLogger(r).Warn("Readiness check failed", "checks", result.Checks)
+	}
+	writeHealth(rw, code, result)
+}
+
+// checkReadiness сводит состояние БД к набору проверок
+func checkReadiness(status models.DBStatus, err error) readiness {
+	result := readiness{Status: statusOK, Checks: make(map[string]string)}
+	fail := func(check, reason string) {
+		result.Status = statusUnavailable
+		result.Checks[check] = reason
+	}
+
+	result.Checks["database"] = statusOK
+	result.Checks["migrations"] = statusOK
+	if err != nil {
+		fail("database", err.Error())
+		fail("migrations", "версия неизвестна")
+	} else if status.Dirty {
+		fail("migrations", fmt.Sprintf("миграция %d не завершена", status.MigrationVersion))
+	} else if status.MigrationVersion != status.ExpectedVersion {
+		fail("migrations", fmt.Sprintf("версия %d, ожидается %d", status.MigrationVersion, status.ExpectedVersion))
+	}
+
+	result.Checks["writer"] = statusOK
+	if !status.WriterRunning {
+		fail("writer", "управляющая горутина не работает")
+	}
+
+	result.Checks["queue"] = statusOK
+	if status.QueueLength >= status.QueueCapacity {
+		fail("queue", fmt.Sprintf("очередь заполнена: %d из %d", status.QueueLength, status.QueueCapacity))
+	}
+	return result
+}
+
+// Сведения о сборке из runtime/debug
+type buildInfo struct {
+	GoVersion string `json:"go_version"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+// Сводка о состоянии сервера
+type debugStatus struct {
+	StartedAt     time.Time       `json:"started_at"`
+	UptimeSeconds int64           `json:"uptime_seconds"`
+	Build         buildInfo       `json:"build"`
+	Goroutines    int             `json:"goroutines"`
+	Readiness     readiness       `json:"readiness"`
+	Database      models.DBStatus `json:"database"`
+}
+
+// swagger:route GET /debug/status health debugStatus
+//
+// # Сводка о сборке, времени работы и состоянии БД
+//
+// Если задан METRICS_TOKEN, требуется заголовок Authorization: Bearer <METRICS_TOKEN>.
+//
+// responses:
+//
+//	200: debugStatusResponse
+func DebugStatus(rw http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	status, err := dbwork.DB.Status(ctx)
+	writeHealth(rw, http.StatusOK, debugStatus{
+		StartedAt:     startedAt.UTC(),
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+		Build:         readBuildInfo(),
+		Goroutines:    runtime.NumGoroutine(),
+		Readiness:     checkReadiness(status, err),
+		Database:      status,
+	})
+}
+
+func readBuildInfo() buildInfo {
+	result := buildInfo{GoVersion: runtime.Version(), Version: "unknown"}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return result
+	}
+
+	result.Version = info.Main.Version
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			result.Revision = setting.Value
+		case "vcs.time":
+			result.Time = setting.Value
+		case "vcs.modified":
+			result.Modified = setting.Value == "true"
+		}
+	}
+	return result
+}
+
+// writeHealth отвечает с настоящим кодом статуса: его проверяют
+// оркестраторы и балансировщики, а не клиенты API
+func writeHealth(rw http.ResponseWriter, code int, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(body)
+}
+
+// swagger:response readinessResponse
+type ReadinessResponse struct {
+	// in:body
+	Body readiness
+}
+
+// swagger:response debugStatusResponse
+type DebugStatusResponse struct {
+	// in:body
+	Body debugStatus
+}
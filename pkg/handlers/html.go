@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"blog/pkg/auth"
+	"blog/pkg/dbwork"
+	"blog/pkg/metrics"
+	"blog/pkg/models"
+	"blog/pkg/site"
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Страницы, которые сервер отдаёт в режиме HTML_UI. Адреса совпадают со
+// статической сборкой, а данные читаются так же, как в API
+
+// Размер страницы списков совпадает со статической сборкой, чтобы
+// адреса /page/N/ вели на те же статьи
+var htmlPageSize = site.DefaultStaticOptions().PageSize
+
+// newHTMLPage заполняет общие поля страницы: вошедшего пользователя и
+// его CSRF-токен для форм. Гостям cookie не выставляются
+func newHTMLPage(rw http.ResponseWriter, r *http.Request, title string) (site.Page, error) {
+	page := site.NewPage(title)
+	page.Accounts = auth.CookieEnabled()
+	if login, ok := r.Context().Value("login").(string); ok {
+		csrf, err := auth.CSRFToken(rw, r)
+		if err != nil {
+			return page, err
+		}
+		page.User = login
+		page.CSRFToken = csrf
+	}
+	return page, nil
+}
+
+// renderHTML рендерит страницу целиком до отправки, чтобы ошибка шаблона
+// не оставила клиенту половину страницы с кодом 200
+func renderHTML(rw http.ResponseWriter, r *http.Request, status int, name string, page site.Page) {
+	var buffer bytes.Buffer
+	if err := site.Render(&buffer, name, page); err != nil {
+		requestLogger(r).Error("Ошибка рендеринга страницы", "page", name, "error", err)
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Страница зависит от того, вошёл ли пользователь
+	rw.Header().Set("Vary", "Cookie")
+	rw.WriteHeader(status)
+	rw.Write(buffer.Bytes())
+}
+
+// htmlError показывает страницу ошибки с настоящим кодом ответа
+func htmlError(rw http.ResponseWriter, r *http.Request, status int, message string) {
+	page, err := newHTMLPage(rw, r, http.StatusText(status))
+	if err != nil {
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	page.Error = message
+	renderHTML(rw, r, status, site.PageError, page)
+}
+
+// HTMLIndex показывает страницу общего списка статей
+func HTMLIndex(rw http.ResponseWriter, r *http.Request) {
+	number, ok := htmlPageNumber(r)
+	if !ok {
+		htmlError(rw, r, http.StatusNotFound, "Страница не найдена")
+		return
+	}
+	requestLogger(r).Debug("HTMLIndex started", "page", number)
+
+	title := ""
+	if number > 1 {
+		title = "Страница " + strconv.Itoa(number)
+	}
+	page, err := newHTMLPage(rw, r, title)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось загрузить страницу")
+		return
+	}
+	htmlList(rw, r, page, site.PageIndex, models.ArticleFilter{}, number, site.IndexPath)
+}
+
+// HTMLAuthor показывает статьи автора
+func HTMLAuthor(rw http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+	number, ok := htmlPageNumber(r)
+	if !ok {
+		htmlError(rw, r, http.StatusNotFound, "Страница не найдена")
+		return
+	}
+	requestLogger(r).Debug("HTMLAuthor started", "login", login, "page", number)
+
+	exists, err := dbwork.DB.UserExists(r.Context(), login)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось загрузить страницу")
+		return
+	}
+	if !exists {
+		htmlError(rw, r, http.StatusNotFound, "Пользователь не найден")
+		return
+	}
+
+	page, err := newHTMLPage(rw, r, login)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось загрузить страницу")
+		return
+	}
+	page.Author = login
+	page.Feeds = append(page.Feeds, site.FeedLink{
+		Title: "Atom: " + login,
+		Type:  "application/atom+xml",
+		URL:   "/user/" + login + "/feed.atom",
+	})
+	pagePath := func(number int) string { return site.AuthorPath(login, number) }
+	htmlList(rw, r, page, site.PageAuthor, models.ArticleFilter{Author: login}, number, pagePath)
+}
+
+// htmlPageNumber читает номер страницы из адреса, первая страница не имеет номера
+func htmlPageNumber(r *http.Request) (int, bool) {
+	value, ok := mux.Vars(r)["page"]
+	if !ok {
+		return 1, true
+	}
+	number, err := strconv.Atoi(value)
+	return number, err == nil && number > 1
+}
+
+// htmlList выводит страницу списка. Запрашивается на одну статью больше,
+// чтобы без подсчёта всех статей узнать, есть ли следующая страница
+func htmlList(rw http.ResponseWriter, r *http.Request, page site.Page, name string, filter models.ArticleFilter, number int, pagePath func(int) string) {
+	filter.Sort = models.SortNewest
+	filter.Limit = htmlPageSize + 1
+	filter.Offset = (number - 1) * htmlPageSize
+	articles, err := dbwork.DB.GetAllArticle(r.Context(), filter)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось загрузить статьи")
+		return
+	}
+	if number > 1 && len(articles) == 0 {
+		htmlError(rw, r, http.StatusNotFound, "Страница не найдена")
+		return
+	}
+
+	hasNext := len(articles) > htmlPageSize
+	articles = articles[:min(len(articles), htmlPageSize)]
+	page.Articles = make([]site.ArticleView, 0, len(articles))
+	for _, article := range articles {
+		view, err := site.NewArticleView(article)
+		if err != nil {
+			htmlError(rw, r, http.StatusInternalServerError, "Не удалось загрузить статьи")
+			return
+		}
+		page.Articles = append(page.Articles, view)
+	}
+	page.Pagination = site.NewOpenPagination(number, hasNext, pagePath)
+	renderHTML(rw, r, http.StatusOK, name, page)
+}
+
+// HTMLArticle показывает статью
+func HTMLArticle(rw http.ResponseWriter, r *http.Request) {
+	article, ok := htmlArticle(rw, r)
+	if !ok {
+		return
+	}
+	requestLogger(r).Debug("HTMLArticle started", "id", article.ID)
+
+	view, err := site.NewArticleView(article)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось загрузить статью")
+		return
+	}
+	page, err := newHTMLPage(rw, r, view.Title)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось загрузить статью")
+		return
+	}
+	page.Article = &view
+	page.CanEdit = page.User != "" && page.User == article.Author
+	renderHTML(rw, r, http.StatusOK, site.PageArticle, page)
+}
+
+// htmlArticle загружает статью из адреса и сам отвечает, если её нет
+func htmlArticle(rw http.ResponseWriter, r *http.Request) (models.Article, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		htmlError(rw, r, http.StatusNotFound, "Статья не найдена")
+		return models.Article{}, false
+	}
+	article, err := dbwork.DB.GetArticle(r.Context(), id)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось загрузить статью")
+		return article, false
+	}
+	if article.ID == 0 {
+		htmlError(rw, r, http.StatusNotFound, "Статья не найдена")
+		return article, false
+	}
+	return article, true
+}
+
+// HTMLLoginForm показывает форму входа
+func HTMLLoginForm(rw http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value("login").(string); ok {
+		http.Redirect(rw, r, "/", http.StatusSeeOther)
+		return
+	}
+	renderLogin(rw, r, http.StatusOK, loginForm{})
+}
+
+// Состояние формы входа при повторном показе
+type loginForm struct {
+	Error     string
+	Login     string
+	Challenge string
+}
+
+// renderLogin показывает форму входа с CSRF-токеном, который выдаётся и гостю
+func renderLogin(rw http.ResponseWriter, r *http.Request, status int, form loginForm) {
+	page, err := newHTMLPage(rw, r, "Вход")
+	if err == nil {
+		page.CSRFToken, err = auth.CSRFToken(rw, r)
+	}
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось открыть форму входа")
+		return
+	}
+	page.Error = form.Error
+	page.Login = form.Login
+	page.Challenge = form.Challenge
+	renderHTML(rw, r, status, site.PageLogin, page)
+}
+
+// HTMLLogin проверяет форму входа. Как и в API, при включённой двухфакторной
+// аутентификации вход проходит в два шага: форма с кодом несёт токен первого шага
+func HTMLLogin(rw http.ResponseWriter, r *http.Request) {
+	if !auth.ValidCSRF(r) {
+		renderLogin(rw, r, http.StatusForbidden, loginForm{Error: "Форма устарела, попробуйте ещё раз"})
+		return
+	}
+	if r.PostFormValue("challenge") != "" {
+		htmlLoginTwoFactor(rw, r)
+		return
+	}
+
+	login := r.PostFormValue("login")
+	requestLogger(r).Info("Login attempt", "login", login)
+	verify, err := dbwork.DB.VerifyPassword(r.Context(), login, r.PostFormValue("password"))
+	if err != nil || !verify {
+		metrics.LoginAttempt(metrics.LoginPassword, false)
+		renderLogin(rw, r, http.StatusUnauthorized, loginForm{Error: "Не верны пароль или логин", Login: login})
+		return
+	}
+	metrics.LoginAttempt(metrics.LoginPassword, true)
+
+	state, err := dbwork.DB.GetTOTP(r.Context(), login)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось выполнить вход")
+		return
+	}
+	if state.Enabled {
+		challenge, err := auth.GenerateChallengeJWT(login)
+		if err != nil {
+			htmlError(rw, r, http.StatusInternalServerError, "Не удалось выполнить вход")
+			return
+		}
+		renderLogin(rw, r, http.StatusOK, loginForm{Challenge: challenge})
+		return
+	}
+
+	startHTMLSession(rw, r, login)
+}
+
+func htmlLoginTwoFactor(rw http.ResponseWriter, r *http.Request) {
+	claims, err := auth.ParseChallengeJWT(r.PostFormValue("challenge"))
+	if err != nil {
+		metrics.LoginAttempt(metrics.LoginTwoFactor, false)
+		renderLogin(rw, r, http.StatusUnauthorized, loginForm{Error: "Время на ввод кода истекло, войдите заново"})
+		return
+	}
+	requestLogger(r).Info("Two-factor login attempt", "login", claims.Login)
+
+	verified, err := auth.VerifyChallenge(claims, func() (bool, error) {
+		return verifySecondFactor(r.Context(), claims.Login, r.PostFormValue("code"))
+	})
+	if err == auth.ErrChallengeExhausted || err == auth.ErrAccountLocked {
+		metrics.LoginAttempt(metrics.LoginTwoFactor, false)
+		renderLogin(rw, r, http.StatusUnauthorized, loginForm{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось выполнить вход")
+		return
+	}
+	if !verified {
+		metrics.LoginAttempt(metrics.LoginTwoFactor, false)
+		renderLogin(rw, r, http.StatusUnauthorized, loginForm{Error: "Неверный код", Challenge: r.PostFormValue("challenge")})
+		return
+	}
+
+	metrics.LoginAttempt(metrics.LoginTwoFactor, true)
+	startHTMLSession(rw, r, claims.Login)
+}
+
+// startHTMLSession выдаёт cookie-сессию и возвращает на главную
+func startHTMLSession(rw http.ResponseWriter, r *http.Request, login string) {
+	token, err := auth.GenerateJWT(login)
+	if err == nil {
+		_, err = auth.SetSession(rw, token)
+	}
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось выполнить вход")
+		return
+	}
+	http.Redirect(rw, r, "/", http.StatusSeeOther)
+}
+
+// HTMLLogout завершает cookie-сессию
+func HTMLLogout(rw http.ResponseWriter, r *http.Request) {
+	if !auth.ValidCSRF(r) {
+		htmlError(rw, r, http.StatusForbidden, "Форма устарела, обновите страницу")
+		return
+	}
+	auth.ClearSession(rw)
+	http.Redirect(rw, r, "/", http.StatusSeeOther)
+}
+
+// HTMLEditor показывает форму новой статьи или изменения статьи автора
+func HTMLEditor(rw http.ResponseWriter, r *http.Request) {
+	page, ok := htmlEditorPage(rw, r)
+	if !ok {
+		return
+	}
+	renderHTML(rw, r, http.StatusOK, site.PageEditor, page)
+}
+
+// HTMLSaveArticle сохраняет статью из формы редактора
+func HTMLSaveArticle(rw http.ResponseWriter, r *http.Request) {
+	page, ok := htmlEditorPage(rw, r)
+	if !ok {
+		return
+	}
+	if !auth.ValidCSRF(r) {
+		htmlError(rw, r, http.StatusForbidden, "Форма устарела, обновите страницу")
+		return
+	}
+
+	// Браузеры переводят строки в textarea как CRLF
+	page.Form.Text = strings.ReplaceAll(r.PostFormValue("text"), "\r\n", "\n")
+	if strings.TrimSpace(page.Form.Text) == "" {
+		page.Error = "Текст статьи не может быть пустым"
+		renderHTML(rw, r, http.StatusBadRequest, site.PageEditor, page)
+		return
+	}
+
+	ch := make(chan error, 1)
+	if page.Article == nil {
+		requestLogger(r).Debug("HTMLSaveArticle started")
+		dbwork.DB.CreateArticle(r.Context(), page.User, page.Form.Text, ch)
+		if err := <-ch; err != nil {
+			htmlError(rw, r, http.StatusInternalServerError, "Не удалось сохранить статью")
+			return
+		}
+		http.Redirect(rw, r, site.AuthorPath(page.User, 1), http.StatusSeeOther)
+		return
+	}
+
+	id := page.Article.ID
+	requestLogger(r).Debug("HTMLSaveArticle started", "id", id)
+	revision, err := strconv.Atoi(r.PostFormValue("revision"))
+	if err != nil || revision < 0 {
+		htmlError(rw, r, http.StatusBadRequest, "Неверная форма")
+		return
+	}
+	dbwork.DB.UpdateArticle(r.Context(), id, page.Form.Text, revision, ch)
+	err = <-ch
+	if err == dbwork.ErrRevisionConflict {
+		// Форма получает текущую ревизию: повторное сохранение заменит чужое изменение
+		page.Error = "Статья была изменена, пока вы её редактировали. Сохраните ещё раз, чтобы заменить её вашим текстом"
+		renderHTML(rw, r, http.StatusConflict, site.PageEditor, page)
+		return
+	}
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось сохранить статью")
+		return
+	}
+	http.Redirect(rw, r, site.ArticlePath(id), http.StatusSeeOther)
+}
+
+// htmlEditorPage готовит страницу редактора. Гость отправляется на вход,
+// чужую статью изменить нельзя. Для существующей статьи page.Article
+// заполнен, а форма содержит её текущий текст и ревизию
+func htmlEditorPage(rw http.ResponseWriter, r *http.Request) (site.Page, bool) {
+	if _, ok := r.Context().Value("login").(string); !ok {
+		http.Redirect(rw, r, "/account/login", http.StatusSeeOther)
+		return site.Page{}, false
+	}
+
+	if _, ok := mux.Vars(r)["id"]; !ok {
+		page, err := newHTMLPage(rw, r, "Новая статья")
+		if err != nil {
+			htmlError(rw, r, http.StatusInternalServerError, "Не удалось открыть редактор")
+			return page, false
+		}
+		page.Form.Action = "/write"
+		return page, true
+	}
+
+	article, ok := htmlArticle(rw, r)
+	if !ok {
+		return site.Page{}, false
+	}
+	view, err := site.NewArticleView(article)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось открыть редактор")
+		return site.Page{}, false
+	}
+	page, err := newHTMLPage(rw, r, "Изменение: "+view.Title)
+	if err != nil {
+		htmlError(rw, r, http.StatusInternalServerError, "Не удалось открыть редактор")
+		return page, false
+	}
+	if page.User != article.Author {
+		htmlError(rw, r, http.StatusForbidden, "Вы не можете изменять не свои записи.")
+		return page, false
+	}
+	page.Article = &view
+	page.Form = site.ArticleForm{
+		Action:   site.ArticlePath(article.ID) + "edit",
+		Revision: article.Revision,
+		Text:     article.Text,
+	}
+	return page, true
+}
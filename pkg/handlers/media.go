@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/media"
+	"blog/pkg/models"
+	"blog/pkg/storage"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	mediaFormField   = "file"
+	maxMediaNameSize = 255
+	// Запас на заголовки multipart поверх размера самого файла
+	multipartOverhead = 64 << 10
+)
+
+// swagger:route POST /media media uploadMedia
+//
+// # Загрузка изображения
+//
+// Файл передаётся в поле file формы multipart/form-data.
+// Тип определяется по содержимому, разрешены JPEG, PNG, GIF и WebP.
+//
+// responses:
+//
+//	201: mediaResponse
+//	400: Response
+//	401: Response
+//	403: Response
+//	413: Response
+//	415: Response
+//	500: Response
+func UploadMedia(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+	requestLogger(r).Debug("UploadMedia started", "login", login)
+
+	maxBytes := media.CurrentConfig().MaxBytes
+	r.Body = http.MaxBytesReader(rw, r.Body, maxBytes+multipartOverhead)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		models.ResponseNew(rw, "Ожидается multipart/form-data", http.StatusBadRequest)
+		return
+	}
+
+	data, name, err := readMediaPart(reader, maxBytes)
+	if errors.Is(err, media.ErrTooLarge) {
+		models.ResponseNew(rw, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		models.ResponseNew(rw, "Файл не передан", http.StatusBadRequest)
+		return
+	}
+
+	contentType, err := media.DetectType(data)
+	if err != nil {
+		models.ResponseNew(rw, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	thumbnail, thumbnailType, err := media.Thumbnail(data)
+	if errors.Is(err, media.ErrTooLarge) {
+		models.ResponseNew(rw, "Изображение слишком большое", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		models.ResponseNew(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := uuid.NewString()
+	file := models.Media{
+		ID:            id,
+		Owner:         login,
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		Name:          name,
+		StorageKey:    "originals/" + id,
+		ThumbnailKey:  "thumbnails/" + id,
+		ThumbnailType: thumbnailType,
+	}
+
+	ctx := r.Context()
+	err = storage.Store.Put(ctx, file.StorageKey, bytes.NewReader(data), file.Size, file.ContentType)
+	if err != nil {
+		requestLogger(r).Error("UploadMedia: store original", "error", err)
+		models.ResponseErrorServer(rw)
+		return
+	}
+	err = storage.Store.Put(ctx, file.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), thumbnailType)
+	if err != nil {
+		requestLogger(r).Error("UploadMedia: store thumbnail", "error", err)
+		removeMediaFiles(r, file)
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.CreateMedia(r.Context(), login, file, ch)
+	err = <-ch
+	if err != nil {
+		removeMediaFiles(r, file)
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	// Время создания выставляет БД, перечитываем запись
+	file, err = dbwork.DB.GetMedia(r.Context(), id)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	setMediaURLs(&file)
+
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(file)
+}
+
+// readMediaPart находит в форме поле с файлом и читает его не больше maxBytes
+func readMediaPart(reader *multipart.Reader, maxBytes int64) ([]byte, string, error) {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, "", media.ErrTooLarge
+			}
+			return nil, "", err
+		}
+		if part.FormName() != mediaFormField {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		data, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || int64(len(data)) > maxBytes {
+			return nil, "", media.ErrTooLarge
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if len(data) == 0 {
+			return nil, "", io.ErrUnexpectedEOF
+		}
+		return data, cleanMediaName(part.FileName()), nil
+	}
+}
+
+// cleanMediaName оставляет от имени файла только последний элемент пути
+func cleanMediaName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "." || name == "/" || !utf8.ValidString(name) {
+		return ""
+	}
+	for len(name) > maxMediaNameSize {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+func setMediaURLs(file *models.Media) {
+	file.URL = "/media/" + file.ID
+	file.ThumbnailURL = "/media/" + file.ID + "/thumbnail"
+}
+
+func removeMediaFiles(r *http.Request, file models.Media) {
+	for _, key := range []string{file.StorageKey, file.ThumbnailKey} {
+		// Файлы удаляются и после отмены запроса клиентом
+		if err := storage.Store.Delete(context.WithoutCancel(r.Context()), key); err != nil {
+			requestLogger(r).Error("Не удалось удалить файл", "key", key, "error", err)
+		}
+	}
+}
+
+// swagger:response mediaResponse
+type MediaResponse struct {
+	// in:body
+	Body models.Media
+}
+
+// swagger:route GET /media/{id} media getMedia
+//
+// # Получение загруженного файла
+//
+// В ответе возвращается само содержимое файла.
+//
+// responses:
+//
+//	404: Response
+//	500: Response
+func GetMedia(rw http.ResponseWriter, r *http.Request) {
+	serveMedia(rw, r, false)
+}
+
+// swagger:route GET /media/{id}/thumbnail media getMediaThumbnail
+//
+// # Получение миниатюры изображения
+//
+// Большая сторона миниатюры не превышает MEDIA_THUMBNAIL_SIZE пикселей.
+//
+// responses:
+//
+//	404: Response
+//	500: Response
+func GetMediaThumbnail(rw http.ResponseWriter, r *http.Request) {
+	serveMedia(rw, r, true)
+}
+
+func serveMedia(rw http.ResponseWriter, r *http.Request, thumbnail bool) {
+	file, ok := lookupMedia(rw, r)
+	if !ok {
+		return
+	}
+
+	key, contentType, size := file.StorageKey, file.ContentType, file.Size
+	if thumbnail {
+		key, contentType, size = file.ThumbnailKey, file.ThumbnailType, -1
+	}
+
+	body, err := storage.Store.Get(r.Context(), key)
+	if err == storage.ErrNotFound {
+		models.ResponseNotFound(rw)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("GetMedia: open file", "error", err)
+		models.ResponseErrorServer(rw)
+		return
+	}
+	defer body.Close()
+
+	header := rw.Header()
+	header.Set("Content-Type", contentType)
+	// Браузер не должен угадывать тип или исполнять содержимое файла
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	// Содержимое по идентификатору никогда не меняется
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	if size >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	if _, err := io.Copy(rw, body); err != nil {
+		requestLogger(r).Warn("GetMedia: copy file", "error", err)
+	}
+}
+
+// lookupMedia находит запись о файле по идентификатору из пути
+func lookupMedia(rw http.ResponseWriter, r *http.Request) (models.Media, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		models.ResponseNotFound(rw)
+		return models.Media{}, false
+	}
+	requestLogger(r).Debug("Media requested", "id", id.String())
+
+	file, err := dbwork.DB.GetMedia(r.Context(), id.String())
+	if err == dbwork.ErrNotFound {
+		models.ResponseNotFound(rw)
+		return file, false
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return file, false
+	}
+	return file, true
+}
+
+// swagger:route DELETE /media/{id} media deleteMedia
+//
+// # Удаление загруженного файла
+//
+// Удалить файл может только загрузивший его пользователь.
+//
+// responses:
+//
+//	200: Response
+//	401: Response
+//	403: Response
+//	404: Response
+//	500: Response
+func DeleteMedia(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	file, ok := lookupMedia(rw, r)
+	if !ok {
+		return
+	}
+	if file.Owner != login {
+		models.ResponseNew(rw, "Вы не можете удалять чужие файлы", http.StatusForbidden)
+		return
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.DeleteMedia(r.Context(), login, file.ID, ch)
+	err := <-ch
+	if err == dbwork.ErrNotFound {
+		models.ResponseNotFound(rw)
+		return
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	removeMediaFiles(r, file)
+	models.ResponseOK(rw)
+}
+
+// swagger:route GET /user/me/media user getUserMedia
+//
+// # Файлы, загруженные пользователем
+//
+// Файлы отсортированы от новых к старым.
+//
+// responses:
+//
+//	200: mediaListResponse
+//	400: Response
+//	401: Response
+//	500: Response
+func GetUserMedia(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	limit, offset, ok := parsePagination(r, defaultPageSize)
+	if !ok {
+		models.ResponseBadRequest(rw)
+		return
+	}
+	requestLogger(r).Debug("GetUserMedia started", "login", login)
+
+	files, err := dbwork.DB.GetUserMedia(r.Context(), login, limit, offset)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	for i := range files {
+		setMediaURLs(&files[i])
+	}
+
+	writeJSON(rw, r, files)
+}
+
+// swagger:response mediaListResponse
+type MediaListResponse struct {
+	// in:body
+	Body []models.Media
+}
+
+// swagger:parameters getMedia getMediaThumbnail deleteMedia
+type MediaParams struct {
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
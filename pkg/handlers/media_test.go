@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/media"
+	"blog/pkg/models"
+	"blog/pkg/storage"
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"sync"
+	"testing"
+)
+
+// memoryStore хранит файлы в памяти вместо диска или S3
+type memoryStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (store *memoryStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.files[key] = data
+	return nil
+}
+
+func (store *memoryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	data, ok := store.files[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (store *memoryStore) Delete(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.files, key)
+	return nil
+}
+
+// mediaDB хранит записи о загруженных файлах
+type mediaDB struct {
+	dbwork.DataBase
+	files map[string]models.Media
+}
+
+func (db *mediaDB) CreateMedia(ctx context.Context, login string, file models.Media, ch chan error) {
+	db.files[file.ID] = file
+	ch <- nil
+	close(ch)
+}
+
+func (db *mediaDB) GetMedia(ctx context.Context, id string) (models.Media, error) {
+	file, ok := db.files[id]
+	if !ok {
+		return file, dbwork.ErrNotFound
+	}
+	return file, nil
+}
+
+func setupMedia(t *testing.T, maxBytes int64) *memoryStore {
+	t.Helper()
+	config := media.DefaultConfig()
+	config.MaxBytes = maxBytes
+	media.InitializationMedia(config)
+	t.Cleanup(func() { media.InitializationMedia(media.DefaultConfig()) })
+
+	store := &memoryStore{files: make(map[string][]byte)}
+	storage.Store = store
+	dbwork.DB = &mediaDB{files: make(map[string]models.Media)}
+	return store
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	buffer := bytes.Buffer{}
+	if err := png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// uploadMedia отправляет файл с заявленными клиентом именем и типом
+func uploadMedia(t *testing.T, name, contentType string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	body := bytes.Buffer{}
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+mediaFormField+`"; filename="`+name+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/media", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r = r.WithContext(context.WithValue(r.Context(), "login", "alice"))
+	rw := httptest.NewRecorder()
+	UploadMedia(rw, r)
+	return rw
+}
+
+func TestUploadMediaSizeLimit(t *testing.T) {
+	image := pngImage(t, 64, 64)
+
+	for _, test := range []struct {
+		name     string
+		maxBytes int64
+		data     []byte
+		code     int
+	}{
+		{"exactly the limit", int64(len(image)), image, http.StatusCreated},
+		{"one byte over", int64(len(image)) - 1, image, http.StatusRequestEntityTooLarge},
+		// Тело больше лимита даже с запасом на заголовки multipart
+		{"body over the limit", 16, bytes.Repeat([]byte{0}, multipartOverhead+1024), http.StatusRequestEntityTooLarge},
+	} {
+		store := setupMedia(t, test.maxBytes)
+		rw := uploadMedia(t, "image.png", "image/png", test.data)
+		if rw.Code != test.code {
+			t.Errorf("%s: status %d, want %d: %s", test.name, rw.Code, test.code, rw.Body)
+		}
+		if test.code != http.StatusCreated && len(store.files) != 0 {
+			t.Errorf("%s: rejected upload stored %d files", test.name, len(store.files))
+		}
+	}
+}
+
+func TestUploadMediaSniffsContentType(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		fileName    string
+		declared    string
+		data        []byte
+		code        int
+		contentType string
+	}{
+		{"png named as text", "notes.txt", "text/plain", pngImage(t, 8, 8), http.StatusCreated, "image/png"},
+		{"html named as png", "image.png", "image/png", []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType, ""},
+		{"svg", "image.svg", "image/svg+xml", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), http.StatusUnsupportedMediaType, ""},
+		{"gif header without image", "image.gif", "image/gif", []byte("GIF89a"), http.StatusBadRequest, ""},
+	} {
+		store := setupMedia(t, media.DefaultConfig().MaxBytes)
+		rw := uploadMedia(t, test.fileName, test.declared, test.data)
+		if rw.Code != test.code {
+			t.Errorf("%s: status %d, want %d: %s", test.name, rw.Code, test.code, rw.Body)
+			continue
+		}
+		if test.code != http.StatusCreated {
+			if len(store.files) != 0 {
+				t.Errorf("%s: rejected upload stored %d files", test.name, len(store.files))
+			}
+			continue
+		}
+
+		file := models.Media{}
+		if err := json.Unmarshal(rw.Body.Bytes(), &file); err != nil {
+			t.Fatal(err)
+		}
+		if file.ContentType != test.contentType || file.Name != test.fileName {
+			t.Errorf("%s: stored as %q named %q", test.name, file.ContentType, file.Name)
+		}
+		if _, ok := store.files["originals/"+file.ID]; !ok {
+			t.Errorf("%s: original not stored", test.name)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"blog/pkg/auth"
+	"blog/pkg/dbwork"
+	"blog/pkg/metrics"
+	"blog/pkg/models"
+	"blog/pkg/oidc"
+	"blog/pkg/password"
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const oidcFlowCookie = "oidc_flow"
+
+// swagger:route GET /auth/oidc/login user oidcLogin
+//
+// # Вход через корпоративного провайдера OpenID Connect
+//
+// Перенаправляет на страницу авторизации провайдера (authorization code + PKCE).
+//
+// responses:
+//
+//	404: Response
+//	500: Response
+func OIDCLogin(rw http.ResponseWriter, r *http.Request) {
+	if !oidc.Enabled() {
+		models.ResponseNotFound(rw)
+		return
+	}
+	startOIDCFlow(rw, r, "")
+}
+
+// swagger:route GET /auth/oidc/link user oidcLink
+//
+// # Привязка учётной записи провайдера OpenID Connect
+//
+// Доступна из cookie-сессии при OIDC_LINK_EXISTING=true. После входа
+// у провайдера его учётная запись связывается с текущим пользователем.
+//
+// responses:
+//
+//	401: Response
+//	404: Response
+//	500: Response
+func OIDCLink(rw http.ResponseWriter, r *http.Request) {
+	if !oidc.Enabled() || !oidc.CurrentConfig().LinkExisting {
+		models.ResponseNotFound(rw)
+		return
+	}
+	login, _ := r.Context().Value("login").(string)
+	startOIDCFlow(rw, r, login)
+}
+
+// startOIDCFlow сохраняет состояние входа в cookie и перенаправляет
+// к провайдеру. Непустой link привязывает учётную запись к этому пользователю
+func startOIDCFlow(rw http.ResponseWriter, r *http.Request, link string) {
+	flow, err := oidc.NewFlow()
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	flow.Link = link
+
+	redirect, err := oidc.AuthCodeURL(r.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		requestLogger(r).Error("OIDC discovery failed", "error", err)
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	value, err := oidc.EncodeFlow(flow)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		Expires:  flow.ExpiresAt.Time,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(oidc.CurrentConfig().RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(rw, r, redirect, http.StatusFound)
+}
+
+// swagger:route GET /auth/oidc/callback user oidcCallback
+//
+// # Завершение входа через провайдера OpenID Connect
+//
+// Проверяет ответ провайдера, при первом входе создаёт или связывает
+// пользователя и выдаёт JWT блога.
+//
+// responses:
+//
+//	200: jwtToken
+//	400: Response
+//	401: Response
+//	404: Response
+//	500: Response
+func OIDCCallback(rw http.ResponseWriter, r *http.Request) {
+	if !oidc.Enabled() {
+		models.ResponseNotFound(rw)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		requestLogger(r).Warn("OIDC provider error", "error", providerError, "description", query.Get("error_description"))
+		metrics.LoginAttempt(metrics.LoginOIDC, false)
+		models.ResponseNew(rw, "Провайдер отклонил вход", http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		models.ResponseNew(rw, oidc.ErrInvalidFlow.Error(), http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(rw, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Path:     "/auth/oidc",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+	})
+
+	flow, err := oidc.DecodeFlow(cookie.Value)
+	if err != nil || subtle.ConstantTimeCompare([]byte(flow.State), []byte(query.Get("state"))) != 1 {
+		models.ResponseNew(rw, oidc.ErrInvalidFlow.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := oidc.Exchange(r.Context(), query.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		requestLogger(r).Warn("OIDC code exchange failed", "error", err)
+		metrics.LoginAttempt(metrics.LoginOIDC, false)
+		models.ResponseNew(rw, "Не удалось подтвердить вход у провайдера", http.StatusUnauthorized)
+		return
+	}
+
+	login, err := externalLogin(r.Context(), claims, flow.Link)
+	if err == dbwork.ErrIdentityLinked {
+		metrics.LoginAttempt(metrics.LoginOIDC, false)
+		models.ResponseNew(rw, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	account, err := dbwork.DB.GetAccount(r.Context(), login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	if account.DisabledAt != nil {
+		metrics.LoginAttempt(metrics.LoginOIDC, false)
+		models.ResponseNew(rw, auth.ErrAccountDisabled.Error(), http.StatusForbidden)
+		return
+	}
+	requestLogger(r).Info("OIDC login", "login", login)
+	metrics.LoginAttempt(metrics.LoginOIDC, true)
+
+	target := oidc.CurrentConfig().PostLoginRedirect
+	if target == "" {
+		issueSession(rw, login)
+		return
+	}
+
+	token, err := auth.GenerateJWT(login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	if auth.CookieEnabled() {
+		if _, err := auth.SetSession(rw, token); err != nil {
+			models.ResponseErrorServer(rw)
+			return
+		}
+	}
+	if auth.BearerEnabled() {
+		fragment := url.Values{}
+		fragment.Set("token", token)
+		target += "#" + fragment.Encode()
+	}
+	http.Redirect(rw, r, target, http.StatusFound)
+}
+
+// externalLogin находит пользователя блога по внешней учётной записи.
+// При первом входе она привязывается к пользователю link, если привязку
+// начали из его сессии, а иначе для неё создаётся новый пользователь.
+// Утверждения провайдера вроде preferred_username задаёт сам владелец
+// внешней учётной записи, поэтому по ним существующие логины не связываются
+func externalLogin(ctx context.Context, claims *oidc.IDTokenClaims, link string) (string, error) {
+	login, err := dbwork.DB.GetLoginByIdentity(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		if link != "" && login != link {
+			return "", dbwork.ErrIdentityLinked
+		}
+		return login, nil
+	}
+	if err != dbwork.ErrNotFound {
+		return "", err
+	}
+
+	candidate := link
+	if candidate == "" {
+		policy := password.CurrentPolicy()
+		candidate = oidc.LoginCandidate(claims, policy.LoginMinLength, policy.LoginMaxLength)
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.ProvisionExternalUser(ctx, candidate, claims.Issuer, claims.Subject, link != "", ch)
+	err = <-ch
+	if err != nil {
+		return "", err
+	}
+
+	return dbwork.DB.GetLoginByIdentity(ctx, claims.Issuer, claims.Subject)
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"blog/pkg/auth"
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"blog/pkg/oidc"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	stubClientID = "blog"
+	stubSubject  = "subject-1"
+	stubCode     = "code-1"
+)
+
+// stubProvider — локальный провайдер OpenID Connect: discovery, JWKS,
+// страница авторизации и обмен кода с проверкой PKCE
+type stubProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu        sync.Mutex
+	nonce     string
+	challenge string
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &stubProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]string{
+			"issuer":                 provider.server.URL,
+			"authorization_endpoint": provider.server.URL + "/authorize",
+			"token_endpoint":         provider.server.URL + "/token",
+			"jwks_uri":               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", provider.token)
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+// authorize запоминает nonce и code_challenge из адреса авторизации,
+// как это сделал бы провайдер, и возвращает state
+func (provider *stubProvider) authorize(t *testing.T, location string) string {
+	t.Helper()
+	address, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := address.Query()
+	if query.Get("client_id") != stubClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", location)
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	provider.nonce = query.Get("nonce")
+	provider.challenge = query.Get("code_challenge")
+	return query.Get("state")
+}
+
+func (provider *stubProvider) token(rw http.ResponseWriter, r *http.Request) {
+	provider.mu.Lock()
+	nonce, challenge := provider.nonce, provider.challenge
+	provider.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if r.PostFormValue("code") != stubCode || base64.RawURLEncoding.EncodeToString(verifier[:]) != challenge {
+		rw.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, oidc.IDTokenClaims{
+		Nonce:             nonce,
+		PreferredUsername: "alice",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    provider.server.URL,
+			Subject:   stubSubject,
+			Audience:  jwt.ClaimStrings{stubClientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(provider.key)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(rw).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+// oidcDB хранит внешние учётные записи в памяти
+type oidcDB struct {
+	dbwork.DataBase
+	identities map[string]string
+}
+
+func (db *oidcDB) GetLoginByIdentity(ctx context.Context, issuer, subject string) (string, error) {
+	login, ok := db.identities[issuer+" "+subject]
+	if !ok {
+		return "", dbwork.ErrNotFound
+	}
+	return login, nil
+}
+
+func (db *oidcDB) ProvisionExternalUser(ctx context.Context, login, issuer, subject string, link bool, ch chan error) {
+	db.identities[issuer+" "+subject] = login
+	ch <- nil
+	close(ch)
+}
+
+func (db *oidcDB) GetAccount(ctx context.Context, login string) (models.Account, error) {
+	for _, known := range db.identities {
+		if known == login {
+			return models.Account{Login: login, Role: models.RoleUser}, nil
+		}
+	}
+	return models.Account{}, dbwork.ErrNotFound
+}
+
+func setupOIDC(t *testing.T) *stubProvider {
+	t.Helper()
+	provider := newStubProvider(t)
+	dbwork.DB = &oidcDB{identities: make(map[string]string)}
+	auth.InitializationSecret("test-secret", 1)
+	if err := auth.InitializationSession(auth.SessionConfig{Mode: auth.ModeBearer}); err != nil {
+		t.Fatal(err)
+	}
+	oidc.InitializationOIDC(oidc.Config{
+		Issuer:      provider.server.URL,
+		ClientID:    stubClientID,
+		RedirectURL: "http://blog.test/auth/oidc/callback",
+		StateSecret: []byte("test-secret"),
+	})
+	t.Cleanup(func() { oidc.InitializationOIDC(oidc.Config{}) })
+	return provider
+}
+
+// startOIDCLogin проходит GET /auth/oidc/login и возвращает cookie состояния и state
+func startOIDCLogin(t *testing.T, provider *stubProvider) (*http.Cookie, string) {
+	t.Helper()
+	return startOIDCFlowWith(t, provider, OIDCLogin, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+}
+
+func startOIDCFlowWith(t *testing.T, provider *stubProvider, handler http.HandlerFunc, r *http.Request) (*http.Cookie, string) {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	handler(rw, r)
+	if rw.Code != http.StatusFound {
+		t.Fatalf("login status %d: %s", rw.Code, rw.Body)
+	}
+	cookies := rw.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookie {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	return cookies[0], provider.authorize(t, rw.Header().Get("Location"))
+}
+
+// responseCode возвращает код из тела стандартного ответа API,
+// а для остальных ответов — код строки статуса
+func responseCode(rw *httptest.ResponseRecorder) int {
+	response := models.Response{}
+	if json.Unmarshal(rw.Body.Bytes(), &response) == nil && response.Code != 0 {
+		return response.Code
+	}
+	return rw.Code
+}
+
+func oidcCallback(cookie *http.Cookie, state, code string) *httptest.ResponseRecorder {
+	query := url.Values{"state": {state}, "code": {code}}
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+query.Encode(), nil)
+	r.AddCookie(cookie)
+	rw := httptest.NewRecorder()
+	OIDCCallback(rw, r)
+	return rw
+}
+
+func TestOIDCCallbackIssuesSession(t *testing.T) {
+	provider := setupOIDC(t)
+	cookie, state := startOIDCLogin(t, provider)
+
+	rw := oidcCallback(cookie, state, stubCode)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("callback status %d: %s", rw.Code, rw.Body)
+	}
+	response := map[string]string{}
+	if err := json.NewDecoder(rw.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response["token"] == "" {
+		t.Fatalf("no session token in %v", response)
+	}
+
+	// Выданный токен принимается как сессия пользователя из ID-токена
+	var login string
+	handler := auth.AuthMiddleware()(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		login, _ = r.Context().Value("login").(string)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+response["token"])
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if login != "alice" {
+		t.Fatalf("session login %q, want alice", login)
+	}
+}
+
+func TestOIDCLinkAttachesToSessionUser(t *testing.T) {
+	provider := setupOIDC(t)
+	config := oidc.CurrentConfig()
+	config.LinkExisting = true
+	config.StateSecret = []byte("test-secret")
+	oidc.InitializationOIDC(config)
+
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/link", nil)
+	r = r.WithContext(context.WithValue(r.Context(), "login", "bob"))
+	cookie, state := startOIDCFlowWith(t, provider, OIDCLink, r)
+
+	if rw := oidcCallback(cookie, state, stubCode); rw.Code != http.StatusOK {
+		t.Fatalf("callback status %d: %s", rw.Code, rw.Body)
+	}
+	// preferred_username провайдера — alice, но привязка идёт к пользователю сессии
+	if login := dbwork.DB.(*oidcDB).identities[provider.server.URL+" "+stubSubject]; login != "bob" {
+		t.Fatalf("identity linked to %q, want bob", login)
+	}
+}
+
+func TestOIDCLinkDisabled(t *testing.T) {
+	setupOIDC(t)
+	r := httptest.NewRequest(http.MethodGet, "/auth/oidc/link", nil)
+	r = r.WithContext(context.WithValue(r.Context(), "login", "bob"))
+	rw := httptest.NewRecorder()
+	OIDCLink(rw, r)
+	if responseCode(rw) != http.StatusNotFound {
+		t.Fatalf("link without OIDC_LINK_EXISTING: status %d", responseCode(rw))
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidFlow(t *testing.T) {
+	provider := setupOIDC(t)
+	cookie, state := startOIDCLogin(t, provider)
+
+	if rw := oidcCallback(cookie, state+"x", stubCode); responseCode(rw) != http.StatusBadRequest {
+		t.Errorf("wrong state: status %d", responseCode(rw))
+	}
+	if rw := oidcCallback(cookie, state, "wrong-code"); responseCode(rw) != http.StatusUnauthorized {
+		t.Errorf("wrong code: status %d", responseCode(rw))
+	}
+}
+
+func TestOIDCFlowCookieIsNotASession(t *testing.T) {
+	provider := setupOIDC(t)
+	cookie, _ := startOIDCLogin(t, provider)
+	// Учётная запись с пустым логином есть, значит отказ зависит только от подписи
+	dbwork.DB.(*oidcDB).identities["-"] = ""
+
+	called := false
+	handler := auth.AuthMiddleware()(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+cookie.Value)
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, r)
+	if called || responseCode(rw) != http.StatusUnauthorized {
+		t.Fatalf("flow cookie accepted as session: status %d", responseCode(rw))
+	}
+}
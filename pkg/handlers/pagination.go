@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination читает параметры limit и offset. Если limit не задан,
+// используется defaultLimit (0 — без ограничения)
+func parsePagination(r *http.Request, defaultLimit int) (int, int, bool) {
+	query := r.URL.Query()
+	limit, offset := defaultLimit, 0
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return 0, 0, false
+		}
+		limit = parsed
+	}
+
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, false
+		}
+		offset = parsed
+	}
+	return limit, offset, true
+}
+
+// swagger:parameters getAllArticles getFeed getFollowers getFollowing getUserMedia
+type PaginationParams struct {
+	// Размер страницы, не больше 100
+	// in: query
+	Limit int `json:"limit"`
+
+	// Смещение от начала списка
+	// in: query
+	Offset int `json:"offset"`
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// swagger:route PUT /article/{id}/reactions/{kind} article setReaction
+//
+// # Добавление реакции на статью
+//
+// Повторная реакция того же вида ничего не меняет.
+//
+// responses:
+//
+//	200: Response
+//	400: Response
+//	401: Response
+//	404: Response
+//	500: Response
+func SetReaction(rw http.ResponseWriter, r *http.Request) {
+	login, id, kind, ok := reactionParams(rw, r)
+	if !ok {
+		return
+	}
+	requestLogger(r).Debug("SetReaction started", "id", id, "kind", kind)
+
+	ch := make(chan error, 1)
+	dbwork.DB.SetReaction(r.Context(), id, login, kind, ch)
+	err := <-ch
+	if err == dbwork.ErrNotFound {
+		models.ResponseNotFound(rw)
+		return
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	models.ResponseOK(rw)
+}
+
+// swagger:route DELETE /article/{id}/reactions/{kind} article deleteReaction
+//
+// # Удаление реакции на статью
+//
+// responses:
+//
+//	200: Response
+//	400: Response
+//	401: Response
+//	500: Response
+func DeleteReaction(rw http.ResponseWriter, r *http.Request) {
+	login, id, kind, ok := reactionParams(rw, r)
+	if !ok {
+		return
+	}
+	requestLogger(r).Debug("DeleteReaction started", "id", id, "kind", kind)
+
+	ch := make(chan error, 1)
+	dbwork.DB.DeleteReaction(r.Context(), id, login, kind, ch)
+	err := <-ch
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	models.ResponseOK(rw)
+}
+
+func reactionParams(rw http.ResponseWriter, r *http.Request) (string, int, string, bool) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return "", 0, "", false
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		models.ResponseNotFound(rw)
+		return "", 0, "", false
+	}
+
+	kind := vars["kind"]
+	if !slices.Contains(models.ReactionKinds, kind) {
+		models.ResponseNew(rw, "Неизвестный вид реакции", http.StatusBadRequest)
+		return "", 0, "", false
+	}
+	return login, id, kind, true
+}
+
+// swagger:parameters setReaction deleteReaction
+type ReactionParams struct {
+	// in: path
+	// required: true
+	ID int `json:"id"`
+
+	// Вид реакции: like, heart, laugh, wow, sad, rocket
+	// in: path
+	// required: true
+	Kind string `json:"kind"`
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"blog/pkg/markdown"
+	"blog/pkg/models"
+	"net/http"
+)
+
+// prepareArticles дополняет статьи перед отдачей клиенту:
+// HTML из Markdown и флаг закладки для авторизованного пользователя
+func prepareArticles(r *http.Request, articles []models.Article) error {
+	for i := range articles {
+		html, err := markdown.RenderRevision(articles[i].ID, articles[i].Revision, articles[i].Text)
+		if err != nil {
+			return err
+		}
+		articles[i].HTML = html
+	}
+	return markBookmarks(r, articles)
+}
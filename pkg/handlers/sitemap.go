@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/feed"
+	"blog/pkg/models"
+	"blog/pkg/sitemap"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const contentTypeXML = "application/xml; charset=utf-8"
+
+// Число статей в одной части карты сайта
+var sitemapPageSize = sitemap.MaxURLs
+
+// swagger:route GET /sitemap.xml feed getSitemap
+//
+// # Карта сайта
+//
+// Если статей больше, чем помещается в один файл, возвращается индекс
+// со ссылками на части /sitemap-{page}.xml.
+//
+// produces:
+// - application/xml
+//
+// responses:
+//
+//	500: Response
+func GetSitemap(rw http.ResponseWriter, r *http.Request) {
+	requestLogger(r).Debug("GetSitemap started")
+
+	pages, err := dbwork.DB.GetArticlePagesModified(r.Context(), sitemapPageSize)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	if len(pages) <= 1 {
+		writeSitemapPage(rw, r, 1)
+		return
+	}
+
+	sitemaps := make([]sitemap.Sitemap, 0, len(pages))
+	for i, modified := range pages {
+		sitemaps = append(sitemaps, sitemap.Sitemap{
+			Loc:     feed.URL("/sitemap-" + strconv.Itoa(i+1) + ".xml"),
+			LastMod: sitemap.LastMod(modified),
+		})
+	}
+
+	body, err := sitemap.Index(sitemaps)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	writeFeed(rw, r, body, contentTypeXML)
+}
+
+// swagger:route GET /sitemap-{page}.xml feed getSitemapPage
+//
+// # Часть карты сайта
+//
+// produces:
+// - application/xml
+//
+// responses:
+//
+//	404: Response
+//	500: Response
+func GetSitemapPage(rw http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(mux.Vars(r)["page"])
+	if err != nil || page < 1 {
+		models.ResponseNotFound(rw)
+		return
+	}
+	requestLogger(r).Debug("GetSitemapPage started", "page", page)
+
+	writeSitemapPage(rw, r, page)
+}
+
+func writeSitemapPage(rw http.ResponseWriter, r *http.Request, page int) {
+	articles, err := dbwork.DB.GetArticleTimestamps(r.Context(), sitemapPageSize, (page-1)*sitemapPageSize)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	// Первая часть существует всегда, даже если статей ещё нет
+	if len(articles) == 0 && page > 1 {
+		models.ResponseNotFound(rw)
+		return
+	}
+
+	urls := make([]sitemap.URL, 0, len(articles))
+	for _, article := range articles {
+		urls = append(urls, sitemap.URL{
+			Loc:     feed.ArticleURL(article.ID),
+			LastMod: sitemap.LastMod(article.UpdatedAt),
+		})
+	}
+
+	body, err := sitemap.URLSet(urls)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	writeFeed(rw, r, body, contentTypeXML)
+}
+
+// swagger:parameters getSitemapPage
+type SitemapPageParams struct {
+	// Номер части, начиная с 1
+	// in: path
+	// required: true
+	Page int `json:"page"`
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/feed"
+	"blog/pkg/models"
+	"blog/pkg/sitemap"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sitemapDB делит count статей на страницы так же, как запрос к БД
+type sitemapDB struct {
+	dbwork.DataBase
+	count int
+}
+
+func (db *sitemapDB) updatedAt(id int) time.Time {
+	return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(id) * time.Second)
+}
+
+func (db *sitemapDB) GetArticleTimestamps(ctx context.Context, limit, offset int) ([]models.Article, error) {
+	articles := make([]models.Article, 0)
+	for id := offset + 1; id <= min(offset+limit, db.count); id++ {
+		articles = append(articles, models.Article{ID: id, UpdatedAt: db.updatedAt(id)})
+	}
+	return articles, nil
+}
+
+func (db *sitemapDB) GetArticlePagesModified(ctx context.Context, pageSize int) ([]time.Time, error) {
+	pages := make([]time.Time, 0)
+	for last := pageSize; last-pageSize < db.count; last += pageSize {
+		pages = append(pages, db.updatedAt(min(last, db.count)))
+	}
+	return pages, nil
+}
+
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemap.URL     `xml:"url"`
+	Sitemaps []sitemap.Sitemap `xml:"sitemap"`
+}
+
+func getSitemap(t *testing.T, handler http.HandlerFunc, r *http.Request) (int, sitemapDocument) {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	handler(rw, r)
+	document := sitemapDocument{}
+	if rw.Code == http.StatusOK {
+		if err := xml.Unmarshal(rw.Body.Bytes(), &document); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rw.Code, document
+}
+
+func TestSitemapSplitsAboveMaxURLs(t *testing.T) {
+	feed.InitializationFeed(feed.Config{SiteURL: "https://blog.example"})
+	defer feed.InitializationFeed(feed.DefaultConfig())
+
+	for _, test := range []struct {
+		name  string
+		count int
+		urls  int
+		index []string
+	}{
+		{"no articles", 0, 0, nil},
+		{"exactly the limit", sitemap.MaxURLs, sitemap.MaxURLs, nil},
+		{"one over the limit", sitemap.MaxURLs + 1, 0, []string{"2024-01-01T13:53:20Z", "2024-01-01T13:53:21Z"}},
+	} {
+		dbwork.DB = &sitemapDB{count: test.count}
+		code, document := getSitemap(t, GetSitemap, httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil))
+		if code != http.StatusOK {
+			t.Fatalf("%s: status %d", test.name, code)
+		}
+
+		if test.index == nil {
+			if document.XMLName.Local != "urlset" || len(document.URLs) != test.urls {
+				t.Errorf("%s: %s with %d urls, want urlset with %d", test.name, document.XMLName.Local, len(document.URLs), test.urls)
+			}
+			continue
+		}
+		if document.XMLName.Local != "sitemapindex" || len(document.Sitemaps) != len(test.index) {
+			t.Errorf("%s: %s with %d sitemaps, want an index of %d", test.name, document.XMLName.Local, len(document.Sitemaps), len(test.index))
+			continue
+		}
+		for i, part := range document.Sitemaps {
+			loc := "https://blog.example/sitemap-" + strconv.Itoa(i+1) + ".xml"
+			if part.Loc != loc || part.LastMod != test.index[i] {
+				t.Errorf("%s: part %d = %+v, want %s at %s", test.name, i+1, part, loc, test.index[i])
+			}
+		}
+	}
+}
+
+func TestSitemapPages(t *testing.T) {
+	dbwork.DB = &sitemapDB{count: sitemap.MaxURLs + 1}
+
+	for _, test := range []struct {
+		page    string
+		code    int
+		urls    int
+		firstID int
+	}{
+		{"1", http.StatusOK, sitemap.MaxURLs, 1},
+		{"2", http.StatusOK, 1, sitemap.MaxURLs + 1},
+		{"3", http.StatusNotFound, 0, 0},
+		{"0", http.StatusNotFound, 0, 0},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/sitemap-"+test.page+".xml", nil)
+		r = mux.SetURLVars(r, map[string]string{"page": test.page})
+		code, document := getSitemap(t, GetSitemapPage, r)
+		if code != test.code || len(document.URLs) != test.urls {
+			t.Errorf("page %s: status %d with %d urls, want %d with %d", test.page, code, len(document.URLs), test.code, test.urls)
+			continue
+		}
+		if test.urls > 0 && document.URLs[0].Loc != feed.ArticleURL(test.firstID) {
+			t.Errorf("page %s starts with %s", test.page, document.URLs[0].Loc)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"blog/pkg/auth"
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const maxTokenNameLength = 64
+
+// swagger:route POST /user/me/tokens user createAPIToken
+//
+// # Создание персонального токена
+//
+// Значение токена возвращается только в этом ответе.
+//
+// responses:
+//
+//	201: apiTokenResponse
+//	400: Response
+//	401: Response
+//	403: Response
+//	500: Response
+func CreateAPIToken(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	request := models.APITokenRequest{}
+	if err := json.Unmarshal(data, &request); err != nil {
+		models.ResponseBadRequest(rw)
+		return
+	}
+	requestLogger(r).Debug("CreateAPIToken started", "login", login)
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > maxTokenNameLength {
+		models.ResponseNew(rw, "Название токена должно быть от 1 до 64 символов", http.StatusBadRequest)
+		return
+	}
+	if len(request.Scopes) == 0 {
+		models.ResponseNew(rw, "Укажите хотя бы одно разрешение", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !auth.ValidScope(scope) {
+			models.ResponseNew(rw, "Неизвестное разрешение: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+	if request.ExpiresInDays < 0 {
+		models.ResponseBadRequest(rw)
+		return
+	}
+
+	tokenString, tokenHash, err := auth.GenerateAPIToken()
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	token := models.APIToken{
+		Name:      request.Name,
+		Scopes:    request.Scopes,
+		CreatedAt: time.Now(),
+	}
+	if request.ExpiresInDays > 0 {
+		expires := token.CreatedAt.AddDate(0, 0, request.ExpiresInDays)
+		token.ExpiresAt = &expires
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.CreateAPIToken(r.Context(), login, &token, tokenHash, ch)
+	err = <-ch
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	token.Token = tokenString
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(token)
+}
+
+// swagger:response apiTokenResponse
+type APITokenResponse struct {
+	// in:body
+	Body models.APIToken
+}
+
+// swagger:route GET /user/me/tokens user getAPITokens
+//
+// # Список персональных токенов
+//
+// responses:
+//
+//	200: apiTokensResponse
+//	401: Response
+//	403: Response
+//	500: Response
+func GetAPITokens(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+	requestLogger(r).Debug("GetAPITokens started", "login", login)
+
+	tokens, err := dbwork.DB.GetAPITokens(r.Context(), login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	err = json.NewEncoder(rw).Encode(tokens)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+}
+
+// swagger:response apiTokensResponse
+type APITokensResponse struct {
+	// in:body
+	Body []models.APIToken
+}
+
+// swagger:route DELETE /user/me/tokens/{id} user deleteAPIToken
+//
+// # Отзыв персонального токена
+//
+// responses:
+//
+//	200: Response
+//	401: Response
+//	403: Response
+//	404: Response
+//	500: Response
+func DeleteAPIToken(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		models.ResponseNotFound(rw)
+		return
+	}
+	requestLogger(r).Debug("DeleteAPIToken started", "id", id)
+
+	ch := make(chan error, 1)
+	dbwork.DB.DeleteAPIToken(r.Context(), login, id, ch)
+	err = <-ch
+	if err == dbwork.ErrNotFound {
+		models.ResponseNotFound(rw)
+		return
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	models.ResponseOK(rw)
+}
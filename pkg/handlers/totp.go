@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"blog/pkg/auth"
+	"blog/pkg/dbwork"
+	"blog/pkg/metrics"
+	"blog/pkg/models"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// swagger:route POST /user/me/2fa/setup user setupTOTP
+//
+// # Начало подключения двухфакторной аутентификации
+//
+// Генерирует новый секрет. Двухфакторная аутентификация включается
+// только после подтверждения кодом.
+//
+// responses:
+//
+//	200: totpSetupResponse
+//	401: Response
+//	409: Response
+//	500: Response
+func SetupTOTP(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+	requestLogger(r).Debug("SetupTOTP started", "login", login)
+
+	state, err := dbwork.DB.GetTOTP(r.Context(), login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	if state.Enabled {
+		models.ResponseNew(rw, "Двухфакторная аутентификация уже включена", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.SetTOTPSecret(r.Context(), login, secret, ch)
+	err = <-ch
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	json.NewEncoder(rw).Encode(models.TOTPSetup{
+		Secret: secret,
+		URI:    auth.TOTPURI(login, secret),
+	})
+}
+
+// swagger:response totpSetupResponse
+type TOTPSetupResponse struct {
+	// in:body
+	Body models.TOTPSetup
+}
+
+// swagger:route POST /user/me/2fa/confirm user confirmTOTP
+//
+// # Подтверждение подключения двухфакторной аутентификации
+//
+// Включает двухфакторную аутентификацию и возвращает коды восстановления.
+//
+// responses:
+//
+//	200: recoveryCodesResponse
+//	400: Response
+//	401: Response
+//	409: Response
+//	500: Response
+func ConfirmTOTP(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	code, ok := readTOTPCode(rw, r)
+	if !ok {
+		return
+	}
+	requestLogger(r).Debug("ConfirmTOTP started", "login", login)
+
+	state, err := dbwork.DB.GetTOTP(r.Context(), login)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	if state.Enabled {
+		models.ResponseNew(rw, "Двухфакторная аутентификация уже включена", http.StatusConflict)
+		return
+	}
+	if state.Secret == "" {
+		models.ResponseNew(rw, "Сначала получите секрет", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(state.Secret, code, state.LastStep)
+	if !ok {
+		models.ResponseNew(rw, "Неверный код", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashRecoveryCode(code))
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.EnableTOTP(r.Context(), login, hashes, ch)
+	err = <-ch
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	ch = make(chan error, 1)
+	dbwork.DB.UseTOTPStep(r.Context(), login, step, ch)
+	<-ch
+
+	json.NewEncoder(rw).Encode(models.RecoveryCodes{Codes: codes})
+}
+
+// swagger:response recoveryCodesResponse
+type RecoveryCodesResponse struct {
+	// in:body
+	Body models.RecoveryCodes
+}
+
+// swagger:route POST /user/me/2fa/disable user disableTOTP
+//
+// # Отключение двухфакторной аутентификации
+//
+// Требует действующий код из приложения или код восстановления.
+//
+// responses:
+//
+//	200: Response
+//	400: Response
+//	401: Response
+//	500: Response
+func DisableTOTP(rw http.ResponseWriter, r *http.Request) {
+	login, ok := r.Context().Value("login").(string)
+	if !ok {
+		models.ResponseUnauthorized(rw)
+		return
+	}
+
+	code, ok := readTOTPCode(rw, r)
+	if !ok {
+		return
+	}
+	requestLogger(r).Debug("DisableTOTP started", "login", login)
+
+	verified, err := verifySecondFactor(r.Context(), login, code)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	if !verified {
+		models.ResponseNew(rw, "Неверный код", http.StatusBadRequest)
+		return
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.DisableTOTP(r.Context(), login, ch)
+	err = <-ch
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	models.ResponseOK(rw)
+}
+
+// swagger:route POST /login/2fa user loginTwoFactor
+//
+// # Второй шаг аутентификации
+//
+// Обменивает токен первого шага и код на JWT.
+//
+// responses:
+//
+//	200: jwtToken
+//	400: Response
+//	401: Response
+//	500: Response
+func LoginTwoFactor(rw http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+
+	request := models.TwoFactorLogin{}
+	if err := json.Unmarshal(data, &request); err != nil {
+		models.ResponseBadRequest(rw)
+		return
+	}
+
+	claims, err := auth.ParseChallengeJWT(request.Challenge)
+	if err != nil {
+		metrics.LoginAttempt(metrics.LoginTwoFactor, false)
+		models.ResponseNew(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	requestLogger(r).Info("Two-factor login attempt", "login", claims.Login)
+
+	verified, err := auth.VerifyChallenge(claims, func() (bool, error) {
+		return verifySecondFactor(r.Context(), claims.Login, request.Code)
+	})
+	if err == auth.ErrChallengeExhausted || err == auth.ErrAccountLocked {
+		metrics.LoginAttempt(metrics.LoginTwoFactor, false)
+		models.ResponseNew(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return
+	}
+	if !verified {
+		metrics.LoginAttempt(metrics.LoginTwoFactor, false)
+		models.ResponseNew(rw, "Неверный код", http.StatusUnauthorized)
+		return
+	}
+
+	metrics.LoginAttempt(metrics.LoginTwoFactor, true)
+	issueSession(rw, claims.Login)
+}
+
+func readTOTPCode(rw http.ResponseWriter, r *http.Request) (string, bool) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.ResponseErrorServer(rw)
+		return "", false
+	}
+
+	request := models.TOTPCode{}
+	if err := json.Unmarshal(data, &request); err != nil || request.Code == "" {
+		models.ResponseBadRequest(rw)
+		return "", false
+	}
+	return strings.TrimSpace(request.Code), true
+}
+
+// verifySecondFactor принимает код TOTP либо неиспользованный код восстановления
+func verifySecondFactor(ctx context.Context, login, code string) (bool, error) {
+	state, err := dbwork.DB.GetTOTP(ctx, login)
+	if err != nil {
+		return false, err
+	}
+	if !state.Enabled {
+		return false, nil
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := auth.ValidateTOTP(state.Secret, code, state.LastStep); ok {
+		ch := make(chan error, 1)
+		dbwork.DB.UseTOTPStep(ctx, login, step, ch)
+		err = <-ch
+		if err == dbwork.ErrTOTPReplay {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	ch := make(chan error, 1)
+	dbwork.DB.UseRecoveryCode(ctx, login, auth.HashRecoveryCode(code), ch)
+	err = <-ch
+	if err == dbwork.ErrRecoveryNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
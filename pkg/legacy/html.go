@@ -0,0 +1,222 @@
+package legacy
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+	extraNewlines  = regexp.MustCompile(`\n{3,}`)
+	spaces         = regexp.MustCompile(`[ \t\r\f]+`)
+	// Символы, которые в тексте могли бы стать разметкой
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`,
+	)
+	blockStart   = regexp.MustCompile(`^(#|>|[-+] )`)
+	orderedStart = regexp.MustCompile(`^\d+[.)] `)
+)
+
+// htmlToMarkdown переводит HTML записи WordPress в Markdown: рендерер
+// статей не пропускает сырой HTML. Пустая строка в тексте, как и в
+// WordPress, разделяет абзацы, а одиночный перевод строки — строки абзаца
+func htmlToMarkdown(source string) (string, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(source), body)
+	if err != nil {
+		return "", err
+	}
+
+	converter := &converter{}
+	for _, node := range nodes {
+		converter.node(node)
+	}
+	return converter.String(), nil
+}
+
+type converter struct {
+	out strings.Builder
+}
+
+// String возвращает результат без лишних пустых строк и пробелов в конце строк
+func (c *converter) String() string {
+	lines := strings.Split(c.out.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(extraNewlines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+func (c *converter) children(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		c.node(child)
+	}
+}
+
+// nested преобразует потомков отдельно, чтобы затем сдвинуть их строки
+func (c *converter) nested(node *html.Node) string {
+	inner := &converter{}
+	inner.children(node)
+	return inner.String()
+}
+
+func (c *converter) block(content string) {
+	c.out.WriteString("\n\n" + content + "\n\n")
+}
+
+func (c *converter) node(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		c.text(node.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch node.DataAtom {
+	case atom.Script, atom.Style, atom.Iframe, atom.Object:
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(node.Data[1] - '0')
+		title := strings.Join(strings.Fields(c.nested(node)), " ")
+		c.block(strings.Repeat("#", level) + " " + title)
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Figure, atom.Figcaption, atom.Table, atom.Tr:
+		c.block(c.nested(node))
+	case atom.Br:
+		c.out.WriteString("\\\n")
+	case atom.Hr:
+		c.block("---")
+	case atom.Strong, atom.B:
+		c.wrap(node, "**")
+	case atom.Em, atom.I:
+		c.wrap(node, "_")
+	case atom.Del, atom.S:
+		c.wrap(node, "~~")
+	case atom.Code:
+		c.out.WriteString("`" + textContent(node) + "`")
+	case atom.Pre:
+		c.block("```\n" + strings.Trim(textContent(node), "\n") + "\n```")
+	case atom.A:
+		href := attr(node, "href")
+		content := c.nested(node)
+		if href == "" || content == "" {
+			c.out.WriteString(content)
+			return
+		}
+		c.out.WriteString("[" + content + "](" + escapeURL(href) + ")")
+	case atom.Img:
+		if src := attr(node, "src"); src != "" {
+			c.out.WriteString("![" + markdownEscaper.Replace(attr(node, "alt")) + "](" + escapeURL(src) + ")")
+		}
+	case atom.Blockquote:
+		lines := strings.Split(c.nested(node), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		c.block(strings.Join(lines, "\n"))
+	case atom.Ul, atom.Ol:
+		c.list(node)
+	default:
+		c.children(node)
+	}
+}
+
+func (c *converter) wrap(node *html.Node, marker string) {
+	content := c.nested(node)
+	if content == "" {
+		return
+	}
+	c.out.WriteString(marker + content + marker)
+}
+
+// list выводит элементы списка, сдвигая вложенные строки на ширину маркера
+func (c *converter) list(node *html.Node) {
+	items := make([]string, 0)
+	number := 1
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if node.DataAtom == atom.Ol {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		lines := strings.Split(c.nested(child), "\n")
+		for i := range lines {
+			if i > 0 && lines[i] != "" {
+				lines[i] = strings.Repeat(" ", len(marker)) + lines[i]
+			}
+		}
+		items = append(items, marker+strings.Join(lines, "\n"))
+	}
+	c.block(strings.Join(items, "\n"))
+}
+
+func (c *converter) text(value string) {
+	for i, paragraph := range paragraphBreak.Split(value, -1) {
+		if i > 0 {
+			c.out.WriteString("\n\n")
+		}
+		previous := ""
+		for j, line := range strings.Split(paragraph, "\n") {
+			line = spaces.ReplaceAllString(line, " ")
+			if j > 0 {
+				// Перенос между двумя строками текста становится жёстким переносом,
+				// а перенос рядом с тегом — пробелом
+				if strings.TrimSpace(line) == "" || strings.TrimSpace(previous) == "" {
+					c.out.WriteString(" ")
+				} else {
+					c.out.WriteString("\\\n")
+				}
+				line = strings.TrimLeft(line, " ")
+			}
+			c.out.WriteString(escapeText(line))
+			previous = line
+		}
+	}
+}
+
+// escapeText экранирует разметку, в том числе в начале строки,
+// где текст мог бы стать заголовком, цитатой или списком
+func escapeText(line string) string {
+	line = markdownEscaper.Replace(line)
+	trimmed := strings.TrimLeft(line, " ")
+	indent := line[:len(line)-len(trimmed)]
+	if blockStart.MatchString(trimmed) {
+		return indent + `\` + trimmed
+	}
+	if orderedStart.MatchString(trimmed) {
+		digits := strings.IndexAny(trimmed, ".)")
+		return indent + trimmed[:digits] + `\` + trimmed[digits:]
+	}
+	return line
+}
+
+func escapeURL(url string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(url)
+}
+
+func attr(node *html.Node, name string) string {
+	for _, attribute := range node.Attr {
+		if attribute.Key == name {
+			return strings.TrimSpace(attribute.Val)
+		}
+	}
+	return ""
+}
+
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	var text strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(textContent(child))
+	}
+	return text.String()
+}
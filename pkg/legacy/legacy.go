@@ -0,0 +1,207 @@
+package legacy
+
+import (
+	"blog/pkg/backup"
+	"blog/pkg/dbwork"
+	"blog/pkg/models"
+	"blog/pkg/password"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Пространство имён UUID v5 для статей из внешних источников: повторный
+// импорт той же записи получает тот же uid и обновляет статью
+var namespace = uuid.MustParse("6f1c2a9e-8d54-4b0f-9a37-2e5d7c1b4f80")
+
+var ErrUnknownAuthors = errors.New("Не найдены пользователи для авторов")
+
+// Запись из внешнего источника
+type Post struct {
+	// Путь к файлу или идентификатор записи WordPress, для отчёта
+	Source string
+	// Постоянный ключ записи в источнике, из него строится uid статьи
+	Key string
+	// uid, указанный в самом источнике. Если пуст, строится из Key
+	UID string
+	// Автор в терминах источника
+	Author    string
+	Title     string
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Запись источника, которая не будет импортирована
+type Skipped struct {
+	Source string
+	Reason string
+}
+
+// Прочитанный источник
+type Source struct {
+	Posts   []Post
+	Skipped []Skipped
+}
+
+// Параметры импорта
+type Options struct {
+	// Соответствие авторов источника логинам блога
+	Authors map[string]string
+	// Логин для записей, автор которых не найден
+	DefaultAuthor string
+	// Создавать пользователей для ненайденных авторов. Пароль им
+	// не задаётся, войти можно после blog admin user reset-password
+	CreateUsers bool
+	// Только построить отчёт, ничего не записывая
+	DryRun bool
+}
+
+// Статья, которая будет создана или обновлена
+type PlannedArticle struct {
+	Source    string
+	UID       string
+	Author    string
+	Title     string
+	CreatedAt time.Time
+}
+
+// Отчёт об импорте
+type Report struct {
+	Articles []PlannedArticle
+	// Пользователи, которые будут созданы
+	NewUsers []string
+	// Авторы источника, для которых не нашлось пользователя
+	MissingAuthors []string
+	Skipped        []Skipped
+	// Число применённых записей каждого типа, пусто при DryRun
+	Applied map[string]int
+}
+
+// Import сопоставляет авторов с пользователями и создаёт статьи через
+// backup.Importer. Пока есть ненайденные авторы, в БД ничего не пишется
+func Import(ctx context.Context, source Source, options Options) (Report, error) {
+	report := Report{Skipped: source.Skipped}
+
+	authors, err := resolveAuthors(ctx, source.Posts, options, &report)
+	if err != nil {
+		return report, err
+	}
+
+	records := make([]models.BackupRecord, 0, len(report.NewUsers)+len(source.Posts))
+	for _, login := range report.NewUsers {
+		records = append(records, models.BackupRecord{
+			Type: models.BackupUser,
+			User: &models.BackupUserData{Login: login, Role: models.RoleUser},
+		})
+	}
+	for _, post := range source.Posts {
+		author, ok := authors[post.Author]
+		if !ok {
+			continue
+		}
+		uid := post.UID
+		if uid == "" {
+			uid = uuid.NewSHA1(namespace, []byte(post.Key)).String()
+		}
+
+		// Заголовок добавляется, если текст не начинается с него сам
+		text := strings.TrimSpace(post.Body)
+		if heading := "# " + escapeText(post.Title); post.Title != "" && !strings.HasPrefix(text, heading) {
+			text = heading + "\n\n" + text
+		}
+		// Ревизию назначает БД: повторный импорт изменённого текста
+		// увеличивает её, а неизменный текст её не трогает
+		records = append(records, models.BackupRecord{
+			Type: models.BackupArticle,
+			Article: &models.BackupArticleData{
+				// Идентификатор нужен только для сопоставления внутри импорта
+				ID:        len(report.Articles) + 1,
+				UID:       uid,
+				Author:    author,
+				Text:      text,
+				CreatedAt: post.CreatedAt,
+				UpdatedAt: post.UpdatedAt,
+			},
+		})
+		report.Articles = append(report.Articles, PlannedArticle{
+			Source:    post.Source,
+			UID:       uid,
+			Author:    author,
+			Title:     post.Title,
+			CreatedAt: post.CreatedAt,
+		})
+	}
+
+	if len(report.MissingAuthors) > 0 {
+		return report, fmt.Errorf("%w: %s", ErrUnknownAuthors, strings.Join(report.MissingAuthors, ", "))
+	}
+	if options.DryRun {
+		return report, nil
+	}
+
+	importer := backup.NewImporter(ctx)
+	for _, record := range records {
+		if err := importer.Add(record); err != nil {
+			report.Applied = importer.Applied()
+			return report, err
+		}
+	}
+	err = importer.Flush()
+	report.Applied = importer.Applied()
+	return report, err
+}
+
+// resolveAuthors возвращает логин блога для каждого автора источника.
+// Порядок: явное соответствие или тот же логин, затем новый пользователь
+// (с CreateUsers), затем автор по умолчанию
+func resolveAuthors(ctx context.Context, posts []Post, options Options, report *Report) (map[string]string, error) {
+	if options.DefaultAuthor != "" {
+		if _, err := dbwork.DB.GetAccount(ctx, options.DefaultAuthor); err != nil {
+			if err == dbwork.ErrNotFound {
+				return nil, fmt.Errorf("Пользователь %s не найден", options.DefaultAuthor)
+			}
+			return nil, err
+		}
+	}
+
+	authors := make(map[string]string)
+	for _, post := range posts {
+		if _, ok := authors[post.Author]; ok || slices.Contains(report.MissingAuthors, post.Author) {
+			continue
+		}
+
+		login := post.Author
+		if mapped, ok := options.Authors[post.Author]; ok {
+			login = mapped
+		}
+		if login != "" {
+			_, err := dbwork.DB.GetAccount(ctx, login)
+			if err == nil {
+				authors[post.Author] = login
+				continue
+			}
+			if err != dbwork.ErrNotFound {
+				return nil, err
+			}
+			if options.CreateUsers && password.ValidateLogin(login) == nil {
+				authors[post.Author] = login
+				if !slices.Contains(report.NewUsers, login) {
+					report.NewUsers = append(report.NewUsers, login)
+				}
+				continue
+			}
+		}
+		if options.DefaultAuthor != "" {
+			authors[post.Author] = options.DefaultAuthor
+			continue
+		}
+		report.MissingAuthors = append(report.MissingAuthors, post.Author)
+	}
+	return authors, nil
+}
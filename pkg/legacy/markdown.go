@@ -0,0 +1,144 @@
+package legacy
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Поля front-matter, общие для Hugo и Jekyll
+type frontMatter struct {
+	Title   string          `yaml:"title"`
+	Author  string          `yaml:"author"`
+	Date    frontMatterTime `yaml:"date"`
+	Updated frontMatterTime `yaml:"updated"`
+	Lastmod frontMatterTime `yaml:"lastmod"`
+	Draft   bool            `yaml:"draft"`
+	// Постоянный идентификатор записи, если он уже есть
+	UID  string `yaml:"uid"`
+	Slug string `yaml:"slug"`
+}
+
+// Форматы дат, которые встречаются в front-matter
+var frontMatterLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+}
+
+// Дата front-matter. Даты без пояса считаются UTC
+type frontMatterTime struct {
+	time.Time
+}
+
+func (value *frontMatterTime) UnmarshalYAML(node *yaml.Node) error {
+	text := strings.TrimSpace(node.Value)
+	if text == "" {
+		return nil
+	}
+	for _, layout := range frontMatterLayouts {
+		if date, err := time.Parse(layout, text); err == nil {
+			value.Time = date.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("неизвестный формат даты %q", text)
+}
+
+// ReadMarkdown читает файлы .md и .markdown из fsys вместе с вложенными
+// каталогами. Черновики (draft: true) попадают в Skipped
+func ReadMarkdown(fsys fs.FS) (Source, error) {
+	source := Source{Posts: make([]Post, 0), Skipped: make([]Skipped, 0)}
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		extension := strings.ToLower(path.Ext(name))
+		if entry.IsDir() || (extension != ".md" && extension != ".markdown") {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		post, reason, err := markdownPost(name, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if reason != "" {
+			source.Skipped = append(source.Skipped, Skipped{Source: name, Reason: reason})
+			return nil
+		}
+		source.Posts = append(source.Posts, post)
+		return nil
+	})
+	return source, err
+}
+
+func markdownPost(name string, data []byte) (Post, string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	var meta frontMatter
+	if rest, found := strings.CutPrefix(text, "---\n"); found {
+		header, body, found := strings.Cut(rest, "\n---\n")
+		if !found {
+			header, found = strings.CutSuffix(rest, "\n---")
+			body = ""
+		}
+		if !found {
+			return Post{}, "", fmt.Errorf("front-matter не закрыт строкой ---")
+		}
+		if err := yaml.Unmarshal([]byte(header), &meta); err != nil {
+			return Post{}, "", err
+		}
+		text = body
+	}
+
+	if meta.Draft {
+		return Post{}, "черновик", nil
+	}
+	if strings.TrimSpace(text) == "" && meta.Title == "" {
+		return Post{}, "пустая запись", nil
+	}
+
+	post := Post{
+		Source:    name,
+		Author:    strings.TrimSpace(meta.Author),
+		Title:     strings.TrimSpace(meta.Title),
+		Body:      text,
+		CreatedAt: meta.Date.Time,
+		UpdatedAt: meta.Updated.Time,
+	}
+	if post.UpdatedAt.IsZero() {
+		post.UpdatedAt = meta.Lastmod.Time
+	}
+	if post.UpdatedAt.Before(post.CreatedAt) {
+		post.UpdatedAt = post.CreatedAt
+	}
+
+	// Без uid ключом служит slug или путь без расширения, поэтому
+	// переименование файла создаст новую статью
+	if meta.UID != "" {
+		id, err := uuid.Parse(meta.UID)
+		if err != nil {
+			return Post{}, "", fmt.Errorf("недопустимый uid %q", meta.UID)
+		}
+		post.UID = id.String()
+	}
+	post.Key = "markdown:" + strings.TrimSuffix(name, path.Ext(name))
+	if meta.Slug != "" {
+		post.Key = "markdown:" + meta.Slug
+	}
+	return post, "", nil
+}
@@ -0,0 +1,115 @@
+package legacy
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMarkdownPost(t *testing.T) {
+	date := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		name   string
+		file   string
+		data   string
+		post   Post
+		reason string
+		fails  bool
+	}{
+		{
+			name: "hugo front-matter",
+			file: "posts/hello.md",
+			data: "---\ntitle: Hello\nauthor: alice\ndate: 2024-03-01T12:30:00+03:00\nlastmod: 2024-04-01\n---\nBody\n",
+			post: Post{Source: "posts/hello.md", Key: "markdown:posts/hello", Author: "alice", Title: "Hello", Body: "Body\n",
+				CreatedAt: date, UpdatedAt: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "jekyll date and slug",
+			file: "_posts/2024-03-01-hello.markdown",
+			data: "---\ntitle: Hello\ndate: 2024-03-01 12:30:00 +0300\nslug: hello-world\n---\nBody",
+			post: Post{Source: "_posts/2024-03-01-hello.markdown", Key: "markdown:hello-world", Title: "Hello", Body: "Body",
+				CreatedAt: date, UpdatedAt: date},
+		},
+		{
+			name: "uid, bom and crlf",
+			file: "a.md",
+			data: "\xef\xbb\xbf---\r\nuid: 6F1C2A9E-8D54-4B0F-9A37-2E5D7C1B4F80\r\ndate: 2024-03-01 09:30\r\n---\r\nText\r\n",
+			post: Post{Source: "a.md", Key: "markdown:a", UID: "6f1c2a9e-8d54-4b0f-9a37-2e5d7c1b4f80", Body: "Text\n",
+				CreatedAt: date, UpdatedAt: date},
+		},
+		{
+			name: "updated earlier than date",
+			file: "b.md",
+			data: "---\ndate: 2024-03-01T09:30:00Z\nupdated: 2020-01-01\n---\nText",
+			post: Post{Source: "b.md", Key: "markdown:b", Body: "Text", CreatedAt: date, UpdatedAt: date},
+		},
+		{
+			name: "without front-matter",
+			file: "plain.md",
+			data: "# Title\n\ntext",
+			post: Post{Source: "plain.md", Key: "markdown:plain", Body: "# Title\n\ntext"},
+		},
+		{
+			name: "front-matter only",
+			file: "c.md",
+			data: "---\ntitle: Only title\n---",
+			post: Post{Source: "c.md", Key: "markdown:c", Title: "Only title"},
+		},
+		{name: "draft", file: "d.md", data: "---\ndraft: true\n---\ntext", reason: "черновик"},
+		{name: "empty", file: "e.md", data: "---\nauthor: alice\n---\n  \n", reason: "пустая запись"},
+		{name: "unclosed front-matter", file: "f.md", data: "---\ntitle: x\ntext", fails: true},
+		{name: "unknown date format", file: "g.md", data: "---\ndate: 1 March 2024\n---\ntext", fails: true},
+		{name: "invalid uid", file: "h.md", data: "---\nuid: not-a-uuid\n---\ntext", fails: true},
+	} {
+		post, reason, err := markdownPost(test.file, []byte(test.data))
+		if (err != nil) != test.fails {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if test.fails {
+			continue
+		}
+		if reason != test.reason || post != test.post {
+			t.Errorf("%s: markdownPost = %+v, %q\nwant %+v, %q", test.name, post, reason, test.post, test.reason)
+		}
+	}
+}
+
+func TestReadMarkdown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.md":             {Data: []byte("# Index")},
+		"posts/one.md":         {Data: []byte("---\ntitle: One\n---\nfirst")},
+		"posts/draft.md":       {Data: []byte("---\ndraft: true\n---\nwip")},
+		"posts/nested/two.MD":  {Data: []byte("second")},
+		"posts/image.png":      {Data: []byte("png")},
+		"posts/notes.markdown": {Data: []byte("third")},
+	}
+	source, err := ReadMarkdown(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]string, 0, len(source.Posts))
+	for _, post := range source.Posts {
+		keys = append(keys, post.Key)
+	}
+	want := []string{"markdown:index", "markdown:posts/nested/two", "markdown:posts/notes", "markdown:posts/one"}
+	if len(keys) != len(want) {
+		t.Fatalf("keys %q, want %q", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("keys %q, want %q", keys, want)
+			break
+		}
+	}
+	if len(source.Skipped) != 1 || source.Skipped[0].Source != "posts/draft.md" {
+		t.Errorf("skipped %+v", source.Skipped)
+	}
+
+	fsys["posts/broken.md"] = &fstest.MapFile{Data: []byte("---\ntitle: broken")}
+	if _, err := ReadMarkdown(fsys); err == nil {
+		t.Error("broken front-matter accepted")
+	}
+}
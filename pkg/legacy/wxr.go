@@ -0,0 +1,127 @@
+package legacy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Запись WordPress в формате WXR. Элементы wp: сопоставляются без
+// пространства имён, потому что его адрес зависит от версии WXR
+type wxrItem struct {
+	Title        string `xml:"title"`
+	Link         string `xml:"link"`
+	GUID         string `xml:"guid"`
+	PubDate      string `xml:"pubDate"`
+	Creator      string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Content      string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PostID       string `xml:"post_id"`
+	PostDate     string `xml:"post_date"`
+	PostDateGMT  string `xml:"post_date_gmt"`
+	ModifiedGMT  string `xml:"post_modified_gmt"`
+	Status       string `xml:"status"`
+	PostType     string `xml:"post_type"`
+	PostPassword string `xml:"post_password"`
+}
+
+// Формат дат WordPress. Неопубликованные записи содержат нулевую дату
+const wxrDateLayout = "2006-01-02 15:04:05"
+
+// ReadWXR читает записи из выгрузки WordPress. Импортируются только
+// опубликованные записи типа post, остальные попадают в Skipped
+func ReadWXR(r io.Reader) (Source, error) {
+	source := Source{Posts: make([]Post, 0), Skipped: make([]Skipped, 0)}
+	decoder := xml.NewDecoder(r)
+	// Выгрузки WordPress иногда содержат управляющие символы и сущности HTML
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return source, fmt.Errorf("Не удалось разобрать WXR: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "item" {
+			continue
+		}
+
+		var item wxrItem
+		if err := decoder.DecodeElement(&item, &start); err != nil {
+			return source, fmt.Errorf("Не удалось разобрать WXR: %w", err)
+		}
+		post, reason, err := wxrPost(item)
+		if err != nil {
+			return source, err
+		}
+		if reason != "" {
+			source.Skipped = append(source.Skipped, Skipped{Source: post.Source, Reason: reason})
+			continue
+		}
+		source.Posts = append(source.Posts, post)
+	}
+	return source, nil
+}
+
+// wxrPost возвращает причину пропуска, если запись не импортируется
+func wxrPost(item wxrItem) (Post, string, error) {
+	post := Post{
+		Source: "wordpress:" + strings.TrimSpace(item.PostID),
+		Author: strings.TrimSpace(item.Creator),
+		Title:  strings.Join(strings.Fields(item.Title), " "),
+	}
+	if title := post.Title; title != "" {
+		post.Source += " " + title
+	}
+
+	switch {
+	case item.PostType != "post":
+		return post, "тип " + item.PostType, nil
+	case item.Status != "publish":
+		return post, "статус " + item.Status, nil
+	case item.PostPassword != "":
+		return post, "защищена паролем", nil
+	}
+
+	// guid не меняется при смене адреса записи, post_id — при смене домена
+	post.Key = strings.TrimSpace(item.GUID)
+	if post.Key == "" {
+		post.Key = "wordpress:" + strings.TrimSpace(item.PostID) + ":" + strings.TrimSpace(item.Link)
+	}
+
+	body, err := htmlToMarkdown(item.Content)
+	if err != nil {
+		return post, "", fmt.Errorf("%s: %w", post.Source, err)
+	}
+	if body == "" && post.Title == "" {
+		return post, "пустая запись", nil
+	}
+	post.Body = body
+
+	post.CreatedAt = wxrDate(item.PostDateGMT, item.PostDate, item.PubDate)
+	post.UpdatedAt = wxrDate(item.ModifiedGMT)
+	if post.UpdatedAt.Before(post.CreatedAt) {
+		post.UpdatedAt = post.CreatedAt
+	}
+	return post, "", nil
+}
+
+// wxrDate возвращает первую разобранную дату. Даты без пояса
+// считаются UTC; pubDate записан в формате RFC 1123
+func wxrDate(values ...string) time.Time {
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if date, err := time.Parse(wxrDateLayout, value); err == nil && date.Year() > 1 {
+			return date
+		}
+		if date, err := time.Parse(time.RFC1123Z, value); err == nil {
+			return date.UTC()
+		}
+	}
+	return time.Time{}
+}
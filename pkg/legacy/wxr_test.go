@@ -0,0 +1,124 @@
+package legacy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const wxrHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+`
+
+func wxrItemXML(id, postType, status, password, title, content string) string {
+	return `<item>
+	<title>` + title + `</title>
+	<link>https://old.example/?p=` + id + `</link>
+	<guid isPermaLink="false">https://old.example/?p=` + id + `</guid>
+	<pubDate>Mon, 01 Jan 2024 10:00:00 +0300</pubDate>
+	<dc:creator><![CDATA[admin]]></dc:creator>
+	<content:encoded><![CDATA[` + content + `]]></content:encoded>
+	<wp:post_id>` + id + `</wp:post_id>
+	<wp:post_date>2024-01-01 10:00:00</wp:post_date>
+	<wp:post_date_gmt>2024-01-01 07:00:00</wp:post_date_gmt>
+	<wp:post_modified_gmt>2024-02-01 07:00:00</wp:post_modified_gmt>
+	<wp:status>` + status + `</wp:status>
+	<wp:post_type>` + postType + `</wp:post_type>
+	<wp:post_password>` + password + `</wp:post_password>
+</item>
+`
+}
+
+func TestReadWXR(t *testing.T) {
+	document := wxrHeader +
+		wxrItemXML("1", "post", "publish", "", "Hello &amp; welcome", "<p>Hello <strong>world</strong></p>") +
+		wxrItemXML("2", "page", "publish", "", "About", "<p>page</p>") +
+		wxrItemXML("3", "post", "draft", "", "Draft", "<p>draft</p>") +
+		wxrItemXML("4", "post", "publish", "secret", "Private", "<p>hidden</p>") +
+		wxrItemXML("5", "post", "publish", "", "", "") +
+		wxrItemXML("6", "attachment", "inherit", "", "image.png", "") +
+		"</channel></rss>"
+
+	source, err := ReadWXR(strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(source.Posts) != 1 {
+		t.Fatalf("%d posts, want 1: %+v", len(source.Posts), source.Posts)
+	}
+
+	post := source.Posts[0]
+	want := Post{
+		Source:    "wordpress:1 Hello & welcome",
+		Key:       "https://old.example/?p=1",
+		Author:    "admin",
+		Title:     "Hello & welcome",
+		Body:      "Hello **world**",
+		CreatedAt: time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2024, 2, 1, 7, 0, 0, 0, time.UTC),
+	}
+	if post != want {
+		t.Errorf("post %+v\nwant %+v", post, want)
+	}
+
+	reasons := make(map[string]string)
+	for _, skipped := range source.Skipped {
+		reasons[strings.Fields(skipped.Source)[0]] = skipped.Reason
+	}
+	for id, reason := range map[string]string{
+		"wordpress:2": "тип page",
+		"wordpress:3": "статус draft",
+		"wordpress:4": "защищена паролем",
+		"wordpress:5": "пустая запись",
+		"wordpress:6": "тип attachment",
+	} {
+		if reasons[id] != reason {
+			t.Errorf("%s skipped as %q, want %q", id, reasons[id], reason)
+		}
+	}
+}
+
+func TestReadWXRMalformed(t *testing.T) {
+	if _, err := ReadWXR(strings.NewReader(wxrHeader + "<item><title>broken")); err == nil {
+		t.Fatal("truncated document accepted")
+	}
+}
+
+func TestWXRDate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		values []string
+		want   time.Time
+	}{
+		{"gmt date", []string{"2024-01-01 07:00:00"}, time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC)},
+		// Черновики содержат нулевую дату, берётся следующая
+		{"zero date falls back", []string{"0000-00-00 00:00:00", "2024-01-01 10:00:00"}, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{"rfc 1123 in utc", []string{"", "Mon, 01 Jan 2024 10:00:00 +0300"}, time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC)},
+		{"nothing parsable", []string{"yesterday"}, time.Time{}},
+	} {
+		if got := wxrDate(test.values...); !got.Equal(test.want) || got.Location() != time.UTC {
+			t.Errorf("%s: wxrDate = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWXRPostKeyWithoutGUID(t *testing.T) {
+	post, reason, err := wxrPost(wxrItem{
+		PostID:   " 42 ",
+		Link:     "https://old.example/hello/",
+		Title:    "  Hello \n world ",
+		Content:  "text",
+		Status:   "publish",
+		PostType: "post",
+	})
+	if err != nil || reason != "" {
+		t.Fatalf("wxrPost = %q, %v", reason, err)
+	}
+	if post.Key != "wordpress:42:https://old.example/hello/" || post.Title != "Hello world" {
+		t.Errorf("key %q, title %q", post.Key, post.Title)
+	}
+}
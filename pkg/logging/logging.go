@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Параметры журналирования
+type Config struct {
+	// debug, info, warn или error
+	Level  string
+	Format string
+	// Дополнительные ключи, значения которых скрываются
+	RedactKeys []string
+	Output     io.Writer
+}
+
+type contextKey struct{}
+
+func DefaultConfig() Config {
+	return Config{
+		Level:  "info",
+		Format: FormatJSON,
+		Output: os.Stdout,
+	}
+}
+
+// InitializationLogger настраивает slog по умолчанию. Стандартный пакет log
+// после этого тоже пишет через slog
+func InitializationLogger(config Config) error {
+	level := slog.LevelInfo
+	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+		return fmt.Errorf("Неизвестный уровень журнала: %s", config.Level)
+	}
+
+	for _, key := range config.RedactKeys {
+		AddRedactKey(key)
+	}
+
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceAttr}
+
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case FormatJSON, "":
+		handler = slog.NewJSONHandler(config.Output, options)
+	case FormatText:
+		handler = slog.NewTextHandler(config.Output, options)
+	default:
+		return fmt.Errorf("Неизвестный формат журнала: %s", config.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// WithLogger сохраняет логгер запроса в контексте
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext возвращает логгер запроса или логгер по умолчанию
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
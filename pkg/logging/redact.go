@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	redactMu sync.RWMutex
+	// Ключи с секретами и персональными данными, сравниваются без учёта регистра
+	redactKeys = map[string]bool{
+		"password":            true,
+		"new_password":        true,
+		"token":               true,
+		"access_token":        true,
+		"id_token":            true,
+		"refresh_token":       true,
+		"csrf_token":          true,
+		"secret":              true,
+		"client_secret":       true,
+		"challenge":           true,
+		"recovery_codes":      true,
+		"email":               true,
+		"authorization":       true,
+		"proxy-authorization": true,
+		"cookie":              true,
+		"set-cookie":          true,
+		"x-csrf-token":        true,
+	}
+	// Ключи, секретные только в теле и строке запроса: одноразовые коды
+	// OIDC и TOTP. В остальных записях журнала code — обычный атрибут,
+	// например код ответа
+	payloadRedactKeys = map[string]bool{
+		"code": true,
+	}
+)
+
+func AddRedactKey(key string) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	redactKeys[strings.ToLower(strings.TrimSpace(key))] = true
+}
+
+func isRedacted(key string) bool {
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+	return redactKeys[strings.ToLower(key)]
+}
+
+func isPayloadRedacted(key string) bool {
+	return payloadRedactKeys[strings.ToLower(key)] || isRedacted(key)
+}
+
+// replaceAttr скрывает значения атрибутов с секретными ключами в любой записи журнала
+func replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() != slog.KindGroup && isRedacted(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+	return attr
+}
+
+// RedactHeaders возвращает заголовки для журнала со скрытыми секретами
+func RedactHeaders(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for key, values := range header {
+		if isRedacted(key) {
+			result[key] = redacted
+			continue
+		}
+		result[key] = strings.Join(values, ", ")
+	}
+	return result
+}
+
+// RedactQuery возвращает параметры строки запроса для журнала со скрытыми секретами
+func RedactQuery(query url.Values) map[string]string {
+	result := make(map[string]string, len(query))
+	for key, values := range query {
+		if isPayloadRedacted(key) {
+			result[key] = redacted
+			continue
+		}
+		result[key] = strings.Join(values, ", ")
+	}
+	return result
+}
+
+// RedactJSON разбирает тело запроса и скрывает значения секретных ключей
+// на любой глубине. Тело, которое не является JSON, не возвращается
+func RedactJSON(body []byte) (interface{}, bool) {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, false
+	}
+	return redactValue(document), true
+}
+
+func redactValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range typed {
+			if isPayloadRedacted(key) {
+				typed[key] = redacted
+				continue
+			}
+			typed[key] = redactValue(nested)
+		}
+	case []interface{}:
+		for i, nested := range typed {
+			typed[i] = redactValue(nested)
+		}
+	}
+	return value
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"log/slog"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestReplaceAttr(t *testing.T) {
+	for _, test := range []struct {
+		attr slog.Attr
+		want string
+	}{
+		{slog.String("password", "secret"), redacted},
+		{slog.String("Authorization", "Bearer x"), redacted},
+		// Код ответа или ошибки в журнале не секрет
+		{slog.Int("code", 404), "404"},
+		{slog.String("login", "alice"), "alice"},
+	} {
+		if got := replaceAttr(nil, test.attr).Value.String(); got != test.want {
+			t.Errorf("replaceAttr(%s) = %q, want %q", test.attr.Key, got, test.want)
+		}
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	body, ok := RedactJSON([]byte(`{"login":"alice","password":"p","code":"123456","nested":[{"Code":"x","token":"t","kind":"like"}]}`))
+	if !ok {
+		t.Fatal("valid JSON rejected")
+	}
+	want := map[string]interface{}{
+		"login":    "alice",
+		"password": redacted,
+		"code":     redacted,
+		"nested":   []interface{}{map[string]interface{}{"Code": redacted, "token": redacted, "kind": "like"}},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("RedactJSON = %v, want %v", body, want)
+	}
+
+	if _, ok := RedactJSON([]byte("login=alice")); ok {
+		t.Error("non-JSON body returned")
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	query := url.Values{"code": {"abc"}, "state": {"s1"}, "access_token": {"t"}, "tag": {"go", "sql"}}
+	want := map[string]string{"code": redacted, "state": "s1", "access_token": redacted, "tag": "go, sql"}
+	if got := RedactQuery(query); !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactQuery = %v, want %v", got, want)
+	}
+}
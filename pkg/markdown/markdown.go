@@ -0,0 +1,63 @@
+package markdown
+
+import (
+	"blog/pkg/lru"
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Ключ кеша: одна запись на каждую ревизию статьи
+type revision struct {
+	articleID int
+	revision  int
+}
+
+var (
+	// Сырой HTML в тексте не пропускается рендерером, а результат
+	// дополнительно проходит через белый список тегов
+	renderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	policy   = newPolicy()
+	cache    = lru.New[revision, string](1024)
+)
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireNoFollowOnLinks(true)
+	p.RequireNoReferrerOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+func InitializationCache(size int) {
+	cache = lru.New[revision, string](size)
+}
+
+// Render преобразует Markdown в безопасный HTML
+func Render(text string) (string, error) {
+	var buffer bytes.Buffer
+	if err := renderer.Convert([]byte(text), &buffer); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buffer.String()), nil
+}
+
+// RenderRevision возвращает HTML статьи, кешируя результат для каждой ревизии
+func RenderRevision(articleID, articleRevision int, text string) (string, error) {
+	key := revision{articleID: articleID, revision: articleRevision}
+	if html, ok := cache.Get(key); ok {
+		return html, nil
+	}
+
+	html, err := Render(text)
+	if err != nil {
+		return "", err
+	}
+	cache.Add(key, html)
+	return html, nil
+}
@@ -0,0 +1,45 @@
+package markdown
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		text string
+		html string
+	}{
+		{"formatting", "# Title\n\n**bold** ~~old~~", "<h1>Title</h1>\n<p><strong>bold</strong> <del>old</del></p>\n"},
+		{"table", "| a |\n|---|\n| 1 |", "<table>\n<thead>\n<tr>\n<th>a</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>1</td>\n</tr>\n</tbody>\n</table>\n"},
+		{"code language class", "```go\nfmt.Println()\n```", "<pre><code class=\"language-go\">fmt.Println()\n</code></pre>\n"},
+		{"external link", "[x](https://a.example)", "<p><a href=\"https://a.example\" rel=\"nofollow noreferrer noopener\" target=\"_blank\">x</a></p>\n"},
+		{"relative link", "[x](/articles/1)", "<p><a href=\"/articles/1\" rel=\"nofollow noreferrer\">x</a></p>\n"},
+		{"mailto link", "[m](mailto:a@b.example)", "<p><a href=\"mailto:a@b.example\" rel=\"nofollow noreferrer\">m</a></p>\n"},
+		{"image", "![i](https://a.example/i.png)", "<p><img src=\"https://a.example/i.png\" alt=\"i\"></p>\n"},
+		// Всё, что может выполнить скрипт, вырезается
+		{"script tag", "<script>alert(1)</script>", "\n"},
+		{"event handler", "<img src=x onerror=alert(1)>", "\n"},
+		{"raw anchor", "<a href=\"https://x\" onclick=\"y\">l</a>", "<p>l</p>\n"},
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"data link", "[d](data:text/html;base64,PHNjcmlwdD4=)", "<p>d</p>\n"},
+		{"quote in code language", "```js\" onmouseover=\"x\nz\n```", "<pre><code>z\n</code></pre>\n"},
+	} {
+		html, err := Render(test.text)
+		if err != nil || html != test.html {
+			t.Errorf("%s: Render = %q, %v, want %q", test.name, html, err, test.html)
+		}
+	}
+}
+
+func TestRenderRevisionCache(t *testing.T) {
+	InitializationCache(16)
+	defer InitializationCache(1024)
+
+	first, _ := RenderRevision(1, 1, "first")
+	// Та же ревизия берётся из кеша, даже если текст передан другой
+	if cached, _ := RenderRevision(1, 1, "changed"); cached != first {
+		t.Errorf("same revision rendered again: %q", cached)
+	}
+	if next, _ := RenderRevision(1, 2, "changed"); next != "<p>changed</p>\n" {
+		t.Errorf("new revision = %q", next)
+	}
+}
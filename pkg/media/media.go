@@ -0,0 +1,108 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Параметры загрузки файлов
+type Config struct {
+	// Максимальный размер файла в байтах
+	MaxBytes int64
+	// Максимальная сторона миниатюры в пикселях
+	ThumbnailSize int
+	// Максимальное число пикселей исходного изображения
+	MaxPixels int
+}
+
+var (
+	config = DefaultConfig()
+
+	// Разрешённые типы файлов, определяются по содержимому, а не по имени
+	allowedTypes = map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+		"image/gif":  true,
+		"image/webp": true,
+	}
+
+	ErrTooLarge        = errors.New("Файл слишком большой")
+	ErrUnsupportedType = errors.New("Недопустимый тип файла, разрешены JPEG, PNG, GIF и WebP")
+	ErrInvalidImage    = errors.New("Файл повреждён или не является изображением")
+)
+
+func DefaultConfig() Config {
+	return Config{
+		MaxBytes:      10 << 20,
+		ThumbnailSize: 320,
+		MaxPixels:     40_000_000,
+	}
+}
+
+func InitializationMedia(newConfig Config) {
+	config = newConfig
+}
+
+func CurrentConfig() Config {
+	return config
+}
+
+// DetectType определяет тип файла по первым байтам содержимого
+func DetectType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// Thumbnail уменьшает изображение так, чтобы большая сторона не превышала
+// ThumbnailSize. JPEG остаётся JPEG, остальные форматы сохраняются в PNG,
+// чтобы не потерять прозрачность. Возвращает данные и их тип
+func Thumbnail(data []byte) ([]byte, string, error) {
+	// Размеры проверяются до декодирования, чтобы маленький файл
+	// не раскрылся в гигантское изображение в памяти
+	header, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+	if header.Width <= 0 || header.Height <= 0 || header.Width*header.Height > config.MaxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+
+	width, height := fit(header.Width, header.Height, config.ThumbnailSize)
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), source, source.Bounds(), draw.Src, nil)
+
+	buffer := bytes.Buffer{}
+	if format == "jpeg" {
+		err = jpeg.Encode(&buffer, thumbnail, &jpeg.Options{Quality: 85})
+		return buffer.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buffer, thumbnail)
+	return buffer.Bytes(), "image/png", err
+}
+
+// fit сохраняет пропорции, маленькие изображения не увеличиваются
+func fit(width, height, limit int) (int, int) {
+	if width <= limit && height <= limit {
+		return width, height
+	}
+	if width >= height {
+		return limit, max(1, height*limit/width)
+	}
+	return max(1, width*limit/height), limit
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "blog"
+
+// Способы входа для счётчика попыток
+const (
+	LoginPassword  = "password"
+	LoginTwoFactor = "2fa"
+	LoginOIDC      = "oidc"
+)
+
+var (
+	Registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Количество HTTP-запросов по маршруту, методу и статусу.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Время обработки HTTP-запросов.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Время выполнения запросов к БД по методу dbwork.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	dbEventDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_event_duration_seconds",
+		Help:      "Время обработки события записи в управляющей горутине.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"event"})
+
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "Попытки входа по способу и результату.",
+	}, []string{"method", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		dbQueryDuration,
+		dbEventDuration,
+		loginAttempts,
+	)
+}
+
+// Handler отдаёт метрики в формате Prometheus. Если token не пуст,
+// запрос должен содержать заголовок Authorization: Bearer <token>
+func Handler(token string) http.Handler {
+	return RequireToken(token, promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+}
+
+// RequireToken пропускает запрос к служебному обработчику, только если
+// он содержит Authorization: Bearer <token>. Пустой token отключает проверку
+func RequireToken(token string, handler http.Handler) http.Handler {
+	if token == "" {
+		return handler
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+// Middleware считает запросы по шаблону маршрута, а не по фактическому пути,
+// чтобы идентификаторы в адресах не раздували число рядов
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+// WriteHeader запоминает первый код: повторный вызов клиенту уже не отправляется
+func (recorder *statusRecorder) WriteHeader(code int) {
+	if !recorder.written {
+		recorder.status = code
+		recorder.written = true
+	}
+	recorder.ResponseWriter.WriteHeader(code)
+}
+
+func (recorder *statusRecorder) Write(data []byte) (int, error) {
+	recorder.written = true
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+func ObserveQuery(query string, duration time.Duration) {
+	dbQueryDuration.WithLabelValues(query).Observe(duration.Seconds())
+}
+
+func ObserveEvent(event string, duration time.Duration) {
+	dbEventDuration.WithLabelValues(event).Observe(duration.Seconds())
+}
+
+func LoginAttempt(method string, success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	loginAttempts.WithLabelValues(method, result).Inc()
+}
+
+// RegisterDB добавляет статистику пула соединений и длину очереди записи
+func RegisterDB(db *sql.DB, queueDepth func() int) {
+	Registry.MustRegister(
+		collectors.NewDBStatsCollector(db, "blog"),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "db_event_queue_depth",
+			Help:      "Количество событий записи, ожидающих обработки.",
+		}, func() float64 {
+			return float64(queueDepth())
+		}),
+	)
+}
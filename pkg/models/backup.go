@@ -0,0 +1,98 @@
+package models
+
+import "time"
+
+// Версия формата выгрузки
+const BackupVersion = 1
+
+// Типы записей выгрузки. Записи идут в этом порядке: статья должна
+// встретиться раньше реакций и закладок, которые на неё ссылаются
+const (
+	BackupHeader   = "header"
+	BackupUser     = "user"
+	BackupArticle  = "article"
+	BackupReaction = "reaction"
+	BackupBookmark = "bookmark"
+	BackupFollow   = "follow"
+	BackupMedia    = "media"
+)
+
+// Строка выгрузки в формате JSON Lines. Заполнено одно поле,
+// соответствующее Type
+type BackupRecord struct {
+	Type     string              `json:"type"`
+	Header   *BackupHeaderData   `json:"header,omitempty"`
+	User     *BackupUserData     `json:"user,omitempty"`
+	Article  *BackupArticleData  `json:"article,omitempty"`
+	Reaction *BackupReactionData `json:"reaction,omitempty"`
+	Bookmark *BackupBookmarkData `json:"bookmark,omitempty"`
+	Follow   *BackupFollowData   `json:"follow,omitempty"`
+	Media    *BackupMediaData    `json:"media,omitempty"`
+}
+
+type BackupHeaderData struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Содержит ли выгрузка хеши паролей
+	Passwords bool `json:"passwords"`
+}
+
+type BackupUserData struct {
+	Login      string     `json:"login"`
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// Хеш пароля, только если выгрузка запрошена с паролями
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+type BackupArticleData struct {
+	// Идентификатор в исходном блоге, на него ссылаются реакции и закладки
+	ID int `json:"id"`
+	// Постоянный идентификатор: повторный импорт обновляет статью, а не создаёт копию
+	UID       string    `json:"uid"`
+	Author    string    `json:"author"`
+	Text      string    `json:"text"`
+	Revision  int       `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type BackupReactionData struct {
+	ArticleID int       `json:"article_id"`
+	Login     string    `json:"login"`
+	Kind      string    `json:"kind"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BackupBookmarkData struct {
+	ArticleID int       `json:"article_id"`
+	Login     string    `json:"login"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BackupFollowData struct {
+	Follower  string    `json:"follower"`
+	Followee  string    `json:"followee"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BackupMediaData struct {
+	ID            string    `json:"id"`
+	Owner         string    `json:"owner"`
+	StorageKey    string    `json:"storage_key"`
+	ThumbnailKey  string    `json:"thumbnail_key"`
+	ThumbnailType string    `json:"thumbnail_type"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	Name          string    `json:"name"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Пачка записей для импорта. ArticleIDs переживает пачки: в него
+// записываются соответствия идентификаторов исходного блога и этого
+type ImportBatch struct {
+	Records    []BackupRecord
+	ArticleIDs map[int]int
+	// Сколько записей каждого типа применено
+	Applied map[string]int
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -25,10 +26,83 @@ type Article struct {
 	// example: 5
 	UserID int `json:"user_id"`
 
-	// Основное содержимое статьи
+	// Основное содержимое статьи в формате Markdown
 	// required: true
 	// example: Текст статьи...
 	Text string `json:"text"`
+
+	// Содержимое статьи, преобразованное в безопасный HTML
+	// example: <p>Текст статьи...</p>
+	HTML string `json:"html"`
+
+	// Номер ревизии, увеличивается при каждом изменении текста
+	// example: 1
+	Revision int `json:"revision"`
+
+	// Количество реакций каждого вида
+	// example: {"like": 3, "heart": 1}
+	Reactions map[string]int `json:"reactions"`
+
+	// Время публикации
+	CreatedAt time.Time `json:"created_at"`
+
+	// Время последнего изменения
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Статья в закладках у текущего пользователя, только для авторизованных запросов
+	Bookmarked *bool `json:"bookmarked,omitempty"`
+}
+
+// Виды реакций на статьи
+const (
+	ReactionLike   = "like"
+	ReactionHeart  = "heart"
+	ReactionLaugh  = "laugh"
+	ReactionWow    = "wow"
+	ReactionSad    = "sad"
+	ReactionRocket = "rocket"
+)
+
+var ReactionKinds = []string{
+	ReactionLike,
+	ReactionHeart,
+	ReactionLaugh,
+	ReactionWow,
+	ReactionSad,
+	ReactionRocket,
+}
+
+// Порядок сортировки списка статей
+const (
+	SortDefault   = ""
+	SortMostLiked = "most_liked"
+	SortNewest    = "newest"
+)
+
+// Параметры выборки списка статей
+type ArticleFilter struct {
+	Sort string
+	// Только статьи авторов, на которых подписан пользователь
+	FollowedBy string
+	// Только статьи из закладок пользователя, по умолчанию от недавно добавленных
+	BookmarkedBy string
+	// Только статьи указанного автора
+	Author string
+	// 0 — без ограничения
+	Limit  int
+	Offset int
+}
+
+// Подписчик или автор, на которого подписан пользователь
+// swagger:model follow
+type Follow struct {
+	// Логин пользователя
+	// required: true
+	// example: user123
+	Login string `json:"login"`
+
+	// Время подписки
+	Since time.Time `json:"since"`
 }
 
 // User представляет учётную запись пользователя
@@ -65,10 +139,12 @@ type Request struct {
 
 type Claims struct {
 	Login string `json:"login"`
+	// Назначение токена: пусто для обычной сессии, "2fa" для промежуточного токена входа
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// Стандартный ответ API
+// Стандартный ответ API. Code совпадает с HTTP-статусом ответа
 // swagger:model
 type Response struct {
 	Code    int    `json:"code"`
@@ -76,50 +152,221 @@ type Response struct {
 }
 
 func ResponseUnauthorized(rw http.ResponseWriter) {
-	json.NewEncoder(rw).Encode(Response{
-		Code:    http.StatusUnauthorized,
-		Message: "Вы не авторизованы",
-	})
+	ResponseNew(rw, "Вы не авторизованы", http.StatusUnauthorized)
 }
 
 func ResponseErrorServer(rw http.ResponseWriter) {
-	json.NewEncoder(rw).Encode(Response{
-		Code:    http.StatusInternalServerError,
-		Message: "Неизвестная ошибка сервера",
-	})
+	ResponseNew(rw, "Неизвестная ошибка сервера", http.StatusInternalServerError)
 }
 
 func ResponseBadRequest(rw http.ResponseWriter) {
-	json.NewEncoder(rw).Encode(Response{
-		Code:    http.StatusBadRequest,
-		Message: "Ошибка запроса",
-	})
+	ResponseNew(rw, "Ошибка запроса", http.StatusBadRequest)
 }
 
 func ResponseCreated(rw http.ResponseWriter) {
-	json.NewEncoder(rw).Encode(Response{
-		Code:    http.StatusCreated,
-		Message: "Объект создан",
-	})
+	ResponseNew(rw, "Объект создан", http.StatusCreated)
 }
 
 func ResponseNotFound(rw http.ResponseWriter) {
-	json.NewEncoder(rw).Encode(Response{
-		Code:    http.StatusNotFound,
-		Message: "Страница не найдена",
-	})
+	ResponseNew(rw, "Страница не найдена", http.StatusNotFound)
 }
 
 func ResponseOK(rw http.ResponseWriter) {
-	json.NewEncoder(rw).Encode(Response{
-		Code:    http.StatusOK,
-		Message: "Запрос выполнен",
-	})
+	ResponseNew(rw, "Запрос выполнен", http.StatusOK)
 }
 
+// ResponseNew пишет код и в строку статуса, и в тело. Вызывается до
+// начала ответа: после первой записи статус уже не изменить
 func ResponseNew(rw http.ResponseWriter, message string, code int) {
+	rw.WriteHeader(code)
 	json.NewEncoder(rw).Encode(Response{
 		Code:    code,
 		Message: message,
 	})
 }
+
+// Состояние двухфакторной аутентификации пользователя
+type TOTP struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// Данные для подключения приложения-аутентификатора
+// swagger:model totpSetup
+type TOTPSetup struct {
+	// Секрет в base32
+	// required: true
+	Secret string `json:"secret"`
+
+	// Ссылка otpauth:// для QR-кода
+	// required: true
+	URI string `json:"uri"`
+}
+
+// Одноразовый код подтверждения
+// swagger:model totpCode
+type TOTPCode struct {
+	// Код из приложения или код восстановления
+	// required: true
+	// example: 123456
+	Code string `json:"code"`
+}
+
+// Коды восстановления, показываются один раз
+// swagger:model recoveryCodes
+type RecoveryCodes struct {
+	// required: true
+	Codes []string `json:"recovery_codes"`
+}
+
+// Второй шаг входа с двухфакторной аутентификацией
+// swagger:model twoFactorLogin
+type TwoFactorLogin struct {
+	// Токен, полученный на первом шаге
+	// required: true
+	Challenge string `json:"challenge"`
+
+	// Код из приложения или код восстановления
+	// required: true
+	// example: 123456
+	Code string `json:"code"`
+}
+
+// Ответ первого шага входа, если включена двухфакторная аутентификация
+// swagger:model twoFactorChallenge
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge"`
+}
+
+// Персональный токен доступа для скриптов и CI
+// swagger:model apiToken
+type APIToken struct {
+	// Уникальный идентификатор токена
+	// example: 3
+	ID int `json:"id"`
+
+	// Логин владельца
+	Login string `json:"-"`
+
+	// Название токена
+	// required: true
+	// example: release-notes
+	Name string `json:"name"`
+
+	// Разрешения токена
+	// required: true
+	// example: ["articles:write"]
+	Scopes []string `json:"scopes"`
+
+	// Значение токена, возвращается только при создании
+	Token string `json:"token,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// Запрос на создание персонального токена
+// swagger:model apiTokenRequest
+type APITokenRequest struct {
+	// Название токена
+	// required: true
+	// example: release-notes
+	Name string `json:"name"`
+
+	// Разрешения токена
+	// required: true
+	// example: ["articles:write"]
+	Scopes []string `json:"scopes"`
+
+	// Срок действия в днях, 0 — бессрочный
+	// example: 90
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// Загруженный файл
+// swagger:model media
+type Media struct {
+	// Уникальный идентификатор файла
+	// example: 0b6f1c7e-8a52-4f7e-9d0e-2f4c1a3b5d6e
+	ID string `json:"id"`
+
+	// Логин владельца
+	// example: user123
+	Owner string `json:"owner"`
+
+	// Тип содержимого, определённый по самому файлу
+	// example: image/png
+	ContentType string `json:"content_type"`
+
+	// Размер в байтах
+	// example: 204800
+	Size int64 `json:"size"`
+
+	// Имя файла при загрузке
+	// example: photo.png
+	Name string `json:"name"`
+
+	// Адрес файла
+	// example: /media/0b6f1c7e-8a52-4f7e-9d0e-2f4c1a3b5d6e
+	URL string `json:"url"`
+
+	// Адрес миниатюры
+	// example: /media/0b6f1c7e-8a52-4f7e-9d0e-2f4c1a3b5d6e/thumbnail
+	ThumbnailURL string `json:"thumbnail_url"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	// Ключи в хранилище
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	// Тип миниатюры
+	ThumbnailType string `json:"-"`
+}
+
+// Состояние БД и управляющей горутины для проверки готовности
+// swagger:model dbStatus
+type DBStatus struct {
+	// Версия схемы в БД
+	MigrationVersion uint `json:"migration_version"`
+	// Последняя миграция, известная приложению
+	ExpectedVersion uint `json:"expected_version"`
+	Dirty           bool `json:"dirty"`
+	WriterRunning   bool `json:"writer_running"`
+	QueueLength     int  `json:"queue_length"`
+	QueueCapacity   int  `json:"queue_capacity"`
+}
+
+// Роли пользователей
+const (
+	RoleUser = "user"
+	// Администратор может удалять чужие статьи
+	RoleAdmin = "admin"
+)
+
+var Roles = []string{RoleUser, RoleAdmin}
+
+// Состояние учётной записи
+// swagger:model account
+type Account struct {
+	Login string `json:"login"`
+	Role  string `json:"role"`
+	// Время блокировки, если учётная запись заблокирована
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+// Сводная статистика блога
+type Stats struct {
+	Users         int   `json:"users"`
+	DisabledUsers int   `json:"disabled_users"`
+	Admins        int   `json:"admins"`
+	Articles      int   `json:"articles"`
+	Reactions     int   `json:"reactions"`
+	Bookmarks     int   `json:"bookmarks"`
+	Follows       int   `json:"follows"`
+	Media         int   `json:"media"`
+	MediaBytes    int64 `json:"media_bytes"`
+	APITokens     int   `json:"api_tokens"`
+}
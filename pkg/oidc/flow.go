@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const flowExpiration = 10 * time.Minute
+
+var ErrInvalidFlow = errors.New("Недействительное состояние входа, начните заново")
+
+// Flow хранит параметры незавершённого входа в подписанной cookie
+type Flow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// Пользователь блога, начавший привязку из своей сессии
+	Link string `json:"link,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func NewFlow() (*Flow, error) {
+	state, err := RandomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := RandomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Flow{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(flowExpiration)),
+		},
+	}, nil
+}
+
+func EncodeFlow(flow *Flow) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, flow)
+	return token.SignedString(config.StateSecret)
+}
+
+func DecodeFlow(value string) (*Flow, error) {
+	flow := &Flow{}
+	_, err := jwt.ParseWithClaims(
+		value,
+		flow,
+		func(token *jwt.Token) (interface{}, error) {
+			return config.StateSecret, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, ErrInvalidFlow
+	}
+	return flow, nil
+}
+
+// LoginCandidate подбирает локальный логин из утверждений ID-токена,
+// оставляя только символы, допустимые политикой логинов
+func LoginCandidate(claims *IDTokenClaims, minLength, maxLength int) string {
+	source := claims.PreferredUsername
+	if source == "" && claims.Email != "" {
+		source = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	if source == "" {
+		source = "user"
+	}
+
+	var builder strings.Builder
+	for _, r := range source {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			builder.WriteRune(r)
+		case r == '_' || r == '.' || r == '-':
+			builder.WriteRune(r)
+		}
+	}
+
+	login := builder.String()
+	for len(login) < minLength {
+		login += "_"
+	}
+	if len(login) > maxLength {
+		login = login[:maxLength]
+	}
+	return login
+}
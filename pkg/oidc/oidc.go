@@ -0,0 +1,299 @@
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Параметры внешнего провайдера OpenID Connect
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// Куда перенаправить пользователя после входа, токен передаётся во фрагменте URL.
+	// Если пусто, токен возвращается в JSON
+	PostLoginRedirect string
+	// Разрешить вошедшему пользователю привязать внешнюю учётную запись
+	// через GET /auth/oidc/link. Совпадение логинов для привязки не используется
+	LinkExisting bool
+	// Секрет, из которого выводится ключ подписи cookie с состоянием входа
+	StateSecret []byte
+}
+
+// Адреса провайдера из /.well-known/openid-configuration
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Утверждения ID-токена, которые использует блог
+type IDTokenClaims struct {
+	Nonce             string `json:"nonce"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+	Name              string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+var (
+	config  Config
+	enabled bool
+
+	client = &http.Client{Timeout: 10 * time.Second}
+
+	providerMu sync.Mutex
+	provider   *discovery
+	keys       map[string]interface{}
+
+	ErrDisabled     = errors.New("Вход через внешнего провайдера не настроен")
+	ErrInvalidToken = errors.New("Недействительный ID-токен")
+)
+
+func InitializationOIDC(newConfig Config) {
+	config = newConfig
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	config.StateSecret = flowKey(newConfig.StateSecret)
+	enabled = config.Issuer != "" && config.ClientID != ""
+
+	providerMu.Lock()
+	provider, keys = nil, nil
+	providerMu.Unlock()
+}
+
+// flowKey выводит отдельный ключ для cookie с состоянием входа. Подписанная
+// общим с сессиями ключом, она проходила бы проверку как JWT блога
+func flowKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("oidc-flow"))
+	return mac.Sum(nil)
+}
+
+func Enabled() bool {
+	return enabled
+}
+
+func CurrentConfig() Config {
+	return config
+}
+
+// RandomString возвращает случайное значение для state, nonce и code_verifier
+func RandomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// AuthCodeURL формирует адрес авторизации с PKCE (S256)
+func AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	if !enabled {
+		return "", ErrDisabled
+	}
+	p, err := getProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", config.ClientID)
+	query.Set("redirect_uri", config.RedirectURL)
+	query.Set("scope", strings.Join(config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange обменивает код авторизации на токены и проверяет ID-токен
+func Exchange(ctx context.Context, code, verifier, nonce string) (*IDTokenClaims, error) {
+	if !enabled {
+		return nil, ErrDisabled
+	}
+	p, err := getProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", config.RedirectURL)
+	form.Set("client_id", config.ClientID)
+	form.Set("code_verifier", verifier)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := tokenResponse{}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("token endpoint: %w", err)
+	}
+	if response.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %d %s %s", response.StatusCode, tokens.Error, tokens.Description)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint: %w", ErrInvalidToken)
+	}
+
+	return verifyIDToken(ctx, p, tokens.IDToken, nonce)
+}
+
+func verifyIDToken(ctx context.Context, p *discovery, raw, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		raw,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return getKey(ctx, p, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Nonce != nonce || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func getProvider(ctx context.Context) (*discovery, error) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	if provider != nil {
+		return provider, nil
+	}
+
+	p := &discovery{}
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, wellKnown, p); err != nil {
+		return nil, err
+	}
+	if p.Issuer != config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: %q != %q", p.Issuer, config.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("incomplete provider metadata")
+	}
+
+	provider = p
+	return provider, nil
+}
+
+// getKey возвращает ключ подписи по kid, при неизвестном kid набор ключей перечитывается
+func getKey(ctx context.Context, p *discovery, kid string) (interface{}, error) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	if key, ok := lookupKey(kid); ok {
+		return key, nil
+	}
+
+	set := jwkSet{}
+	if err := getJSON(ctx, p.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys = set.publicKeys()
+
+	if key, ok := lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func lookupKey(kid string) (interface{}, bool) {
+	if kid != "" {
+		key, ok := keys[kid]
+		return key, ok
+	}
+	// Без kid допустим только единственный ключ
+	if len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func getJSON(ctx context.Context, address string, target interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", address, response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(target)
+}
@@ -0,0 +1,179 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// Параметры хеширования паролей
+type HashParams struct {
+	Algorithm string
+	// Параметры argon2id
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+	// Стоимость bcrypt
+	BcryptCost int
+}
+
+var (
+	hashParams = DefaultHashParams()
+
+	// Хеш для выравнивания времени ответа при проверке несуществующего пользователя
+	dummyHash string
+
+	ErrUnknownHash = errors.New("Неизвестный формат хеша пароля")
+)
+
+// Параметры по умолчанию соответствуют рекомендациям OWASP
+func DefaultHashParams() HashParams {
+	return HashParams{
+		Algorithm:   AlgorithmArgon2id,
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+		BcryptCost:  12,
+	}
+}
+
+func InitializationHash(params HashParams) error {
+	if params.Algorithm != AlgorithmArgon2id && params.Algorithm != AlgorithmBcrypt {
+		return fmt.Errorf("Неизвестный алгоритм хеширования: %s", params.Algorithm)
+	}
+	hashParams = params
+
+	hash, err := Hash("dummy-password")
+	if err != nil {
+		return err
+	}
+	dummyHash = hash
+	return nil
+}
+
+// Hash возвращает хеш пароля в формате выбранного алгоритма
+func Hash(password string) (string, error) {
+	if hashParams.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), hashParams.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, hashParams.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey(
+		[]byte(password),
+		salt,
+		hashParams.Iterations,
+		hashParams.Memory,
+		hashParams.Parallelism,
+		hashParams.KeyLength,
+	)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		hashParams.Memory,
+		hashParams.Iterations,
+		hashParams.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify сверяет пароль с хешем. Второе значение сообщает,
+// что хеш устарел и его стоит пересчитать с текущими параметрами
+func Verify(hash, password string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(hash, password)
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return verifyBcrypt(hash, password)
+	}
+	return false, false, ErrUnknownHash
+}
+
+// VerifyDummy тратит на проверку столько же времени, сколько и обычная проверка
+func VerifyDummy(password string) {
+	if dummyHash != "" {
+		Verify(dummyHash, password)
+	}
+}
+
+func verifyBcrypt(hash, password string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	if hashParams.Algorithm != AlgorithmBcrypt {
+		return true, true, nil
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true, false, nil
+	}
+	return true, cost < hashParams.BcryptCost, nil
+}
+
+func verifyArgon2id(hash, password string) (bool, bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, ErrUnknownHash
+	}
+	if version != argon2.Version {
+		return false, false, ErrUnknownHash
+	}
+
+	var memory, iterations uint32
+	var parallelism uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return false, false, ErrUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrUnknownHash
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+
+	rehash := hashParams.Algorithm != AlgorithmArgon2id ||
+		memory != hashParams.Memory ||
+		iterations != hashParams.Iterations ||
+		parallelism != hashParams.Parallelism ||
+		uint32(len(key)) != hashParams.KeyLength
+	return true, rehash, nil
+}
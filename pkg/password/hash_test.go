@@ -0,0 +1,125 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Дешёвые параметры, чтобы тесты не тратили секунды на хеширование
+func testHashParams(algorithm string) HashParams {
+	params := DefaultHashParams()
+	params.Algorithm = algorithm
+	params.Memory = 64
+	params.Iterations = 1
+	params.BcryptCost = bcrypt.MinCost
+	return params
+}
+
+func TestHashVerify(t *testing.T) {
+	defer InitializationHash(DefaultHashParams())
+
+	for _, algorithm := range []string{AlgorithmArgon2id, AlgorithmBcrypt} {
+		if err := InitializationHash(testHashParams(algorithm)); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range []struct {
+			password string
+			ok       bool
+		}{
+			{"correct horse", true},
+			{"correct horsf", false},
+			{"", false},
+		} {
+			ok, rehash, err := Verify(hash, test.password)
+			if err != nil || ok != test.ok || rehash {
+				t.Errorf("%s: Verify(%q) = %v, %v, %v", algorithm, test.password, ok, rehash, err)
+			}
+		}
+	}
+}
+
+func TestHashSalted(t *testing.T) {
+	defer InitializationHash(DefaultHashParams())
+	if err := InitializationHash(testHashParams(AlgorithmArgon2id)); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := Hash("password")
+	second, _ := Hash("password")
+	if first == second {
+		t.Fatal("equal passwords produced equal hashes")
+	}
+}
+
+func TestVerifyRehash(t *testing.T) {
+	defer InitializationHash(DefaultHashParams())
+
+	InitializationHash(testHashParams(AlgorithmBcrypt))
+	bcryptHash, _ := Hash("password")
+	InitializationHash(testHashParams(AlgorithmArgon2id))
+	argonHash, _ := Hash("password")
+
+	stronger := testHashParams(AlgorithmArgon2id)
+	stronger.Iterations = 2
+	strongerBcrypt := testHashParams(AlgorithmBcrypt)
+	strongerBcrypt.BcryptCost = bcrypt.MinCost + 1
+
+	for _, test := range []struct {
+		name   string
+		params HashParams
+		hash   string
+		rehash bool
+	}{
+		{"argon2id with current params", testHashParams(AlgorithmArgon2id), argonHash, false},
+		{"argon2id with more iterations", stronger, argonHash, true},
+		{"bcrypt after switch to argon2id", testHashParams(AlgorithmArgon2id), bcryptHash, true},
+		{"bcrypt with current cost", testHashParams(AlgorithmBcrypt), bcryptHash, false},
+		{"bcrypt with higher cost", strongerBcrypt, bcryptHash, true},
+		{"argon2id after switch to bcrypt", testHashParams(AlgorithmBcrypt), argonHash, true},
+	} {
+		hashParams = test.params
+		ok, rehash, err := Verify(test.hash, "password")
+		if !ok || err != nil || rehash != test.rehash {
+			t.Errorf("%s: Verify = %v, rehash %v, %v", test.name, ok, rehash, err)
+		}
+	}
+}
+
+func TestVerifyUnknownHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plain-text",
+		"$argon2id$v=19$m=64,t=1$c2FsdA$a2V5",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64!$a2V5",
+	} {
+		if _, _, err := Verify(hash, "password"); err != ErrUnknownHash {
+			t.Errorf("Verify(%q) = %v, want ErrUnknownHash", hash, err)
+		}
+	}
+}
+
+func TestBcryptRejectsLongPasswords(t *testing.T) {
+	defer InitializationHash(DefaultHashParams())
+	if err := InitializationHash(testHashParams(AlgorithmBcrypt)); err != nil {
+		t.Fatal(err)
+	}
+
+	// bcrypt не принимает пароли длиннее 72 байт, поэтому их отсекает политика
+	hash, err := Hash(strings.Repeat("a", bcryptMaxBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Hash(strings.Repeat("a", bcryptMaxBytes+1)); err == nil {
+		t.Error("bcrypt hashed a password over 72 bytes")
+	}
+	if ok, _, _ := Verify(hash, strings.Repeat("a", bcryptMaxBytes)); !ok {
+		t.Error("72-byte password rejected")
+	}
+}
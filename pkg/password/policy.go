@@ -0,0 +1,135 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Список распространённых и скомпрометированных паролей
+//
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// NIST SP 800-63B требует принимать пароли хотя бы из 64 символов,
+// поэтому верхнюю границу нельзя опустить ниже
+const minMaxLength = 64
+
+// bcrypt не хеширует пароли длиннее 72 байт
+const bcryptMaxBytes = 72
+
+// Параметры политики паролей и логинов
+type Policy struct {
+	MinLength      int
+	MaxLength      int
+	LoginMinLength int
+	LoginMaxLength int
+	// Проверять пароль по списку распространённых паролей
+	CheckCommon bool
+}
+
+var (
+	policy          = DefaultPolicy()
+	commonPasswords = loadCommonPasswords()
+
+	ErrLoginLength    = errors.New("Недопустимая длина логина")
+	ErrLoginCharset   = errors.New("Логин может содержать только латинские буквы, цифры и символы _ . -")
+	ErrLoginReserved  = errors.New("Этот логин зарезервирован")
+	ErrPasswordLength = errors.New("Недопустимая длина пароля")
+	ErrPasswordCommon = errors.New("Пароль слишком распространён, выберите другой")
+	ErrPasswordLogin  = errors.New("Пароль не должен совпадать с логином")
+)
+
+// Логины, которые конфликтуют с маршрутами API
+var reservedLogins = map[string]bool{
+	"me": true,
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:      8,
+		MaxLength:      256,
+		LoginMinLength: 5,
+		LoginMaxLength: 16,
+		CheckCommon:    true,
+	}
+}
+
+func InitializationPolicy(newPolicy Policy) error {
+	if newPolicy.MaxLength < max(newPolicy.MinLength, minMaxLength) {
+		return fmt.Errorf(
+			"Максимальная длина пароля должна быть не меньше %d и минимальной длины",
+			minMaxLength,
+		)
+	}
+	policy = newPolicy
+	return nil
+}
+
+func CurrentPolicy() Policy {
+	return policy
+}
+
+func loadCommonPasswords() map[string]struct{} {
+	passwords := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
+
+func ValidateLogin(login string) error {
+	if len(login) < policy.LoginMinLength || len(login) > policy.LoginMaxLength {
+		return fmt.Errorf(
+			"%w: от %d до %d символов",
+			ErrLoginLength, policy.LoginMinLength, policy.LoginMaxLength,
+		)
+	}
+
+	for _, r := range login {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_' || r == '.' || r == '-':
+		default:
+			return ErrLoginCharset
+		}
+	}
+
+	if reservedLogins[strings.ToLower(login)] {
+		return ErrLoginReserved
+	}
+	return nil
+}
+
+func ValidatePassword(login, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength || length > policy.MaxLength {
+		return fmt.Errorf(
+			"%w: от %d до %d символов",
+			ErrPasswordLength, policy.MinLength, policy.MaxLength,
+		)
+	}
+	// Символ кириллицы занимает два байта, поэтому лимит bcrypt проверяется отдельно
+	if hashParams.Algorithm == AlgorithmBcrypt && len(password) > bcryptMaxBytes {
+		return fmt.Errorf("%w: не более %d байт в UTF-8", ErrPasswordLength, bcryptMaxBytes)
+	}
+
+	if strings.EqualFold(login, password) {
+		return ErrPasswordLogin
+	}
+
+	if policy.CheckCommon {
+		if _, ok := commonPasswords[strings.ToLower(password)]; ok {
+			return ErrPasswordCommon
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateLogin(t *testing.T) {
+	for _, test := range []struct {
+		login string
+		err   error
+	}{
+		{"alice", nil},
+		{"user_1.test-x", nil},
+		{"abcd", ErrLoginLength},
+		{strings.Repeat("a", 17), ErrLoginLength},
+		{"алиса", ErrLoginCharset},
+		{"alice bob", ErrLoginCharset},
+		{"ME", ErrLoginLength},
+	} {
+		if err := ValidateLogin(test.login); !errors.Is(err, test.err) {
+			t.Errorf("ValidateLogin(%q) = %v, want %v", test.login, err, test.err)
+		}
+	}
+}
+
+func TestValidateLoginReserved(t *testing.T) {
+	defer InitializationPolicy(DefaultPolicy())
+	custom := DefaultPolicy()
+	custom.LoginMinLength = 2
+	if err := InitializationPolicy(custom); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateLogin("Me"); err != ErrLoginReserved {
+		t.Fatalf("ValidateLogin(Me) = %v, want ErrLoginReserved", err)
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		login    string
+		password string
+		err      error
+	}{
+		{"valid", "alice", "correct horse battery", nil},
+		{"too short", "alice", "short", ErrPasswordLength},
+		{"too long", "alice", strings.Repeat("a", 257), ErrPasswordLength},
+		// Длина считается в символах, а не в байтах
+		{"cyrillic at the minimum", "alice", "пароль12", nil},
+		{"same as login", "alicealice", "AliceAlice", ErrPasswordLogin},
+		{"common", "alice", "Password", ErrPasswordCommon},
+		{"common numeric", "alice", "12345678", ErrPasswordCommon},
+	} {
+		if err := ValidatePassword(test.login, test.password); !errors.Is(err, test.err) {
+			t.Errorf("%s: ValidatePassword = %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestValidatePasswordBcryptLimit(t *testing.T) {
+	defer InitializationHash(DefaultHashParams())
+	params := DefaultHashParams()
+	params.Algorithm = AlgorithmBcrypt
+	params.BcryptCost = 4
+	if err := InitializationHash(params); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		password string
+		err      error
+	}{
+		{"72 ascii bytes", strings.Repeat("a", 71) + "b", nil},
+		{"73 ascii bytes", strings.Repeat("a", 72) + "b", ErrPasswordLength},
+		// 40 символов кириллицы — 80 байт, хотя по символам пароль короткий
+		{"40 cyrillic letters", strings.Repeat("ж", 40), ErrPasswordLength},
+		{"36 cyrillic letters", strings.Repeat("ж", 36), nil},
+	} {
+		if err := ValidatePassword("alice", test.password); !errors.Is(err, test.err) {
+			t.Errorf("%s: ValidatePassword = %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestInitializationPolicy(t *testing.T) {
+	defer InitializationPolicy(DefaultPolicy())
+	for _, test := range []struct {
+		name      string
+		min, max  int
+		wantError bool
+	}{
+		{"defaults", 8, 256, false},
+		{"max at the NIST floor", 8, 64, false},
+		{"max below 64", 8, 63, true},
+		{"max below min", 100, 80, true},
+	} {
+		custom := DefaultPolicy()
+		custom.MinLength, custom.MaxLength = test.min, test.max
+		if err := InitializationPolicy(custom); (err != nil) != test.wantError {
+			t.Errorf("%s: InitializationPolicy = %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package site
+
+import (
+	"blog/pkg/feed"
+	"blog/pkg/markdown"
+	"blog/pkg/models"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Страницы сайта. Каждая страница — отдельный шаблон поверх layout.html
+const (
+	PageIndex   = "index"
+	PageAuthor  = "author"
+	PageArticle = "article"
+	// Страницы входа и редактора есть только у сайта, который отдаёт сервер
+	PageLogin  = "login"
+	PageEditor = "editor"
+	PageError  = "error"
+)
+
+//go:embed templates/*.html assets/*
+var files embed.FS
+
+var (
+	funcs = template.FuncMap{
+		"date":    func(t time.Time) string { return t.Format("02.01.2006") },
+		"isoDate": func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	}
+	pages = parsePages(PageIndex, PageAuthor, PageArticle, PageLogin, PageEditor, PageError)
+)
+
+// parsePages собирает для каждой страницы отдельный набор шаблонов:
+// все страницы определяют блок content
+func parsePages(names ...string) map[string]*template.Template {
+	result := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		result[name] = template.Must(template.New(name).Funcs(funcs).ParseFS(
+			files, "templates/layout.html", "templates/"+name+".html",
+		))
+	}
+	return result
+}
+
+// Assets возвращает статические файлы оформления
+func Assets() fs.FS {
+	assets, _ := fs.Sub(files, "assets")
+	return assets
+}
+
+// Ссылка на ленту в заголовке страницы
+type FeedLink struct {
+	Title string
+	Type  string
+	URL   string
+}
+
+// Статья, подготовленная для шаблона
+type ArticleView struct {
+	ID        int
+	Title     string
+	Author    string
+	AuthorURL string
+	URL       string
+	// Безопасный HTML, уже прошедший санитайзер
+	HTML      template.HTML
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Edited    bool
+}
+
+// Ссылки на соседние страницы списка
+type Pagination struct {
+	Page    int
+	Pages   int
+	PrevURL string
+	NextURL string
+}
+
+// Поля формы статьи. Revision передаётся обратно при сохранении, чтобы
+// не затереть чужое изменение
+type ArticleForm struct {
+	Action   string
+	Revision int
+	Text     string
+}
+
+// Данные страницы
+type Page struct {
+	SiteTitle   string
+	Title       string
+	Description string
+	Feeds       []FeedLink
+	Articles    []ArticleView
+	Article     *ArticleView
+	Author      string
+	Pagination  Pagination
+
+	// Поля ниже заполняет только сервер, в статической сборке они пусты.
+	// Accounts включает ссылки входа и редактора
+	Accounts bool
+	// Логин вошедшего пользователя
+	User      string
+	CSRFToken string
+	Error     string
+	// Логин, введённый в форму входа
+	Login string
+	// Токен первого шага входа: форма запрашивает код второго фактора
+	Challenge string
+	Form      ArticleForm
+	// Может ли пользователь редактировать открытую статью
+	CanEdit bool
+}
+
+// NewPage заполняет общие поля страницы из настроек лент
+func NewPage(title string) Page {
+	config := feed.CurrentConfig()
+	return Page{
+		SiteTitle:   config.Title,
+		Title:       title,
+		Description: config.Description,
+		Feeds: []FeedLink{
+			{Title: "RSS", Type: "application/rss+xml", URL: "/feed.rss"},
+			{Title: "Atom", Type: "application/atom+xml", URL: "/feed.atom"},
+			{Title: "JSON Feed", Type: "application/feed+json", URL: "/feed.json"},
+		},
+	}
+}
+
+// Render выполняет шаблон страницы name
+func Render(w io.Writer, name string, page Page) error {
+	tmpl, ok := pages[name]
+	if !ok {
+		return fmt.Errorf("Неизвестная страница %s", name)
+	}
+	return tmpl.ExecuteTemplate(w, "layout", page)
+}
+
+// NewArticleView готовит статью для шаблона. Markdown рендерится через
+// тот же кеш ревизий, что и в API
+func NewArticleView(article models.Article) (ArticleView, error) {
+	html, err := markdown.RenderRevision(article.ID, article.Revision, article.Text)
+	if err != nil {
+		return ArticleView{}, err
+	}
+	return ArticleView{
+		ID:        article.ID,
+		Title:     feed.Title(article),
+		Author:    article.Author,
+		AuthorURL: AuthorPath(article.Author, 1),
+		URL:       ArticlePath(article.ID),
+		HTML:      template.HTML(html),
+		CreatedAt: article.CreatedAt,
+		UpdatedAt: article.UpdatedAt,
+		Edited:    article.UpdatedAt.Sub(article.CreatedAt) > time.Minute,
+	}, nil
+}
+
+// Пути страниц совпадают с feed.ArticleURL в режиме HTMLPages, чтобы
+// ссылки из лент и карты сайта вели на сами страницы
+
+func ArticlePath(id int) string {
+	return "/article/" + strconv.Itoa(id) + "/"
+}
+
+// IndexPath возвращает путь страницы page общего списка статей
+func IndexPath(page int) string {
+	if page <= 1 {
+		return "/"
+	}
+	return "/page/" + strconv.Itoa(page) + "/"
+}
+
+// AuthorPath возвращает путь страницы page статей автора
+func AuthorPath(login string, page int) string {
+	path := "/user/" + url.PathEscape(login) + "/"
+	if page > 1 {
+		path += "page/" + strconv.Itoa(page) + "/"
+	}
+	return path
+}
+
+// NewPagination строит ссылки на соседние страницы. path возвращает
+// путь страницы по номеру
+func NewPagination(page, pages int, path func(int) string) Pagination {
+	result := Pagination{Page: page, Pages: max(pages, 1)}
+	if page > 1 {
+		result.PrevURL = path(page - 1)
+	}
+	if page < pages {
+		result.NextURL = path(page + 1)
+	}
+	return result
+}
+
+// NewOpenPagination строит ссылки, когда число страниц неизвестно,
+// а известно лишь, есть ли следующая
+func NewOpenPagination(page int, hasNext bool, path func(int) string) Pagination {
+	result := Pagination{Page: page}
+	if page > 1 {
+		result.PrevURL = path(page - 1)
+	}
+	if hasNext {
+		result.NextURL = path(page + 1)
+	}
+	return result
+}
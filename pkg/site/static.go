@@ -0,0 +1,341 @@
+package site
+
+import (
+	"blog/pkg/dbwork"
+	"blog/pkg/feed"
+	"blog/pkg/models"
+	"blog/pkg/sitemap"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Файл-метка в каталоге сборки. Каталог с меткой можно заменять
+// новой сборкой, любой другой непустой каталог — нельзя
+const buildMarker = ".blog-static"
+
+var ErrOutputNotEmpty = errors.New("Каталог не пуст и не является результатом blog build-static")
+
+// Параметры статической сборки
+type StaticOptions struct {
+	Out string
+	// Число статей на странице списка
+	PageSize int
+}
+
+func DefaultStaticOptions() StaticOptions {
+	return StaticOptions{PageSize: 10}
+}
+
+// Итоги сборки
+type BuildResult struct {
+	Articles int
+	Authors  int
+	Files    int
+}
+
+// Build рендерит все статьи, списки с пагинацией, страницы авторов, ленты
+// и карту сайта в каталог options.Out. Сборка идёт во временный каталог,
+// который заменяет предыдущую сборку только после успешного завершения
+func Build(ctx context.Context, options StaticOptions) (BuildResult, error) {
+	if options.PageSize < 1 {
+		return BuildResult{}, fmt.Errorf("Размер страницы должен быть положительным")
+	}
+	if err := checkOutput(options.Out); err != nil {
+		return BuildResult{}, err
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(filepath.Clean(options.Out)), ".blog-static-*")
+	if err != nil {
+		return BuildResult{}, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0o755); err != nil {
+		return BuildResult{}, err
+	}
+
+	builder := &staticBuilder{dir: dir, pageSize: options.PageSize}
+	if err := builder.build(ctx); err != nil {
+		return BuildResult{}, err
+	}
+	if err := replaceOutput(dir, options.Out); err != nil {
+		return BuildResult{}, err
+	}
+	return builder.result, nil
+}
+
+// checkOutput не даёт заменить каталог, созданный не сборкой
+func checkOutput(out string) error {
+	entries, err := os.ReadDir(out)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(out, buildMarker)); err != nil {
+		return fmt.Errorf("%w: %s", ErrOutputNotEmpty, out)
+	}
+	return nil
+}
+
+// replaceOutput ставит новую сборку на место старой. Между двумя
+// переименованиями каталога out нет, но частично записанным он не бывает
+func replaceOutput(dir, out string) error {
+	old := ""
+	if _, err := os.Stat(out); err == nil {
+		old = dir + ".old"
+		if err := os.Rename(out, old); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(dir, out); err != nil {
+		if old != "" {
+			os.Rename(old, out)
+		}
+		return err
+	}
+	if old != "" {
+		return os.RemoveAll(old)
+	}
+	return nil
+}
+
+type staticBuilder struct {
+	dir      string
+	pageSize int
+	result   BuildResult
+	// Адреса страниц для карты сайта
+	urls []sitemap.URL
+}
+
+func (builder *staticBuilder) build(ctx context.Context) error {
+	articles, err := dbwork.DB.GetAllArticle(ctx, models.ArticleFilter{Sort: models.SortNewest})
+	if err != nil {
+		return err
+	}
+
+	views := make([]ArticleView, 0, len(articles))
+	entries := make([]feed.Entry, 0, len(articles))
+	byAuthor := make(map[string][]int)
+	for i, article := range articles {
+		view, err := NewArticleView(article)
+		if err != nil {
+			return err
+		}
+		views = append(views, view)
+		entries = append(entries, feed.Entry{Article: article, HTML: string(view.HTML)})
+		byAuthor[article.Author] = append(byAuthor[article.Author], i)
+
+		page := NewPage(view.Title)
+		page.Article = &view
+		if err := builder.page(view.URL, PageArticle, page, article.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	builder.result.Articles = len(articles)
+
+	err = builder.list(PageIndex, views, IndexPath, func(number int) Page {
+		title := ""
+		if number > 1 {
+			title = "Страница " + strconv.Itoa(number)
+		}
+		return NewPage(title)
+	})
+	if err != nil {
+		return err
+	}
+
+	authors := make([]string, 0, len(byAuthor))
+	for login := range byAuthor {
+		authors = append(authors, login)
+	}
+	slices.Sort(authors)
+	for _, login := range authors {
+		// Логин становится именем каталога
+		if !fs.ValidPath(login) || strings.Contains(login, "/") {
+			slog.Warn("Пропущена страница автора с недопустимым логином", "login", login)
+			continue
+		}
+		if err := builder.author(login, byAuthor[login], views, entries); err != nil {
+			return err
+		}
+		builder.result.Authors++
+	}
+
+	if err := builder.feeds(entries); err != nil {
+		return err
+	}
+	if err := builder.sitemap(); err != nil {
+		return err
+	}
+	if err := builder.assets(); err != nil {
+		return err
+	}
+	return builder.file(buildMarker, []byte("Каталог создан командой blog build-static и заменяется при следующей сборке\n"))
+}
+
+// list рендерит список статей постранично
+func (builder *staticBuilder) list(name string, views []ArticleView, pagePath func(int) string, newPage func(int) Page) error {
+	pages := max((len(views)+builder.pageSize-1)/builder.pageSize, 1)
+	for number := 1; number <= pages; number++ {
+		start := (number - 1) * builder.pageSize
+		end := min(start+builder.pageSize, len(views))
+
+		page := newPage(number)
+		page.Articles = views[start:end]
+		page.Pagination = NewPagination(number, pages, pagePath)
+		if err := builder.page(pagePath(number), name, page, time.Time{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (builder *staticBuilder) author(login string, indexes []int, views []ArticleView, entries []feed.Entry) error {
+	authorViews := make([]ArticleView, 0, len(indexes))
+	authorEntries := make([]feed.Entry, 0, len(indexes))
+	for _, i := range indexes {
+		authorViews = append(authorViews, views[i])
+		authorEntries = append(authorEntries, entries[i])
+	}
+
+	feedPath := "/user/" + login + "/feed.atom"
+	pagePath := func(number int) string { return AuthorPath(login, number) }
+	err := builder.list(PageAuthor, authorViews, pagePath, func(int) Page {
+		page := NewPage(login)
+		page.Author = login
+		page.Feeds = append(page.Feeds, FeedLink{Title: "Atom: " + login, Type: "application/atom+xml", URL: feedPath})
+		return page
+	})
+	if err != nil {
+		return err
+	}
+
+	title := feed.CurrentConfig().Title + ": " + login
+	body, err := feed.Atom(latest(authorEntries), title, feedPath, login)
+	if err != nil {
+		return err
+	}
+	return builder.file(feedPath, body)
+}
+
+func (builder *staticBuilder) feeds(entries []feed.Entry) error {
+	entries = latest(entries)
+	title := feed.CurrentConfig().Title
+
+	rss, err := feed.RSS(entries, title, "/feed.rss")
+	if err != nil {
+		return err
+	}
+	atom, err := feed.Atom(entries, title, "/feed.atom", "")
+	if err != nil {
+		return err
+	}
+	jsonFeed, err := feed.JSONFeed(entries, title, "/feed.json", "")
+	if err != nil {
+		return err
+	}
+
+	for name, body := range map[string][]byte{"/feed.rss": rss, "/feed.atom": atom, "/feed.json": jsonFeed} {
+		if err := builder.file(name, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sitemap пишет карту сайта, разбивая её на части, как и API
+func (builder *staticBuilder) sitemap() error {
+	if len(builder.urls) <= sitemap.MaxURLs {
+		body, err := sitemap.URLSet(builder.urls)
+		if err != nil {
+			return err
+		}
+		return builder.file("/sitemap.xml", body)
+	}
+
+	sitemaps := make([]sitemap.Sitemap, 0)
+	for start := 0; start < len(builder.urls); start += sitemap.MaxURLs {
+		name := "/sitemap-" + strconv.Itoa(len(sitemaps)+1) + ".xml"
+		body, err := sitemap.URLSet(builder.urls[start:min(start+sitemap.MaxURLs, len(builder.urls))])
+		if err != nil {
+			return err
+		}
+		if err := builder.file(name, body); err != nil {
+			return err
+		}
+		sitemaps = append(sitemaps, sitemap.Sitemap{Loc: feed.URL(name)})
+	}
+	body, err := sitemap.Index(sitemaps)
+	if err != nil {
+		return err
+	}
+	return builder.file("/sitemap.xml", body)
+}
+
+func (builder *staticBuilder) assets() error {
+	return fs.WalkDir(Assets(), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(Assets(), name)
+		if err != nil {
+			return err
+		}
+		return builder.file(name, data)
+	})
+}
+
+// page рендерит страницу и добавляет её в карту сайта
+func (builder *staticBuilder) page(urlPath, name string, page Page, modified time.Time) error {
+	var buffer bytes.Buffer
+	if err := Render(&buffer, name, page); err != nil {
+		return err
+	}
+	builder.urls = append(builder.urls, sitemap.URL{Loc: feed.URL(urlPath), LastMod: sitemap.LastMod(modified)})
+	return builder.file(urlPath, buffer.Bytes())
+}
+
+// file записывает файл по пути на сайте. Путь, оканчивающийся на /,
+// становится каталогом с index.html
+func (builder *staticBuilder) file(urlPath string, data []byte) error {
+	name, err := url.PathUnescape(strings.TrimPrefix(urlPath, "/"))
+	if err != nil {
+		return err
+	}
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("Недопустимый путь %s", urlPath)
+	}
+
+	target := filepath.Join(builder.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target, data, 0o644); err != nil {
+		return err
+	}
+	builder.result.Files++
+	return nil
+}
+
+// latest оставляет столько новых статей, сколько показывает лента API
+func latest(entries []feed.Entry) []feed.Entry {
+	return entries[:min(len(entries), feed.CurrentConfig().ItemCount)]
+}
@@ -0,0 +1,61 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Ограничение протокола sitemaps.org на число адресов в одном файле
+const MaxURLs = 50000
+
+const namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// Адрес страницы в карте сайта
+type URL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Ссылка на часть карты сайта в индексе
+type Sitemap struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []URL    `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name  `xml:"sitemapindex"`
+	XMLNS    string    `xml:"xmlns,attr"`
+	Sitemaps []Sitemap `xml:"sitemap"`
+}
+
+// LastMod форматирует время в формате W3C Datetime
+func LastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// URLSet формирует карту сайта со списком адресов
+func URLSet(urls []URL) ([]byte, error) {
+	return marshal(urlSet{XMLNS: namespace, URLs: urls})
+}
+
+// Index формирует индекс, ссылающийся на части карты сайта
+func Index(sitemaps []Sitemap) ([]byte, error) {
+	return marshal(sitemapIndex{XMLNS: namespace, Sitemaps: sitemaps})
+}
+
+func marshal(document interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
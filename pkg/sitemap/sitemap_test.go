@@ -0,0 +1,70 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastMod(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	for _, test := range []struct {
+		time time.Time
+		want string
+	}{
+		{time.Time{}, ""},
+		{time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), "2024-05-01T12:00:00Z"},
+		{time.Date(2024, 5, 1, 15, 0, 0, 0, moscow), "2024-05-01T12:00:00Z"},
+	} {
+		if got := LastMod(test.time); got != test.want {
+			t.Errorf("LastMod(%v) = %q, want %q", test.time, got, test.want)
+		}
+	}
+}
+
+func TestURLSet(t *testing.T) {
+	body, err := URLSet([]URL{
+		{Loc: "https://blog.example/article/1?a=1&b=2", LastMod: "2024-05-01T12:00:00Z"},
+		{Loc: "https://blog.example/article/2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(body), xml.Header) {
+		t.Error("missing XML declaration")
+	}
+
+	parsed := urlSet{}
+	if err := xml.Unmarshal(body, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.XMLName.Local != "urlset" || parsed.XMLName.Space != namespace || len(parsed.URLs) != 2 {
+		t.Fatalf("parsed %+v", parsed)
+	}
+	if parsed.URLs[0].Loc != "https://blog.example/article/1?a=1&b=2" {
+		t.Errorf("loc %q", parsed.URLs[0].Loc)
+	}
+	// Пустое время изменения не выводится
+	if strings.Count(string(body), "<lastmod>") != 1 {
+		t.Errorf("unexpected lastmod elements:\n%s", body)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	body, err := Index([]Sitemap{
+		{Loc: "https://blog.example/sitemap-1.xml", LastMod: "2024-05-01T12:00:00Z"},
+		{Loc: "https://blog.example/sitemap-2.xml", LastMod: "2024-05-02T12:00:00Z"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := sitemapIndex{}
+	if err := xml.Unmarshal(body, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.XMLName.Local != "sitemapindex" || parsed.XMLName.Space != namespace || len(parsed.Sitemaps) != 2 {
+		t.Fatalf("parsed %+v", parsed)
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubS3 — S3-совместимый сервер в памяти, понимающий запросы
+// к бакету и объектам в стиле пути (/bucket/key)
+type stubS3 struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	objects map[string]stubObject
+}
+
+type stubObject struct {
+	data        []byte
+	contentType string
+}
+
+func newStubS3(t *testing.T) (*stubS3, string) {
+	t.Helper()
+	stub := &stubS3{buckets: make(map[string]bool), objects: make(map[string]stubObject)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, strings.TrimPrefix(server.URL, "http://")
+}
+
+func (stub *stubS3) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !stub.buckets[bucket] {
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			stub.buckets[bucket] = true
+		default:
+			rw.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+
+	if !stub.buckets[bucket] {
+		stubS3Error(rw, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	name := bucket + "/" + key
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readS3Body(r)
+		if err != nil {
+			stubS3Error(rw, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		stub.objects[name] = stubObject{data: data, contentType: r.Header.Get("Content-Type")}
+		rw.Header().Set("ETag", stubETag(data))
+	case http.MethodGet, http.MethodHead:
+		object, ok := stub.objects[name]
+		if !ok {
+			stubS3Error(rw, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		header := rw.Header()
+		header.Set("ETag", stubETag(object.data))
+		header.Set("Content-Type", object.contentType)
+		header.Set("Content-Length", strconv.Itoa(len(object.data)))
+		header.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			rw.Write(object.data)
+		}
+	case http.MethodDelete:
+		delete(stub.objects, name)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		rw.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (stub *stubS3) object(name string) (stubObject, bool) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	object, ok := stub.objects[name]
+	return object, ok
+}
+
+func stubS3Error(rw http.ResponseWriter, status int, code string) {
+	rw.Header().Set("Content-Type", "application/xml")
+	rw.WriteHeader(status)
+	fmt.Fprintf(rw, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func stubETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// readS3Body читает тело запроса, разбирая потоковую подпись aws-chunked,
+// которую клиент использует при соединении без TLS
+func readS3Body(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return io.ReadAll(r.Body)
+	}
+
+	reader := bufio.NewReader(r.Body)
+	body := bytes.Buffer{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return body.Bytes(), nil
+		}
+		if _, err := io.CopyN(&body, reader, size); err != nil {
+			return nil, err
+		}
+		// Каждый блок заканчивается переводом строки
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func newTestS3(t *testing.T) (*S3, *stubS3) {
+	t.Helper()
+	stub, endpoint := newStubS3(t)
+	s3, err := NewS3(Config{
+		Endpoint:  endpoint,
+		AccessKey: "access",
+		SecretKey: "secret",
+		Bucket:    "media",
+		Region:    "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3, stub
+}
+
+func TestS3CreatesBucket(t *testing.T) {
+	_, stub := newTestS3(t)
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if !stub.buckets["media"] {
+		t.Fatal("bucket was not created")
+	}
+}
+
+func TestS3PutGetDelete(t *testing.T) {
+	s3, stub := newTestS3(t)
+	ctx := context.Background()
+	data := []byte("image bytes")
+
+	if err := s3.Put(ctx, "originals/1", bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	object, ok := stub.object("media/originals/1")
+	if !ok || !bytes.Equal(object.data, data) || object.contentType != "image/png" {
+		t.Fatalf("stored object %q (%s), ok %v", object.data, object.contentType, ok)
+	}
+
+	body, err := s3.Get(ctx, "originals/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	if err := s3.Delete(ctx, "originals/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s3.Get(ctx, "originals/1"); err != ErrNotFound {
+		t.Fatalf("Get after Delete: %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3GetMissing(t *testing.T) {
+	s3, _ := newTestS3(t)
+	if _, err := s3.Get(context.Background(), "missing"); err != ErrNotFound {
+		t.Fatalf("Get(missing): %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Storage — хранилище загруженных файлов
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Параметры хранилища
+type Config struct {
+	Backend string
+	// Каталог для локального хранилища
+	Dir string
+	// Параметры S3-совместимого хранилища
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+var (
+	Store Storage
+
+	ErrNotFound   = errors.New("Файл не найден")
+	ErrInvalidKey = errors.New("Недопустимый ключ файла")
+)
+
+func InitializationStorage(config Config) error {
+	switch config.Backend {
+	case BackendLocal, "":
+		local, err := NewLocal(config.Dir)
+		if err != nil {
+			return err
+		}
+		Store = local
+	case BackendS3:
+		s3, err := NewS3(config)
+		if err != nil {
+			return err
+		}
+		Store = s3
+	default:
+		return fmt.Errorf("Неизвестное хранилище файлов: %s", config.Backend)
+	}
+	return nil
+}